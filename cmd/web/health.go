@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+//readinessCheck is one dependency that must be working before the instance takes traffic
+type readinessCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+//readinessChecks are run by /readyz; they are set up in run()
+var readinessChecks []readinessCheck
+
+//healthz reports that the process is alive
+func healthz(rw http.ResponseWriter, r *http.Request) {
+	writeHealth(rw, http.StatusOK, map[string]interface{}{"status": "ok"})
+}
+
+//readyz runs every readiness check and reports 503 if any of them fails
+func readyz(rw http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	status := http.StatusOK
+	results := map[string]string{}
+
+	for _, c := range readinessChecks {
+		err := c.check(ctx)
+		if err != nil {
+			status = http.StatusServiceUnavailable
+			results[c.name] = err.Error()
+			continue
+		}
+		results[c.name] = "ok"
+	}
+
+	resp := map[string]interface{}{"status": "ok", "checks": results}
+	if status != http.StatusOK {
+		resp["status"] = "unavailable"
+	}
+
+	writeHealth(rw, status, resp)
+}
+
+func writeHealth(rw http.ResponseWriter, status int, v interface{}) {
+	out, _ := json.Marshal(v)
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(status)
+	rw.Write(out)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthz(t *testing.T) {
+	rr := httptest.NewRecorder()
+	healthz(rr, httptest.NewRequest("GET", "/healthz", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("healthz returned %d", rr.Code)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	defer func(checks []readinessCheck) { readinessChecks = checks }(readinessChecks)
+
+	var dbErr error
+	readinessChecks = []readinessCheck{
+		{"database", func(ctx context.Context) error { return dbErr }},
+		{"mail_worker", func(ctx context.Context) error { return nil }},
+	}
+
+	rr := httptest.NewRecorder()
+	readyz(rr, httptest.NewRequest("GET", "/readyz", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("readyz returned %d with every check passing", rr.Code)
+	}
+
+	dbErr = errors.New("connection refused")
+
+	rr = httptest.NewRecorder()
+	readyz(rr, httptest.NewRequest("GET", "/readyz", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("readyz returned %d with a failing check", rr.Code)
+	}
+
+	var resp struct {
+		Status string
+		Checks map[string]string
+	}
+	err := json.Unmarshal(rr.Body.Bytes(), &resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != "unavailable" || resp.Checks["database"] != "connection refused" || resp.Checks["mail_worker"] != "ok" {
+		t.Errorf("unexpected readyz body %s", rr.Body.String())
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Rha02/bookings/internal/config"
+	"github.com/Rha02/bookings/internal/importer"
+	"github.com/Rha02/bookings/internal/repository/dbrepo"
+)
+
+//runImport loads reservations from a CSV file, printing a dry-run report unless -commit is given
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	file := fs.String("file", "", "CSV file with reservations to import")
+	commit := fs.Bool("commit", false, "Insert the valid rows instead of only reporting on them")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s import -file reservations.csv [-commit] [config flags]\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "Columns: %s\n", strings.Join(importer.Columns, ","))
+		fs.PrintDefaults()
+	}
+
+	settings, err := config.Load(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if *file == "" {
+		fs.Usage()
+		return errors.New("missing required flags")
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	db, err := connectDB(settings.Database)
+	if err != nil {
+		return err
+	}
+	defer db.SQL.Close()
+
+	repo := dbrepo.New(db, &app)
+
+	var report *importer.Report
+	if *commit {
+		report, err = importer.Commit(repo, settings.StayRuleModels(), f)
+	} else {
+		report, err = importer.DryRun(repo, settings.StayRuleModels(), f)
+	}
+
+	if report != nil {
+		printImportReport(report)
+	}
+
+	return err
+}
+
+func printImportReport(report *importer.Report) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "LINE\tGUEST\tROOM\tARRIVAL\tDEPARTURE\tSTATUS")
+
+	for _, row := range report.Rows {
+		res := row.Reservation
+
+		status := "ok"
+		switch {
+		case row.Imported:
+			status = fmt.Sprintf("imported as #%d", res.ID)
+		case len(row.Errors) > 0:
+			status = "error: " + strings.Join(row.Errors, "; ")
+		case row.Conflict != "":
+			status = "conflict: " + row.Conflict
+		}
+
+		fmt.Fprintf(w, "%d\t%s %s\t%d\t%s\t%s\t%s\n", row.Line, res.FirstName, res.LastName, res.RoomID,
+			res.StartDate.Format("01-02-2006"), res.EndDate.Format("01-02-2006"), status)
+	}
+	w.Flush()
+
+	fmt.Printf("\n%d rows: %d valid, %d with errors, %d conflicts", len(report.Rows),
+		report.ValidCount(), report.ErrorCount(), report.ConflictCount())
+
+	if report.Committed {
+		fmt.Printf(", %d imported\n", report.ImportedCount())
+	} else {
+		fmt.Println(" (dry run, nothing was imported; rerun with -commit)")
+	}
+}
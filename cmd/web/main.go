@@ -1,53 +1,99 @@
 package main
 
 import (
+	"context"
 	"encoding/gob"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/Rha02/bookings/internal/config"
 	"github.com/Rha02/bookings/internal/driver"
 	"github.com/Rha02/bookings/internal/handlers"
 	"github.com/Rha02/bookings/internal/helpers"
+	"github.com/Rha02/bookings/internal/logging"
+	"github.com/Rha02/bookings/internal/mailer"
+	"github.com/Rha02/bookings/internal/metrics"
 	"github.com/Rha02/bookings/internal/models"
 	"github.com/Rha02/bookings/internal/render"
+	"github.com/Rha02/bookings/internal/repository/dbrepo"
+	"github.com/Rha02/bookings/internal/scheduler"
+	"github.com/Rha02/bookings/internal/sessionstore"
 	"github.com/alexedwards/scs/v2"
+	"github.com/rs/zerolog"
 )
 
-const portNumber = ":8080"
-
 var app config.AppConfig
 var session *scs.SessionManager
-var infoLog *log.Logger
-var errorLog *log.Logger
+var workers []func(context.Context)
+var addr string
+var shutdownTimeout time.Duration
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		err := runImport(os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err := runMigrate(os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "seed" {
+		err := runSeed(os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	db, err := run()
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer db.SQL.Close()
 
-	defer close(app.MailChan)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	fmt.Println("Starting mail listener...")
-	listenForMail()
-
-	fmt.Printf("Starting application on port %s", portNumber)
+	app.Logger.Info().Str("addr", addr).Msg("starting application")
 
 	srv := &http.Server{
-		Addr:    portNumber,
+		Addr:    addr,
 		Handler: routes(&app),
 	}
 
-	err = srv.ListenAndServe()
+	err = serve(ctx, srv, shutdownTimeout, workers...)
 	if err != nil {
-		log.Fatal(err)
+		app.Logger.Error().Err(err).Msg("server stopped with an error")
 	}
+
+	err = db.SQL.Close()
+	if err != nil {
+		app.Logger.Error().Err(err).Msg("cannot close the database")
+	}
+
+	app.Logger.Info().Msg("stopped")
+}
+
+//connectDB opens the database described by the settings
+func connectDB(s config.DatabaseSettings) (*driver.DB, error) {
+	return driver.ConnectSQLWithPool(s.DSN(), driver.Pool{
+		MaxOpen:     s.Pool,
+		MaxIdle:     s.IdlePool,
+		MaxLifetime: s.MaxLifetime,
+	})
 }
 
 func run() (*driver.DB, error) {
@@ -58,62 +104,98 @@ func run() (*driver.DB, error) {
 	gob.Register(models.Room{})
 	gob.Register(map[string]int{})
 
-	//read flags
-	inProduction := flag.Bool("production", false, "Application is in production")
-	useCache := flag.Bool("cache", true, "Use template cache")
-	dbHost := flag.String("dbhost", "localhost", "Database host")
-	dbName := flag.String("dbname", "", "Database name")
-	dbUser := flag.String("dbuser", "", "Database user")
-	dbPass := flag.String("dbpass", "", "Database password")
-	dbPort := flag.String("dbport", "", "Database port")
-	dbSSL := flag.String("dbssl", "disable", "Database SSL settings (disable, prefer, require)")
-
-	flag.Parse()
-
-	if *dbName == "" || *dbUser == "" {
-		fmt.Println("Missing required flags")
-		os.Exit(1)
+	//read the config file, environment and flags
+	settings, err := config.Load(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		return nil, err
 	}
 
-	//
-	mailChan := make(chan models.MailData)
-	app.MailChan = mailChan
+	addr = settings.Addr
+	shutdownTimeout = settings.ShutdownTimeout
 
 	//Change this to true when in production, keep it false when in development
-	app.InProduction = *inProduction
+	app.InProduction = settings.InProduction
+
+	app.Logger, err = logging.New(os.Stdout, settings.LogFormatOrDefault(), settings.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+	//loggers taken from a context without a request logger fall back to the application logger
+	zerolog.DefaultContextLogger = &app.Logger
+
+	//Connect to database
+	app.Logger.Info().Msg("connecting to database")
+	db, err := connectDB(settings.Database)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to database: %w", err)
+	}
 
-	infoLog = log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-	app.InfoLog = infoLog
+	store, err := sessionstore.New(settings.Session.Store, db.SQL)
+	if err != nil {
+		return nil, err
+	}
 
-	errorLog = log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
-	app.ErrorLog = errorLog
+	if p, ok := store.(*sessionstore.PostgresStore); ok {
+		p.CleanupInterval = settings.Session.CleanupInterval
+		p.Logger = app.Logger
+		workers = append(workers, p.Run)
+	}
 
 	session = scs.New()
-	session.Lifetime = 24 * time.Hour
+	session.Store = store
+	session.Lifetime = settings.Session.Lifetime
 	session.Cookie.Persist = true
 	session.Cookie.SameSite = http.SameSiteLaxMode
 	session.Cookie.Secure = app.InProduction
 
 	app.Session = session
 
-	//Connect to database
-	log.Println("Connecting to database")
-	connString := fmt.Sprintf("host=%s port=%s dbname=%s user=%s password=%s sslmode=%s", *dbHost, *dbPort, *dbName, *dbUser, *dbPass, *dbSSL)
-	db, err := driver.ConnectSQL(connString)
+	tc, err := render.CreateTemplateCache()
 	if err != nil {
-		log.Fatal("Cannot connect to database! Dying...")
+		return nil, fmt.Errorf("cannot create template cache: %w", err)
 	}
 
-	tc, err := render.CreateTemplateCache()
+	app.TemplateCache = tc
+	app.UseCache = settings.UseCache
+
+	mtc, err := render.CreateMailTemplateCache()
 	if err != nil {
-		log.Fatal("Cannot create template cache", err)
 		return nil, err
 	}
 
-	app.TemplateCache = tc
-	app.UseCache = *useCache
+	app.MailTemplateCache = mtc
+
+	app.Property = settings.Property.Model()
+	app.StayRules = settings.StayRuleModels()
+
+	m, err := mailer.New(mailConfig(settings.Mail))
+	if err != nil {
+		return nil, err
+	}
 
 	repo := handlers.NewRepo(&app, db)
+	if settings.AvailabilityCacheTTL > 0 {
+		repo.DB = dbrepo.NewCachedRepo(repo.DB, settings.AvailabilityCacheTTL)
+	}
+
+	mailWorker := mailer.NewWorker(repo.DB, m, app.Logger)
+	emailScheduler := scheduler.New(&app, repo.DB)
+	workers = append(workers, mailWorker.Run, emailScheduler.Run)
+
+	readinessChecks = []readinessCheck{
+		{"database", db.SQL.PingContext},
+		{"mail_worker", func(ctx context.Context) error { return mailWorker.Ready() }},
+	}
+
+	err = metrics.RegisterDB(db.SQL, settings.Database.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	err = metrics.RegisterMailQueue(repo.DB)
+	if err != nil {
+		return nil, err
+	}
 
 	handlers.NewHandlers(repo)
 
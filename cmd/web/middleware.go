@@ -2,8 +2,14 @@ package main
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/Rha02/bookings/internal/helpers"
+	"github.com/Rha02/bookings/internal/i18n"
+	"github.com/Rha02/bookings/internal/logging"
+	"github.com/Rha02/bookings/internal/metrics"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/chi/v5"
 	"github.com/justinas/nosurf"
 )
 
@@ -26,6 +32,31 @@ func SessionLoad(next http.Handler) http.Handler {
 	return session.LoadAndSave(next)
 }
 
+//LogUser adds the logged in user to the request logger
+func LogUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if id, ok := session.Get(r.Context(), "user_id").(int); ok {
+			logging.AddFields(r, map[string]interface{}{"user_id": id})
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+//Locale adds the language of the request to its context: the one the visitor chose, or else the best match
+//for their browser's Accept-Language header
+func Locale(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		locale := session.GetString(r.Context(), "locale")
+		if !i18n.Supported(locale) {
+			locale = i18n.Negotiate(r.Header.Get("Accept-Language"))
+		}
+
+		rw.Header().Set("Content-Language", locale)
+		rw.Header().Add("Vary", "Accept-Language")
+		next.ServeHTTP(rw, r.WithContext(i18n.WithLocale(r.Context(), locale)))
+	})
+}
+
 func Auth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
 		if !helpers.IsAuthenticated(r) {
@@ -36,3 +67,26 @@ func Auth(next http.Handler) http.Handler {
 		next.ServeHTTP(rw, r)
 	})
 }
+
+//Metrics records the count and latency of every request by its chi route pattern
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(rw, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		//label by pattern rather than path so ids in the URL do not create a series each
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		metrics.ObserveRequest(r.Method, route, status, time.Since(start))
+	})
+}
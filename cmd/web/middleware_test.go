@@ -3,7 +3,11 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+
+	"github.com/Rha02/bookings/internal/i18n"
+	"github.com/alexedwards/scs/v2"
 )
 
 func TestNoSurf(t *testing.T) {
@@ -31,3 +35,68 @@ func TestSessionLoad(t *testing.T) {
 		t.Error(fmt.Sprintf("Type is not http.Handler, but is %T", v))
 	}
 }
+
+func TestMetrics(t *testing.T) {
+	var mh myHandler
+
+	h := Metrics(&mh)
+
+	switch v := h.(type) {
+	case http.Handler:
+		// do nothing
+	default:
+		t.Error(fmt.Sprintf("Type is not http.Handler, but is %T", v))
+	}
+}
+
+func TestLogUser(t *testing.T) {
+	var mh myHandler
+
+	h := LogUser(&mh)
+
+	switch v := h.(type) {
+	case http.Handler:
+		// do nothing
+	default:
+		t.Error(fmt.Sprintf("Type is not http.Handler, but is %T", v))
+	}
+}
+
+func TestLocale(t *testing.T) {
+	saved := session
+	session = scs.New()
+	defer func() { session = saved }()
+
+	var tests = []struct {
+		name           string
+		acceptLanguage string
+		chosen         string
+		expected       string
+	}{
+		{"no preference", "", "", "en"},
+		{"browser language", "es-ES,es;q=0.9", "", "es"},
+		{"chosen language", "es-ES,es;q=0.9", "en", "en"},
+		{"unsupported choice", "es", "xx", "es"},
+	}
+
+	for _, e := range tests {
+		var got string
+		h := session.LoadAndSave(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if e.chosen != "" {
+				session.Put(r.Context(), "locale", e.chosen)
+			}
+			Locale(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				got = i18n.FromContext(r.Context())
+			})).ServeHTTP(rw, r)
+		}))
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Language", e.acceptLanguage)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if got != e.expected || rr.Header().Get("Content-Language") != e.expected {
+			t.Errorf("%s: expected %s, got %s (Content-Language %q)", e.name, e.expected, got, rr.Header().Get("Content-Language"))
+		}
+	}
+}
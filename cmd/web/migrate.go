@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Rha02/bookings/internal/config"
+	"github.com/Rha02/bookings/internal/migrate"
+	"github.com/Rha02/bookings/migrations"
+)
+
+//runMigrate applies, rolls back, lists or creates the SQL migrations embedded in the binary
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dir := fs.String("dir", "./migrations", "Directory new migrations are created in")
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s migrate [config flags] up | down [steps] | status | create name\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	settings, err := config.Load(fs, args)
+	//create only writes files, so it does not need a valid database configuration
+	if fs.Arg(0) == "create" {
+		if fs.NArg() != 2 {
+			fs.Usage()
+			return errors.New("create needs a migration name")
+		}
+		paths, err := migrate.Create(*dir, fs.Arg(1), settings.Database.Dialect, time.Now())
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			fmt.Println("Created", path)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	db, err := connectDB(settings.Database)
+	if err != nil {
+		return err
+	}
+	defer db.SQL.Close()
+
+	m, err := migrate.New(db.SQL, migrations.FS, db.Dialect)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	switch fs.Arg(0) {
+	case "up":
+		done, err := m.Up(ctx)
+		printMigrations("Applied", done)
+		return err
+	case "down":
+		steps := 1
+		if fs.NArg() > 1 {
+			steps, err = strconv.Atoi(fs.Arg(1))
+			if err != nil || steps < 1 {
+				return fmt.Errorf("steps %q must be a positive number", fs.Arg(1))
+			}
+		}
+		done, err := m.Down(ctx, steps)
+		printMigrations("Rolled back", done)
+		return err
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		printMigrationStatus(statuses)
+		return nil
+	default:
+		fs.Usage()
+		return errors.New("missing or unknown migrate command")
+	}
+}
+
+func printMigrations(verb string, done []migrate.Migration) {
+	if len(done) == 0 {
+		fmt.Println("Nothing to do")
+		return
+	}
+	for _, m := range done {
+		fmt.Printf("%s %s_%s\n", verb, m.Version, m.Name)
+	}
+}
+
+func printMigrationStatus(statuses []migrate.Status) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS")
+
+	for _, s := range statuses {
+		status := "pending"
+		if s.Applied {
+			status = "applied"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.Version, s.Name, status)
+	}
+	w.Flush()
+}
@@ -5,6 +5,8 @@ import (
 
 	"github.com/Rha02/bookings/internal/config"
 	"github.com/Rha02/bookings/internal/handlers"
+	"github.com/Rha02/bookings/internal/logging"
+	"github.com/Rha02/bookings/internal/metrics"
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/chi/v5"
 )
@@ -13,9 +15,17 @@ func routes(app *config.AppConfig) http.Handler {
 	mux := chi.NewRouter()
 
 	//Applying middleware
+	mux.Use(Metrics)
+	mux.Use(logging.Middleware(app.Logger))
 	mux.Use(middleware.Recoverer)
 	mux.Use(NoSurf)
 	mux.Use(SessionLoad)
+	mux.Use(LogUser)
+	mux.Use(Locale)
+
+	mux.Get("/healthz", healthz)
+	mux.Get("/readyz", readyz)
+	mux.Handle("/metrics", metrics.Handler())
 
 	//Routes
 	mux.Get("/", handlers.Repo.Home)
@@ -26,6 +36,7 @@ func routes(app *config.AppConfig) http.Handler {
 	mux.Get("/search-availability", handlers.Repo.Availability)
 	mux.Post("/search-availability", handlers.Repo.PostAvailability)
 	mux.Post("/search-availability-json", handlers.Repo.AvailabilityJSON)
+	mux.Get("/booked-dates", handlers.Repo.BookedDates)
 	mux.Get("/choose-room/{id}", handlers.Repo.ChooseRoom)
 	mux.Get("/book-room", handlers.Repo.BookRoom)
 
@@ -39,6 +50,8 @@ func routes(app *config.AppConfig) http.Handler {
 	mux.Post("/login", handlers.Repo.PostShowLogin)
 	mux.Get("/logout", handlers.Repo.Logout)
 
+	mux.Get("/locale/{locale}", handlers.Repo.SetLocale)
+
 	fileServer := http.FileServer(http.Dir("./static/"))
 
 	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
@@ -57,6 +70,24 @@ func routes(app *config.AppConfig) http.Handler {
 
 		mux.Get("/process-reservation/{src}/{id}/do", handlers.Repo.AdminProcessReservation)
 		mux.Get("/delete-reservation/{src}/{id}/do", handlers.Repo.AdminDeleteReservation)
+		mux.Get("/cancel-reservation/{src}/{id}/do", handlers.Repo.AdminCancelReservation)
+
+		mux.Get("/search", handlers.Repo.AdminSearch)
+
+		mux.Get("/guests", handlers.Repo.AdminGuests)
+		mux.Get("/guests/{id}", handlers.Repo.AdminShowGuest)
+		mux.Post("/guests/{id}", handlers.Repo.AdminPostGuest)
+		mux.Post("/guests/{id}/merge", handlers.Repo.AdminMergeGuest)
+
+		mux.Get("/import", handlers.Repo.AdminImport)
+		mux.Post("/import", handlers.Repo.AdminPostImport)
+		mux.Post("/import/commit", handlers.Repo.AdminPostImportCommit)
+
+		mux.Get("/outbox", handlers.Repo.AdminOutbox)
+		mux.Post("/outbox/{id}/resend", handlers.Repo.AdminResendOutbox)
+
+		mux.Get("/email-schedules", handlers.Repo.AdminEmailSchedules)
+		mux.Post("/email-schedules/{id}", handlers.Repo.AdminPostEmailSchedule)
 	})
 
 	return mux
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Rha02/bookings/internal/config"
+	"github.com/Rha02/bookings/internal/repository/dbrepo"
+	"github.com/Rha02/bookings/internal/seed"
+)
+
+//runSeed fills the database with generated rooms, staff users, reservations and blocks.
+//The dataset depends only on the flags, so printing them is enough to reproduce it.
+func runSeed(args []string) error {
+	today := time.Now().UTC()
+
+	fs := flag.NewFlagSet("seed", flag.ExitOnError)
+	seedValue := fs.Int64("seed", today.UnixNano(), "Random seed; rerun with the same seed and dates to get the same data")
+	rooms := fs.Int("rooms", 5, "Number of rooms to create")
+	staff := fs.Int("staff", 2, "Number of staff users to create, as staff1@bookings.loc, staff2@bookings.loc, ...")
+	reservations := fs.Int("reservations", 50, "Number of reservations to create")
+	blocks := fs.Int("blocks", 5, "Number of owner blocks to create")
+	from := fs.String("from", today.Format("2006-01-02"), "First day reservations may start on (YYYY-MM-DD)")
+	to := fs.String("to", today.AddDate(0, 0, 90).Format("2006-01-02"), "Last day reservations may end on (YYYY-MM-DD)")
+	password := fs.String("password", "password", "Password of the staff users")
+	dryRun := fs.Bool("dry-run", false, "Only print what would be created")
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s seed [-seed n] [-from date] [-to date] [counts] [config flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	//a dry run does not touch the database, so it does not need a valid configuration
+	settings, loadErr := config.Load(fs, args)
+	if loadErr != nil && !*dryRun {
+		return loadErr
+	}
+
+	opts := seed.Options{
+		Seed:         *seedValue,
+		Rooms:        *rooms,
+		Staff:        *staff,
+		Reservations: *reservations,
+		Blocks:       *blocks,
+		Password:     *password,
+	}
+
+	var err error
+	opts.From, err = time.Parse("2006-01-02", *from)
+	if err != nil {
+		return errors.New("from must be a date like 2026-10-19")
+	}
+	opts.To, err = time.Parse("2006-01-02", *to)
+	if err != nil {
+		return errors.New("to must be a date like 2027-01-17")
+	}
+
+	ds, err := seed.Generate(opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Seed %d, %s to %s: %d rooms, %d staff, %d reservations, %d blocks\n", opts.Seed, *from, *to,
+		len(ds.Rooms), len(ds.Staff), len(ds.Bookings), len(ds.Blocks))
+	fmt.Printf("Reproduce with: %s seed -seed %d -from %s -to %s -rooms %d -staff %d -reservations %d -blocks %d\n",
+		os.Args[0], opts.Seed, *from, *to, opts.Rooms, opts.Staff, opts.Reservations, opts.Blocks)
+
+	if *dryRun {
+		fmt.Println("Dry run, nothing was inserted")
+		return nil
+	}
+
+	db, err := connectDB(settings.Database)
+	if err != nil {
+		return err
+	}
+	defer db.SQL.Close()
+
+	sum, err := seed.Apply(dbrepo.New(db, &app), ds, opts.Password)
+	fmt.Printf("Inserted %d rooms, %d staff, %d reservations, %d blocks\n", sum.Rooms, sum.Staff, sum.Reservations, sum.Blocks)
+
+	return err
+}
@@ -1,58 +1,20 @@
 package main
 
 import (
-	"fmt"
-	"io/ioutil"
-	"log"
-	"strings"
-	"time"
-
-	"github.com/Rha02/bookings/internal/models"
-	mail "github.com/xhit/go-simple-mail/v2"
+	"github.com/Rha02/bookings/internal/config"
+	"github.com/Rha02/bookings/internal/mailer"
 )
 
-func listenForMail() {
-	go func() {
-		for {
-			msg := <-app.MailChan
-			sendMsg(msg)
-		}
-	}()
-}
-
-func sendMsg(m models.MailData) {
-	server := mail.NewSMTPClient()
-	server.Host = "localhost"
-	server.Port = 1025
-	server.KeepAlive = false
-	server.ConnectTimeout = 10 * time.Second
-	server.SendTimeout = 10 * time.Second
-
-	client, err := server.Connect()
-	if err != nil {
-		errorLog.Println(err)
-	}
-
-	email := mail.NewMSG()
-	email.SetFrom(m.From).AddTo(m.To).SetSubject(m.Subject)
-	if m.Template == "" {
-		email.SetBody(mail.TextHTML, m.Content)
-	} else {
-		data, err := ioutil.ReadFile(fmt.Sprintf("./email-templates/%s", m.Template))
-		if err != nil {
-			app.ErrorLog.Println(err)
-		}
-
-		mailTemplate := string(data)
-		msgToSend := strings.Replace(mailTemplate, "[%body%]", m.Content, 1)
-
-		email.SetBody(mail.TextHTML, msgToSend)
-	}
-
-	err = email.Send(client)
-	if err != nil {
-		log.Println(err)
-	} else {
-		log.Println("Email sent!")
+//mailConfig converts the mail settings into the mailer configuration
+func mailConfig(s config.MailSettings) mailer.Config {
+	return mailer.Config{
+		Transport:    s.Transport,
+		Host:         s.Host,
+		Port:         s.Port,
+		Username:     s.Username,
+		Password:     s.Password,
+		StartTLS:     s.StartTLS,
+		SendmailPath: s.Sendmail,
+		Dir:          s.Dir,
 	}
 }
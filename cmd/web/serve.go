@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+//serve runs srv and the background workers until ctx is cancelled or the server fails.
+//It then stops accepting connections, waits up to timeout for active requests to finish
+//and waits for the workers to return before returning itself.
+func serve(ctx context.Context, srv *http.Server, timeout time.Duration, workers ...func(context.Context)) error {
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	var wg sync.WaitGroup
+	for _, worker := range workers {
+		wg.Add(1)
+		go func(run func(context.Context)) {
+			defer wg.Done()
+			run(workerCtx)
+		}(worker)
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	var err error
+	select {
+	case err = <-serverErr:
+	case <-ctx.Done():
+		app.Logger.Info().Dur("timeout", timeout).Msg("shutting down, waiting for active requests to finish")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		err = srv.Shutdown(shutdownCtx)
+	}
+
+	stopWorkers()
+	wg.Wait()
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
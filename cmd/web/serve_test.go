@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestServe(t *testing.T) {
+	app.Logger = zerolog.Nop()
+
+	srv := &http.Server{
+		Addr:    "127.0.0.1:0",
+		Handler: &myHandler{},
+	}
+
+	stopped := false
+	worker := func(ctx context.Context) {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		stopped = true
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error)
+	go func() {
+		done <- serve(ctx, srv, time.Second, worker)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected a clean shutdown, got %s", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("serve did not return after its context was cancelled")
+	}
+
+	if !stopped {
+		t.Error("serve returned before the worker stopped")
+	}
+}
+
+func TestServe_ListenError(t *testing.T) {
+	srv := &http.Server{
+		Addr:    "invalid address",
+		Handler: &myHandler{},
+	}
+
+	err := serve(context.Background(), srv, time.Second)
+	if err == nil {
+		t.Error("expected an error for an invalid address")
+	}
+}
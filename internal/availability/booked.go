@@ -0,0 +1,61 @@
+package availability
+
+import "time"
+
+//MaxBookedDays is the longest window booked nights are returned for
+const MaxBookedDays = 366
+
+//BookedNights returns the nights from start up to end that the room cannot be booked for, in order
+func BookedNights(store Store, roomID int, start, end time.Time) ([]time.Time, error) {
+	var booked []time.Time
+
+	nights, err := takenNights(store, roomID, start, end)
+	if err != nil {
+		return booked, err
+	}
+
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		if nights[night(d)] {
+			booked = append(booked, d)
+		}
+	}
+
+	return booked, nil
+}
+
+//FullyBookedNights returns the nights from start up to end that no room can be booked for, in order
+func FullyBookedNights(store Store, start, end time.Time) ([]time.Time, error) {
+	var booked []time.Time
+
+	rooms, err := store.AllRooms()
+	if err != nil {
+		return booked, err
+	}
+
+	taken := make([]map[string]bool, 0, len(rooms))
+	for _, room := range rooms {
+		nights, err := takenNights(store, room.ID, start, end)
+		if err != nil {
+			return booked, err
+		}
+		taken = append(taken, nights)
+	}
+
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		if allTaken(taken, night(d)) {
+			booked = append(booked, d)
+		}
+	}
+
+	return booked, nil
+}
+
+//allTaken returns true if the night is in every room's taken nights
+func allTaken(taken []map[string]bool, n string) bool {
+	for _, nights := range taken {
+		if !nights[n] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+package availability
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Rha02/bookings/internal/config"
+	"github.com/Rha02/bookings/internal/repository/dbrepo"
+)
+
+func TestBookedNights(t *testing.T) {
+	repo := dbrepo.NewMemoryRepo(&config.AppConfig{})
+	block(t, repo, 1, 3, 5)
+	block(t, repo, 1, 8, 9)
+	block(t, repo, 2, 4, 6)
+
+	var tests = []struct {
+		name     string
+		roomID   int
+		expected []int
+	}{
+		{"room 1", 1, []int{3, 4, 8}},
+		{"room 2", 2, []int{4, 5}},
+		{"every room", 0, []int{4}},
+	}
+
+	for _, e := range tests {
+		var nights []int
+
+		if e.roomID == 0 {
+			booked, err := FullyBookedNights(repo, date(1), date(10))
+			if err != nil {
+				t.Fatalf("%s: %s", e.name, err)
+			}
+			for _, d := range booked {
+				nights = append(nights, d.Day())
+			}
+		} else {
+			booked, err := BookedNights(repo, e.roomID, date(1), date(10))
+			if err != nil {
+				t.Fatalf("%s: %s", e.name, err)
+			}
+			for _, d := range booked {
+				nights = append(nights, d.Day())
+			}
+		}
+
+		if len(nights) != len(e.expected) {
+			t.Errorf("%s: expected nights %v, got %v", e.name, e.expected, nights)
+			continue
+		}
+		for i := range nights {
+			if nights[i] != e.expected[i] {
+				t.Errorf("%s: expected nights %v, got %v", e.name, e.expected, nights)
+				break
+			}
+		}
+	}
+
+	//the window's end is the departure day, so the night starting on it is not included
+	if booked, _ := BookedNights(repo, 1, date(1), date(3)); len(booked) != 0 {
+		t.Errorf("expected no nights before the 3rd, got %v", booked)
+	}
+
+	fault := errors.New("connection refused")
+	repo.Fail("GetRestrictionsForRoomByDate", fault)
+
+	if _, err := FullyBookedNights(repo, date(1), date(10)); err != fault {
+		t.Errorf("expected the repository error, got %v", err)
+	}
+}
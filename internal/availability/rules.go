@@ -0,0 +1,144 @@
+package availability
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Rha02/bookings/internal/i18n"
+	"github.com/Rha02/bookings/internal/models"
+)
+
+//RuleError is a stay rule broken by a stay, with a message that can be shown to guests in their language
+type RuleError struct {
+	Rule    string
+	Message i18n.Message
+}
+
+//Error returns the message in the default locale
+func (e *RuleError) Error() string {
+	return e.Message.In(i18n.Default)
+}
+
+//CheckRules returns a *RuleError for the first rule the stay in the room breaks, or nil if it breaks none.
+//Buffer nights are not checked here as they depend on the room's other stays; Bookable checks them.
+func CheckRules(rules []models.StayRule, roomID int, start, end, today time.Time) error {
+	n := int(end.Sub(start).Hours() / 24)
+
+	for _, r := range rules {
+		if !r.Applies(roomID, start) {
+			continue
+		}
+
+		broken := func(key string, args ...interface{}) error {
+			return &RuleError{Rule: r.Name, Message: i18n.Msg(key, args...)}
+		}
+
+		if r.MaxDaysAhead > 0 && start.After(today.AddDate(0, 0, r.MaxDaysAhead)) {
+			return broken("rules.days_ahead", r.MaxDaysAhead)
+		}
+		if r.MinNights > 0 && n < r.MinNights {
+			return broken("rules.min_nights", i18n.Count("nights", r.MinNights))
+		}
+		if r.MaxNights > 0 && n > r.MaxNights {
+			return broken("rules.max_nights", i18n.Count("nights", r.MaxNights))
+		}
+		for _, d := range r.ClosedToArrival {
+			if start.Weekday() == d {
+				return broken("rules.closed_to_arrival", weekdays(d))
+			}
+		}
+		for _, d := range r.ClosedToDeparture {
+			if end.Weekday() == d {
+				return broken("rules.closed_to_departure", weekdays(d))
+			}
+		}
+	}
+
+	return nil
+}
+
+//BufferNights returns the most buffer nights required by the rules applying to the stay in the room
+func BufferNights(rules []models.StayRule, roomID int, start time.Time) int {
+	buffer := 0
+	for _, r := range rules {
+		if r.Applies(roomID, start) && r.BufferNights > buffer {
+			buffer = r.BufferNights
+		}
+	}
+	return buffer
+}
+
+//Bookable returns a *RuleError if the stay breaks one of the rules, including by leaving fewer free nights
+//than required between it and the room's other stays and blocks. It does not check the stay's own nights.
+func Bookable(store Store, rules []models.StayRule, roomID int, start, end, today time.Time) error {
+	err := CheckRules(rules, roomID, start, end, today)
+	if err != nil {
+		return err
+	}
+
+	buffer := BufferNights(rules, roomID, start)
+	if buffer == 0 {
+		return nil
+	}
+
+	nights, err := takenNights(store, roomID, start.AddDate(0, 0, -buffer), end.AddDate(0, 0, buffer))
+	if err != nil {
+		return err
+	}
+
+	if !bufferFree(nights, start, end, buffer) {
+		return &RuleError{Message: i18n.Msg("rules.buffer", i18n.Count("nights", buffer))}
+	}
+
+	return nil
+}
+
+//CheckBlock returns a *RuleError if an owner block on the night of date would leave fewer free nights than the
+//buffer rules require between it and one of the room's stays. Blocks are not stays, so the other rules do not
+//apply to them and blocks can be next to each other.
+func CheckBlock(store Store, rules []models.StayRule, roomID int, date time.Time) error {
+	window := 0
+	for _, r := range rules {
+		if r.BufferNights > window {
+			window = r.BufferNights
+		}
+	}
+	if window == 0 {
+		return nil
+	}
+
+	restrictions, err := store.GetRestrictionsForRoomByDate(roomID, date.AddDate(0, 0, -window), date.AddDate(0, 0, window+1))
+	if err != nil {
+		return err
+	}
+
+	for _, r := range restrictions {
+		if r.ReservationID == 0 {
+			continue
+		}
+
+		buffer := BufferNights(rules, roomID, r.StartDate)
+		before := !date.Before(r.StartDate.AddDate(0, 0, -buffer)) && date.Before(r.StartDate)
+		after := !date.Before(r.EndDate) && date.Before(r.EndDate.AddDate(0, 0, buffer))
+		if before || after {
+			return &RuleError{Message: i18n.Msg("rules.buffer", i18n.Count("nights", buffer))}
+		}
+	}
+
+	return nil
+}
+
+//bufferFree returns true if none of the buffer nights before start and from end on are taken
+func bufferFree(taken map[string]bool, start, end time.Time, buffer int) bool {
+	for i := 1; i <= buffer; i++ {
+		if taken[night(start.AddDate(0, 0, -i))] || taken[night(end.AddDate(0, 0, i-1))] {
+			return false
+		}
+	}
+	return true
+}
+
+//weekdays returns the name of every d, such as Saturdays
+func weekdays(d time.Weekday) i18n.Message {
+	return i18n.Msg("weekday.plural." + strings.ToLower(d.String()))
+}
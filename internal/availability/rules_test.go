@@ -0,0 +1,153 @@
+package availability
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Rha02/bookings/internal/config"
+	"github.com/Rha02/bookings/internal/models"
+	"github.com/Rha02/bookings/internal/repository/dbrepo"
+)
+
+func TestCheckRules(t *testing.T) {
+	//the 1st and 8th of January 2050 are Saturdays
+	weekends := models.StayRule{
+		Name:              "Weekends",
+		RoomIDs:           []int{1},
+		MinNights:         2,
+		MaxNights:         7,
+		ClosedToArrival:   []time.Weekday{time.Saturday},
+		ClosedToDeparture: []time.Weekday{time.Sunday},
+	}
+	winter := models.StayRule{Name: "Winter", SeasonStart: 1215, SeasonEnd: 105, MinNights: 3}
+	window := models.StayRule{Name: "Window", MaxDaysAhead: 30}
+
+	var tests = []struct {
+		name     string
+		rule     models.StayRule
+		roomID   int
+		start    time.Time
+		end      time.Time
+		expected string
+	}{
+		{"long enough", weekends, 1, date(3), date(6), ""},
+		{"too short", weekends, 1, date(3), date(4), "The minimum stay for these dates is 2 nights"},
+		{"too long", weekends, 1, date(3), date(12), "The maximum stay for these dates is 7 nights"},
+		{"saturday arrival", weekends, 1, date(8), date(11), "Arrivals are not possible on Saturdays for these dates"},
+		{"sunday departure", weekends, 1, date(4), date(9), "Departures are not possible on Sundays for these dates"},
+		{"other room", weekends, 2, date(8), date(9), ""},
+		{"in a season across the new year", winter, 1, date(2), date(4), "The minimum stay for these dates is 3 nights"},
+		{"after the season", winter, 1, date(6), date(7), ""},
+		{"in the window", window, 1, date(31), date(32), ""},
+		{"beyond the window", window, 1, date(32), date(33), "Stays can only be booked up to 30 days ahead"},
+	}
+
+	for _, e := range tests {
+		err := CheckRules([]models.StayRule{e.rule}, e.roomID, e.start, e.end, date(1))
+
+		if e.expected == "" {
+			if err != nil {
+				t.Errorf("%s: expected the stay to be allowed, got %q", e.name, err)
+			}
+			continue
+		}
+
+		var ruleErr *RuleError
+		if !errors.As(err, &ruleErr) {
+			t.Errorf("%s: expected a RuleError, got %v", e.name, err)
+			continue
+		}
+		if ruleErr.Error() != e.expected || ruleErr.Rule != e.rule.Name {
+			t.Errorf("%s: expected %q from rule %s, got %q from rule %s", e.name, e.expected, e.rule.Name, ruleErr.Error(), ruleErr.Rule)
+		}
+	}
+}
+
+func TestBookable(t *testing.T) {
+	repo := dbrepo.NewMemoryRepo(&config.AppConfig{})
+	block(t, repo, 1, 10, 15)
+
+	rules := []models.StayRule{{Name: "Cleaning", RoomIDs: []int{1}, BufferNights: 2}}
+
+	var tests = []struct {
+		name   string
+		roomID int
+		start  int
+		end    int
+		ok     bool
+	}{
+		{"leaving two nights before", 1, 5, 8, true},
+		{"leaving one night before", 1, 5, 9, false},
+		{"arriving one night after", 1, 16, 18, false},
+		{"arriving two nights after", 1, 17, 19, true},
+		{"room without a buffer", 2, 15, 16, true},
+	}
+
+	for _, e := range tests {
+		err := Bookable(repo, rules, e.roomID, date(e.start), date(e.end), date(1))
+
+		var ruleErr *RuleError
+		if e.ok && err != nil {
+			t.Errorf("%s: expected the stay to be bookable, got %v", e.name, err)
+		}
+		if !e.ok && (!errors.As(err, &ruleErr) || ruleErr.Error() != "This room needs 2 nights free between stays") {
+			t.Errorf("%s: expected a buffer error, got %v", e.name, err)
+		}
+	}
+
+	//suggestions keep the buffer too
+	suggestions, err := Suggest(repo, rules, date(8), date(10), date(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(suggestions) != 2 {
+		t.Fatalf("expected 2 suggestions, got %+v", suggestions)
+	}
+	for _, s := range suggestions {
+		if len(s.Rooms) != 1 || s.Rooms[0].ID != 2 {
+			t.Errorf("expected only room 2 from %s to %s, got %+v", s.StartDate, s.EndDate, s.Rooms)
+		}
+	}
+}
+
+func TestCheckBlock(t *testing.T) {
+	repo := dbrepo.NewMemoryRepo(&config.AppConfig{})
+	block(t, repo, 1, 20, 22)
+
+	_, err := repo.BookReservation(models.Reservation{RoomID: 1, StartDate: date(10), EndDate: date(12)}, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rules := []models.StayRule{{Name: "Cleaning", RoomIDs: []int{1}, MinNights: 3, BufferNights: 2}}
+
+	var tests = []struct {
+		name   string
+		roomID int
+		day    int
+		ok     bool
+	}{
+		{"three nights before the stay", 1, 7, true},
+		{"two nights before the stay", 1, 8, false},
+		{"night before the stay", 1, 9, false},
+		{"departure night", 1, 12, false},
+		{"second night after the stay", 1, 13, false},
+		{"third night after the stay", 1, 14, true},
+		{"next to another block", 1, 22, true},
+		{"room without a buffer", 2, 12, true},
+	}
+
+	for _, e := range tests {
+		err := CheckBlock(repo, rules, e.roomID, date(e.day))
+
+		var ruleErr *RuleError
+		if e.ok && err != nil {
+			t.Errorf("%s: expected the block to be allowed, got %v", e.name, err)
+		}
+		if !e.ok && (!errors.As(err, &ruleErr) || ruleErr.Error() != "This room needs 2 nights free between stays") {
+			t.Errorf("%s: expected a buffer error, got %v", e.name, err)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+//Package availability finds alternative dates for stays that cannot be booked
+package availability
+
+import (
+	"time"
+
+	"github.com/Rha02/bookings/internal/models"
+)
+
+//SearchDays is how many days before and after the requested dates alternatives are looked for
+const SearchDays = 60
+
+//Store is the storage rooms and their restrictions are read from
+type Store interface {
+	AllRooms() ([]models.Room, error)
+	GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error)
+}
+
+//Suggestion is a stay of the requested length and the rooms that are free for all of it
+type Suggestion struct {
+	StartDate time.Time
+	EndDate   time.Time
+	Rooms     []models.Room
+}
+
+//Today returns the current date, as the dates of stays are stored
+func Today() time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+//Suggest returns the nearest stays as long as the one from start to end that at least one room is free for
+//and that the stay rules allow: the latest one starting before start and the earliest one starting after it,
+//in that order. Stays starting before today are not suggested, and there is no suggestion for a direction
+//in which nothing is free within SearchDays.
+func Suggest(store Store, rules []models.StayRule, start, end, today time.Time) ([]Suggestion, error) {
+	var suggestions []Suggestion
+
+	if !end.After(start) {
+		return suggestions, nil
+	}
+
+	rooms, err := store.AllRooms()
+	if err != nil {
+		return suggestions, err
+	}
+
+	//the buffer nights of stays at the edges of the search are looked up as well
+	margin := SearchDays
+	for _, r := range rules {
+		if SearchDays+r.BufferNights > margin {
+			margin = SearchDays + r.BufferNights
+		}
+	}
+
+	from := start.AddDate(0, 0, -margin)
+	to := end.AddDate(0, 0, margin)
+
+	//blocked holds the nights each room is taken, by date
+	blocked := make(map[int]map[string]bool)
+
+	for _, room := range rooms {
+		nights, err := takenNights(store, room.ID, from, to)
+		if err != nil {
+			return suggestions, err
+		}
+		blocked[room.ID] = nights
+	}
+
+	free := func(offset int) (Suggestion, bool) {
+		s := Suggestion{StartDate: start.AddDate(0, 0, offset), EndDate: end.AddDate(0, 0, offset)}
+
+		for _, room := range rooms {
+			taken := false
+			for d := s.StartDate; d.Before(s.EndDate); d = d.AddDate(0, 0, 1) {
+				if blocked[room.ID][night(d)] {
+					taken = true
+					break
+				}
+			}
+			if taken || CheckRules(rules, room.ID, s.StartDate, s.EndDate, today) != nil {
+				continue
+			}
+			if !bufferFree(blocked[room.ID], s.StartDate, s.EndDate, BufferNights(rules, room.ID, s.StartDate)) {
+				continue
+			}
+			s.Rooms = append(s.Rooms, room)
+		}
+
+		return s, len(s.Rooms) > 0
+	}
+
+	for offset := -1; offset >= -SearchDays; offset-- {
+		if start.AddDate(0, 0, offset).Before(today) {
+			break
+		}
+		if s, ok := free(offset); ok {
+			suggestions = append(suggestions, s)
+			break
+		}
+	}
+
+	for offset := 1; offset <= SearchDays; offset++ {
+		if s, ok := free(offset); ok {
+			suggestions = append(suggestions, s)
+			break
+		}
+	}
+
+	return suggestions, nil
+}
+
+//takenNights returns the nights the room has restrictions on between start and end, by date
+func takenNights(store Store, roomID int, start, end time.Time) (map[string]bool, error) {
+	restrictions, err := store.GetRestrictionsForRoomByDate(roomID, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	nights := make(map[string]bool)
+	for _, r := range restrictions {
+		for d := r.StartDate; d.Before(r.EndDate); d = d.AddDate(0, 0, 1) {
+			nights[night(d)] = true
+		}
+	}
+
+	return nights, nil
+}
+
+//night returns the date of the night starting on t
+func night(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
@@ -0,0 +1,111 @@
+package availability
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Rha02/bookings/internal/config"
+	"github.com/Rha02/bookings/internal/models"
+	"github.com/Rha02/bookings/internal/repository/dbrepo"
+)
+
+func date(day int) time.Time {
+	return time.Date(2050, 1, day, 0, 0, 0, 0, time.UTC)
+}
+
+//block takes the room from the first to the last day, which it is left on
+func block(t *testing.T, repo *dbrepo.MemoryRepo, roomID, first, last int) {
+	err := repo.InsertRoomRestriction(models.RoomRestriction{
+		StartDate: date(first), EndDate: date(last), RoomID: roomID, RestrictionID: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	type stay struct {
+		start int
+		end   int
+		rooms []int
+	}
+
+	var tests = []struct {
+		name     string
+		blocks   [][3]int
+		today    time.Time
+		expected []stay
+	}{
+		{
+			name:     "both rooms taken",
+			blocks:   [][3]int{{1, 10, 15}, {2, 10, 15}},
+			today:    date(1),
+			expected: []stay{{8, 10, []int{1, 2}}, {15, 17, []int{1, 2}}},
+		},
+		{
+			name:     "one room free sooner",
+			blocks:   [][3]int{{1, 5, 20}, {2, 10, 15}},
+			today:    date(1),
+			expected: []stay{{8, 10, []int{2}}, {15, 17, []int{2}}},
+		},
+		{
+			name:     "no stays before today",
+			blocks:   [][3]int{{1, 10, 15}, {2, 10, 15}},
+			today:    date(9),
+			expected: []stay{{15, 17, []int{1, 2}}},
+		},
+		{
+			name:     "nothing free",
+			blocks:   [][3]int{{1, 1, 31}, {2, 1, 31}, {1, 31, 31 + SearchDays}, {2, 31, 31 + SearchDays}},
+			today:    date(1),
+			expected: []stay{},
+		},
+	}
+
+	for _, e := range tests {
+		repo := dbrepo.NewMemoryRepo(&config.AppConfig{})
+		for _, b := range e.blocks {
+			block(t, repo, b[0], b[1], b[2])
+		}
+
+		suggestions, err := Suggest(repo, nil, date(12), date(14), e.today)
+		if err != nil {
+			t.Fatalf("%s: %s", e.name, err)
+		}
+
+		if len(suggestions) != len(e.expected) {
+			t.Errorf("%s: expected %d suggestions, got %+v", e.name, len(e.expected), suggestions)
+			continue
+		}
+
+		for i, s := range suggestions {
+			want := e.expected[i]
+
+			var rooms []int
+			for _, room := range s.Rooms {
+				rooms = append(rooms, room.ID)
+			}
+
+			if !s.StartDate.Equal(date(want.start)) || !s.EndDate.Equal(date(want.end)) || len(rooms) != len(want.rooms) {
+				t.Errorf("%s: expected %d to %d in rooms %v, got %s to %s in rooms %v",
+					e.name, want.start, want.end, want.rooms, s.StartDate, s.EndDate, rooms)
+			}
+		}
+	}
+}
+
+func TestSuggest_Errors(t *testing.T) {
+	repo := dbrepo.NewMemoryRepo(&config.AppConfig{})
+
+	if suggestions, err := Suggest(repo, nil, date(14), date(12), date(1)); err != nil || len(suggestions) != 0 {
+		t.Errorf("expected no suggestions for a stay ending before it starts, got %+v (err %v)", suggestions, err)
+	}
+
+	fault := errors.New("connection refused")
+	repo.Fail("GetRestrictionsForRoomByDate", fault)
+
+	if _, err := Suggest(repo, nil, date(12), date(14), date(1)); err != fault {
+		t.Errorf("expected the repository error, got %v", err)
+	}
+}
@@ -2,19 +2,21 @@ package config
 
 import (
 	"html/template"
-	"log"
 
 	"github.com/Rha02/bookings/internal/models"
 	"github.com/alexedwards/scs/v2"
+	"github.com/rs/zerolog"
 )
 
 //AppConfig holds the application config
 type AppConfig struct {
 	UseCache      bool
 	TemplateCache map[string]*template.Template
-	InfoLog       *log.Logger
-	ErrorLog      *log.Logger
+	Logger        zerolog.Logger
 	InProduction  bool
 	Session       *scs.SessionManager
-	MailChan      chan models.MailData
+
+	MailTemplateCache map[string]*models.MailTemplate
+	Property          models.Property
+	StayRules         []models.StayRule
 }
@@ -0,0 +1,649 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/Rha02/bookings/internal/models"
+	"gopkg.in/yaml.v3"
+)
+
+//Settings holds everything read at startup. Values are merged from, in increasing order of precedence:
+//the defaults, the config file, the database file, environment variables and command line flags.
+type Settings struct {
+	Env             string        `yaml:"env" toml:"env"`
+	Addr            string        `yaml:"addr" toml:"addr"`
+	InProduction    bool          `yaml:"production" toml:"production"`
+	UseCache        bool          `yaml:"cache" toml:"cache"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	DatabaseFile    string        `yaml:"database_file" toml:"database_file"`
+	LogLevel        string        `yaml:"log_level" toml:"log_level"`
+	LogFormat       string        `yaml:"log_format" toml:"log_format"`
+
+	//AvailabilityCacheTTL is how long availability lookups are cached; 0, the default, turns the cache off.
+	//Only changes made by this process are seen before the results expire.
+	AvailabilityCacheTTL time.Duration `yaml:"availability_cache_ttl" toml:"availability_cache_ttl"`
+
+	Session  SessionSettings  `yaml:"session" toml:"session"`
+	Database DatabaseSettings `yaml:"database" toml:"database"`
+	Mail     MailSettings     `yaml:"mail" toml:"mail"`
+	Property PropertySettings `yaml:"property" toml:"property"`
+
+	StayRules []StayRuleSettings `yaml:"stay_rules" toml:"stay_rules"`
+}
+
+//SessionSettings holds the session manager settings
+type SessionSettings struct {
+	Lifetime        time.Duration `yaml:"lifetime" toml:"lifetime"`
+	Store           string        `yaml:"store" toml:"store"`
+	CleanupInterval time.Duration `yaml:"cleanup_interval" toml:"cleanup_interval"`
+}
+
+//DatabaseSettings holds the database connection settings.
+//The keys match an entry of a soda database.yml file.
+type DatabaseSettings struct {
+	Dialect     string            `yaml:"dialect" toml:"dialect"`
+	URL         string            `yaml:"url" toml:"url"`
+	Host        string            `yaml:"host" toml:"host"`
+	Port        int               `yaml:"port" toml:"port"`
+	Name        string            `yaml:"database" toml:"database"`
+	User        string            `yaml:"user" toml:"user"`
+	Password    string            `yaml:"password" toml:"password"`
+	SSLMode     string            `yaml:"sslmode" toml:"sslmode"`
+	Pool        int               `yaml:"pool" toml:"pool"`
+	IdlePool    int               `yaml:"idle_pool" toml:"idle_pool"`
+	MaxLifetime time.Duration     `yaml:"max_lifetime" toml:"max_lifetime"`
+	Options     map[string]string `yaml:"options" toml:"options"`
+}
+
+//MailSettings holds the settings of the mail transport
+type MailSettings struct {
+	Transport string `yaml:"transport" toml:"transport"`
+	Host      string `yaml:"host" toml:"host"`
+	Port      int    `yaml:"port" toml:"port"`
+	Username  string `yaml:"username" toml:"username"`
+	Password  string `yaml:"password" toml:"password"`
+	StartTLS  bool   `yaml:"starttls" toml:"starttls"`
+	Sendmail  string `yaml:"sendmail" toml:"sendmail"`
+	Dir       string `yaml:"dir" toml:"dir"`
+}
+
+//PropertySettings holds the details of the bed and breakfast shown in emails
+type PropertySettings struct {
+	Name    string `yaml:"name" toml:"name"`
+	Email   string `yaml:"email" toml:"email"`
+	Phone   string `yaml:"phone" toml:"phone"`
+	Address string `yaml:"address" toml:"address"`
+}
+
+//Model returns the property details as used by the email templates
+func (p PropertySettings) Model() models.Property {
+	return models.Property{
+		Name:    p.Name,
+		Email:   p.Email,
+		Phone:   p.Phone,
+		Address: p.Address,
+	}
+}
+
+//StayRuleSettings holds a stay rule as written in the config file. From and To are the first and last
+//arrival days of the rule's season as mm-dd, and weekdays are English day names such as saturday.
+type StayRuleSettings struct {
+	Name              string   `yaml:"name" toml:"name"`
+	Rooms             []int    `yaml:"rooms" toml:"rooms"`
+	From              string   `yaml:"from" toml:"from"`
+	To                string   `yaml:"to" toml:"to"`
+	MinNights         int      `yaml:"min_nights" toml:"min_nights"`
+	MaxNights         int      `yaml:"max_nights" toml:"max_nights"`
+	ClosedToArrival   []string `yaml:"closed_to_arrival" toml:"closed_to_arrival"`
+	ClosedToDeparture []string `yaml:"closed_to_departure" toml:"closed_to_departure"`
+	MaxDaysAhead      int      `yaml:"max_days_ahead" toml:"max_days_ahead"`
+	BufferNights      int      `yaml:"buffer_nights" toml:"buffer_nights"`
+}
+
+//Model returns the rule as checked when stays are searched for and booked
+func (r StayRuleSettings) Model() (models.StayRule, error) {
+	rule := models.StayRule{
+		Name:         r.Name,
+		RoomIDs:      r.Rooms,
+		MinNights:    r.MinNights,
+		MaxNights:    r.MaxNights,
+		MaxDaysAhead: r.MaxDaysAhead,
+		BufferNights: r.BufferNights,
+	}
+
+	if (r.From == "") != (r.To == "") {
+		return rule, errors.New("from and to must be set together")
+	}
+	if r.From != "" {
+		var err error
+		if rule.SeasonStart, err = parseMonthDay(r.From); err != nil {
+			return rule, err
+		}
+		if rule.SeasonEnd, err = parseMonthDay(r.To); err != nil {
+			return rule, err
+		}
+	}
+
+	if r.MinNights < 0 || r.MaxNights < 0 || r.MaxDaysAhead < 0 || r.BufferNights < 0 {
+		return rule, errors.New("min_nights, max_nights, max_days_ahead and buffer_nights must not be negative")
+	}
+	if r.MaxNights > 0 && r.MinNights > r.MaxNights {
+		return rule, errors.New("min_nights must not be more than max_nights")
+	}
+
+	for _, name := range r.ClosedToArrival {
+		d, err := parseWeekday(name)
+		if err != nil {
+			return rule, err
+		}
+		rule.ClosedToArrival = append(rule.ClosedToArrival, d)
+	}
+	for _, name := range r.ClosedToDeparture {
+		d, err := parseWeekday(name)
+		if err != nil {
+			return rule, err
+		}
+		rule.ClosedToDeparture = append(rule.ClosedToDeparture, d)
+	}
+
+	return rule, nil
+}
+
+func parseMonthDay(s string) (models.MonthDay, error) {
+	//a leap year, so that 02-29 is accepted
+	t, err := time.Parse("2006-01-02", "2000-"+s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a mm-dd date", s)
+	}
+	return models.MonthDayOf(t), nil
+}
+
+func parseWeekday(s string) (time.Weekday, error) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(s, d.String()) || strings.EqualFold(s, d.String()[:3]) {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("%q is not a day of the week", s)
+}
+
+//StayRuleModels returns the stay rules as checked when stays are searched for and booked.
+//Rules that do not validate are left out.
+func (s Settings) StayRuleModels() []models.StayRule {
+	var rules []models.StayRule
+	for _, r := range s.StayRules {
+		if rule, err := r.Model(); err == nil {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+//DefaultSettings returns the settings used when nothing else is configured
+func DefaultSettings() Settings {
+	return Settings{
+		Env:             "development",
+		Addr:            ":8080",
+		UseCache:        true,
+		ShutdownTimeout: 30 * time.Second,
+		LogLevel:        "info",
+
+		Session: SessionSettings{
+			Lifetime:        24 * time.Hour,
+			Store:           "postgres",
+			CleanupInterval: 5 * time.Minute,
+		},
+		Database: DatabaseSettings{
+			Dialect:     "postgres",
+			Host:        "localhost",
+			Port:        5432,
+			SSLMode:     "disable",
+			Pool:        10,
+			IdlePool:    5,
+			MaxLifetime: 5 * time.Minute,
+		},
+		Mail: MailSettings{
+			Transport: "smtp",
+			Host:      "localhost",
+			Port:      1025,
+			Sendmail:  "/usr/sbin/sendmail",
+			Dir:       "./tmp/mail",
+		},
+		Property: PropertySettings{
+			Name:  "Fort Dagon Bed and Breakfast",
+			Email: "server@bookings.loc",
+		},
+	}
+}
+
+//binding ties a setting to its command line flag and environment variable
+type binding struct {
+	flag  string
+	env   string
+	usage string
+	value interface{}
+}
+
+func (s *Settings) bindings() []binding {
+	return []binding{
+		{"env", "BOOKINGS_ENV", "Environment to read from the database file", &s.Env},
+		{"addr", "BOOKINGS_ADDR", "Address to listen on", &s.Addr},
+		{"production", "BOOKINGS_PRODUCTION", "Application is in production", &s.InProduction},
+		{"cache", "BOOKINGS_CACHE", "Use template cache", &s.UseCache},
+		{"shutdown-timeout", "BOOKINGS_SHUTDOWN_TIMEOUT", "How long to wait for active requests when shutting down", &s.ShutdownTimeout},
+		{"dbconfig", "BOOKINGS_DATABASE_FILE", "Database file in the soda database.yml layout", &s.DatabaseFile},
+		{"log-level", "BOOKINGS_LOG_LEVEL", "Lowest level logged (debug, info, warn, error)", &s.LogLevel},
+		{"log-format", "BOOKINGS_LOG_FORMAT", "Log format (json, console); defaults to json in production and console otherwise", &s.LogFormat},
+		{"availability-cache-ttl", "BOOKINGS_AVAILABILITY_CACHE_TTL", "How long availability lookups are cached; 0 turns the cache off", &s.AvailabilityCacheTTL},
+
+		{"session-lifetime", "BOOKINGS_SESSION_LIFETIME", "How long a session lasts", &s.Session.Lifetime},
+		{"session-store", "BOOKINGS_SESSION_STORE", "Where sessions are kept (postgres, memory)", &s.Session.Store},
+		{"session-cleanup", "BOOKINGS_SESSION_CLEANUP", "How often expired sessions are removed from the postgres store", &s.Session.CleanupInterval},
+
+		{"dbdialect", "BOOKINGS_DB_DIALECT", "Database dialect", &s.Database.Dialect},
+		{"dburl", "DATABASE_URL", "Database URL, used instead of the other database settings", &s.Database.URL},
+		{"dbhost", "BOOKINGS_DB_HOST", "Database host", &s.Database.Host},
+		{"dbport", "BOOKINGS_DB_PORT", "Database port", &s.Database.Port},
+		{"dbname", "BOOKINGS_DB_NAME", "Database name", &s.Database.Name},
+		{"dbuser", "BOOKINGS_DB_USER", "Database user", &s.Database.User},
+		{"dbpass", "BOOKINGS_DB_PASSWORD", "Database password", &s.Database.Password},
+		{"dbssl", "BOOKINGS_DB_SSLMODE", "Database SSL settings (disable, prefer, require)", &s.Database.SSLMode},
+		{"dbpool", "BOOKINGS_DB_POOL", "Maximum number of open database connections", &s.Database.Pool},
+		{"dbidlepool", "BOOKINGS_DB_IDLE_POOL", "Maximum number of idle database connections", &s.Database.IdlePool},
+		{"dblifetime", "BOOKINGS_DB_MAX_LIFETIME", "Maximum lifetime of a database connection", &s.Database.MaxLifetime},
+
+		{"mailer", "BOOKINGS_MAIL_TRANSPORT", "Mail transport (smtp, sendmail, file, maildir)", &s.Mail.Transport},
+		{"smtphost", "BOOKINGS_SMTP_HOST", "SMTP host", &s.Mail.Host},
+		{"smtpport", "BOOKINGS_SMTP_PORT", "SMTP port", &s.Mail.Port},
+		{"smtpuser", "BOOKINGS_SMTP_USER", "SMTP username", &s.Mail.Username},
+		{"smtppass", "BOOKINGS_SMTP_PASSWORD", "SMTP password", &s.Mail.Password},
+		{"smtpstarttls", "BOOKINGS_SMTP_STARTTLS", "Use STARTTLS when connecting to the SMTP server", &s.Mail.StartTLS},
+		{"sendmail", "BOOKINGS_SENDMAIL", "Path to the sendmail binary", &s.Mail.Sendmail},
+		{"maildir", "BOOKINGS_MAIL_DIR", "Directory the file and maildir transports write to", &s.Mail.Dir},
+
+		{"property-name", "BOOKINGS_PROPERTY_NAME", "Name of the property shown in emails", &s.Property.Name},
+		{"property-email", "BOOKINGS_PROPERTY_EMAIL", "Email address emails are sent from", &s.Property.Email},
+		{"property-phone", "BOOKINGS_PROPERTY_PHONE", "Phone number shown in emails", &s.Property.Phone},
+		{"property-address", "BOOKINGS_PROPERTY_ADDRESS", "Address shown in emails", &s.Property.Address},
+	}
+}
+
+//Load registers the settings flags on fs, parses args and returns the merged and validated settings.
+//The config file is named by the -config flag or the BOOKINGS_CONFIG environment variable.
+func Load(fs *flag.FlagSet, args []string) (Settings, error) {
+	s := DefaultSettings()
+
+	configFile := fs.String("config", "", "Config file (.yml, .yaml or .toml)")
+	bindings := s.bindings()
+	for _, b := range bindings {
+		switch v := b.value.(type) {
+		case *bool:
+			fs.Bool(b.flag, *v, b.usage)
+		case *int:
+			fs.Int(b.flag, *v, b.usage)
+		case *time.Duration:
+			fs.Duration(b.flag, *v, b.usage)
+		case *string:
+			fs.String(b.flag, *v, b.usage)
+		}
+	}
+
+	err := fs.Parse(args)
+	if err != nil {
+		return s, err
+	}
+
+	path := *configFile
+	if path == "" {
+		path = os.Getenv("BOOKINGS_CONFIG")
+	}
+
+	if path != "" {
+		err = decodeFile(path, &s)
+		if err != nil {
+			return s, err
+		}
+	}
+
+	//the environment and flags may choose the database file, so apply them before reading it and again after
+	err = s.applyOverrides(fs)
+	if err != nil {
+		return s, err
+	}
+
+	if s.DatabaseFile != "" {
+		s.Database, err = readDatabaseFile(s.DatabaseFile, s.Env, s.Database)
+		if err != nil {
+			return s, err
+		}
+
+		err = s.applyOverrides(fs)
+		if err != nil {
+			return s, err
+		}
+	}
+
+	return s, s.Validate()
+}
+
+//applyOverrides sets every setting that has an environment variable or an explicitly set flag, flags winning
+func (s *Settings) applyOverrides(fs *flag.FlagSet) error {
+	bindings := s.bindings()
+
+	for _, b := range bindings {
+		if v, ok := os.LookupEnv(b.env); ok {
+			err := setValue(b.value, v)
+			if err != nil {
+				return fmt.Errorf("config: invalid %s: %w", b.env, err)
+			}
+		}
+	}
+
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		for _, b := range bindings {
+			if b.flag == f.Name && err == nil {
+				err = setValue(b.value, f.Value.String())
+			}
+		}
+	})
+
+	return err
+}
+
+func setValue(dst interface{}, v string) error {
+	switch d := dst.(type) {
+	case *bool:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		*d = b
+	case *int:
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		*d = i
+	case *time.Duration:
+		t, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*d = t
+	case *string:
+		*d = v
+	}
+	return nil
+}
+
+//fileFunctions are available in config files, as in soda's database.yml
+var fileFunctions = template.FuncMap{
+	"env": os.Getenv,
+	"envOr": func(key, def string) string {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			return v
+		}
+		return def
+	},
+}
+
+//decodeFile expands the template placeholders in the file at path and decodes it into v by its extension
+func decodeFile(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	t, err := template.New(filepath.Base(path)).Funcs(fileFunctions).Parse(string(data))
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	var buf bytes.Buffer
+	err = t.Execute(&buf, nil)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		err = yaml.Unmarshal(buf.Bytes(), v)
+	case ".toml":
+		_, err = toml.Decode(buf.String(), v)
+	default:
+		return fmt.Errorf("config: %s: unknown file type, use .yml, .yaml or .toml", path)
+	}
+
+	if err != nil {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+
+	return nil
+}
+
+//readDatabaseFile reads the entry for env from a file in the soda database.yml layout,
+//on top of the database settings given
+func readDatabaseFile(path, env string, db DatabaseSettings) (DatabaseSettings, error) {
+	var entries map[string]DatabaseSettings
+
+	err := decodeFile(path, &entries)
+	if err != nil {
+		return db, err
+	}
+
+	entry, ok := entries[env]
+	if !ok {
+		return db, fmt.Errorf("config: %s has no %q entry", path, env)
+	}
+
+	return mergeDatabase(db, entry), nil
+}
+
+//mergeDatabase returns db with every non-zero setting of entry applied
+func mergeDatabase(db, entry DatabaseSettings) DatabaseSettings {
+	if entry.Dialect != "" {
+		db.Dialect = entry.Dialect
+	}
+	if entry.URL != "" {
+		db.URL = entry.URL
+	}
+	if entry.Host != "" {
+		db.Host = entry.Host
+	}
+	if entry.Port != 0 {
+		db.Port = entry.Port
+	}
+	if entry.Name != "" {
+		db.Name = entry.Name
+	}
+	if entry.User != "" {
+		db.User = entry.User
+	}
+	if entry.Password != "" {
+		db.Password = entry.Password
+	}
+	if entry.SSLMode != "" {
+		db.SSLMode = entry.SSLMode
+	}
+	if entry.Pool != 0 {
+		db.Pool = entry.Pool
+	}
+	if entry.IdlePool != 0 {
+		db.IdlePool = entry.IdlePool
+	}
+	if entry.MaxLifetime != 0 {
+		db.MaxLifetime = entry.MaxLifetime
+	}
+	if entry.Options != nil {
+		db.Options = entry.Options
+		if mode, ok := entry.Options["sslmode"]; ok {
+			db.SSLMode = mode
+		}
+	}
+	return db
+}
+
+//DSN returns the connection string for the database
+func (d DatabaseSettings) DSN() string {
+	if d.URL != "" {
+		return d.URL
+	}
+
+	dsn := fmt.Sprintf("host=%s port=%d dbname=%s user=%s password=%s sslmode=%s",
+		d.Host, d.Port, d.Name, d.User, d.Password, d.SSLMode)
+
+	var keys []string
+	for k := range d.Options {
+		if k != "sslmode" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		dsn += fmt.Sprintf(" %s=%s", k, d.Options[k])
+	}
+
+	return dsn
+}
+
+//ValidationError lists every problem found in the settings
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e, "\n  - ")
+}
+
+//LogFormatOrDefault returns the log format, JSON in production and console otherwise when none is set
+func (s Settings) LogFormatOrDefault() string {
+	if s.LogFormat != "" {
+		return s.LogFormat
+	}
+	if s.InProduction {
+		return "json"
+	}
+	return "console"
+}
+
+//Validate checks that the settings are complete and consistent
+func (s Settings) Validate() error {
+	var errs ValidationError
+
+	if _, _, err := net.SplitHostPort(s.Addr); err != nil {
+		errs = append(errs, fmt.Sprintf("addr %q must be host:port or :port", s.Addr))
+	}
+
+	switch s.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Sprintf("log_level %q is not one of debug, info, warn, error", s.LogLevel))
+	}
+	switch s.LogFormat {
+	case "", "json", "console":
+	default:
+		errs = append(errs, fmt.Sprintf("log_format %q is not one of json, console", s.LogFormat))
+	}
+
+	if s.ShutdownTimeout <= 0 {
+		errs = append(errs, "shutdown_timeout must be positive")
+	}
+
+	if s.AvailabilityCacheTTL < 0 {
+		errs = append(errs, "availability_cache_ttl must not be negative")
+	}
+
+	if s.Session.Lifetime <= 0 {
+		errs = append(errs, "session lifetime must be positive")
+	}
+	switch s.Session.Store {
+	case "postgres":
+		if s.Session.CleanupInterval <= 0 {
+			errs = append(errs, "session cleanup_interval must be positive")
+		}
+	case "memory":
+	default:
+		errs = append(errs, fmt.Sprintf("session store %q is not one of postgres, memory", s.Session.Store))
+	}
+
+	db := s.Database
+	switch db.Dialect {
+	case "postgres", "postgresql":
+	case "sqlite3", "sqlite":
+		if !strings.HasPrefix(db.URL, "sqlite3://") && !strings.HasPrefix(db.URL, "sqlite://") {
+			errs = append(errs, "a sqlite3 database needs a url such as sqlite3://bookings.db")
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("database dialect %q is not supported", db.Dialect))
+	}
+	if db.URL == "" {
+		if db.Name == "" {
+			errs = append(errs, "database name is required (dbname, BOOKINGS_DB_NAME or database.database)")
+		}
+		if db.User == "" {
+			errs = append(errs, "database user is required (dbuser, BOOKINGS_DB_USER or database.user)")
+		}
+		if db.Port < 1 || db.Port > 65535 {
+			errs = append(errs, fmt.Sprintf("database port %d is out of range", db.Port))
+		}
+	}
+	if db.Pool < 1 {
+		errs = append(errs, "database pool must be at least 1")
+	}
+	if db.IdlePool < 0 || db.IdlePool > db.Pool {
+		errs = append(errs, "database idle_pool must be between 0 and pool")
+	}
+
+	switch s.Mail.Transport {
+	case "smtp":
+		if s.Mail.Host == "" {
+			errs = append(errs, "mail host is required for the smtp transport")
+		}
+		if s.Mail.Port < 1 || s.Mail.Port > 65535 {
+			errs = append(errs, fmt.Sprintf("mail port %d is out of range", s.Mail.Port))
+		}
+	case "sendmail":
+		if s.Mail.Sendmail == "" {
+			errs = append(errs, "sendmail path is required for the sendmail transport")
+		}
+	case "file", "maildir":
+		if s.Mail.Dir == "" {
+			errs = append(errs, fmt.Sprintf("mail dir is required for the %s transport", s.Mail.Transport))
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("mail transport %q is not one of smtp, sendmail, file, maildir", s.Mail.Transport))
+	}
+
+	if !strings.Contains(s.Property.Email, "@") {
+		errs = append(errs, fmt.Sprintf("property email %q is not an email address", s.Property.Email))
+	}
+
+	for i, r := range s.StayRules {
+		if _, err := r.Model(); err != nil {
+			name := r.Name
+			if name == "" {
+				name = fmt.Sprintf("#%d", i+1)
+			}
+			errs = append(errs, fmt.Sprintf("stay rule %s: %s", name, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
@@ -0,0 +1,260 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name, data string) string {
+	path := filepath.Join(t.TempDir(), name)
+	err := ioutil.WriteFile(path, []byte(data), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := writeFile(t, "bookings.yml", `
+addr: ":9000"
+production: true
+session:
+  lifetime: 12h
+database:
+  host: db.internal
+  database: bookings
+  user: bookings
+  port: 5433
+mail:
+  transport: file
+  dir: /var/mail/bookings
+`)
+
+	os.Setenv("BOOKINGS_DB_HOST", "env.internal")
+	os.Setenv("BOOKINGS_ADDR", ":9100")
+	defer os.Unsetenv("BOOKINGS_DB_HOST")
+	defer os.Unsetenv("BOOKINGS_ADDR")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	s, err := Load(fs, []string{"-config", path, "-addr", ":9200"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Addr != ":9200" {
+		t.Errorf("expected the flag to win, got addr %s", s.Addr)
+	}
+
+	if s.Database.Host != "env.internal" {
+		t.Errorf("expected the environment to win over the file, got host %s", s.Database.Host)
+	}
+
+	if s.Database.Port != 5433 || !s.InProduction || s.Session.Lifetime != 12*time.Hour || s.Mail.Transport != "file" {
+		t.Errorf("settings were not read from the file: %+v", s)
+	}
+
+	if s.Database.SSLMode != "disable" || s.ShutdownTimeout != 30*time.Second {
+		t.Errorf("defaults were not kept: %+v", s)
+	}
+
+	//other processes' bookings would go unseen while cached, so the cache is opt-in
+	if s.AvailabilityCacheTTL != 0 {
+		t.Errorf("expected the availability cache to be off by default, got a ttl of %s", s.AvailabilityCacheTTL)
+	}
+}
+
+func TestLoad_TOML(t *testing.T) {
+	path := writeFile(t, "bookings.toml", `
+shutdown_timeout = "10s"
+
+[database]
+database = "bookings"
+user = "bookings"
+pool = 20
+`)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	s, err := Load(fs, []string{"-config", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.ShutdownTimeout != 10*time.Second || s.Database.Pool != 20 || s.Database.Name != "bookings" {
+		t.Errorf("settings were not read from the TOML file: %+v", s)
+	}
+}
+
+func TestLoad_DatabaseFile(t *testing.T) {
+	data, err := ioutil.ReadFile("./../../database.yml.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writeFile(t, "database.yml", string(data))
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	s, err := Load(fs, []string{"-dbconfig", path, "-dbuser", "postgres"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Database.Name != "bookings" || s.Database.Host != "127.0.0.1" || s.Database.Pool != 5 || s.Database.User != "postgres" {
+		t.Errorf("development entry was not read: %+v", s.Database)
+	}
+
+	os.Setenv("TEST_DATABASE_URL", "postgres://u:p@db/bookings_test")
+	defer os.Unsetenv("TEST_DATABASE_URL")
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	s, err = Load(fs, []string{"-dbconfig", path, "-env", "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Database.DSN() != "postgres://u:p@db/bookings_test" {
+		t.Errorf("expected the url from the environment, got %s", s.Database.DSN())
+	}
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	_, err = Load(fs, []string{"-dbconfig", path, "-env", "staging"})
+	if err == nil || !strings.Contains(err.Error(), `no "staging" entry`) {
+		t.Errorf("expected an error for a missing entry, got %v", err)
+	}
+}
+
+func TestLoad_Validation(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	_, err := Load(fs, []string{"-addr", "8080", "-mailer", "pigeon", "-dbpool", "0", "-session-store", "cookie", "-availability-cache-ttl", "-1s"})
+
+	verr, ok := err.(ValidationError)
+	if !ok {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+
+	for _, want := range []string{"addr", "database name", "database user", "pool", "mail transport", "session store", "availability_cache_ttl"} {
+		found := false
+		for _, msg := range verr {
+			if strings.Contains(msg, want) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected an error about %s in %s", want, verr)
+		}
+	}
+}
+
+func TestLoad_StayRules(t *testing.T) {
+	path := writeFile(t, "bookings.yml", `
+database:
+  database: bookings
+  user: bookings
+stay_rules:
+  - name: Everywhere
+    max_days_ahead: 365
+    buffer_nights: 1
+  - name: Winter weekends
+    rooms: [1, 2]
+    from: "12-15"
+    to: "01-15"
+    min_nights: 2
+    closed_to_arrival: [saturday, Sun]
+`)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	s, err := Load(fs, []string{"-config", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rules := s.StayRuleModels()
+	if len(rules) != 2 {
+		t.Fatalf("expected 2 stay rules, got %+v", rules)
+	}
+
+	winter := rules[1]
+	if winter.SeasonStart != 1215 || winter.SeasonEnd != 115 || winter.MinNights != 2 || len(winter.RoomIDs) != 2 {
+		t.Errorf("stay rule was not read from the file: %+v", winter)
+	}
+	if len(winter.ClosedToArrival) != 2 || winter.ClosedToArrival[0] != time.Saturday || winter.ClosedToArrival[1] != time.Sunday {
+		t.Errorf("expected arrivals to be closed on Saturday and Sunday, got %v", winter.ClosedToArrival)
+	}
+	if rules[0].MaxDaysAhead != 365 || rules[0].BufferNights != 1 {
+		t.Errorf("stay rule was not read from the file: %+v", rules[0])
+	}
+
+	path = writeFile(t, "bookings.yml", `
+database:
+  database: bookings
+  user: bookings
+stay_rules:
+  - name: Summer
+    from: "06-31"
+    to: "08-31"
+  - min_nights: 5
+    max_nights: 3
+  - closed_to_departure: [someday]
+  - from: "06-01"
+`)
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	_, err = Load(fs, []string{"-config", path})
+
+	verr, ok := err.(ValidationError)
+	if !ok {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+
+	for _, want := range []string{"stay rule Summer", "stay rule #2: min_nights", "stay rule #3", "stay rule #4: from and to"} {
+		found := false
+		for _, msg := range verr {
+			if strings.Contains(msg, want) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected an error about %s in %s", want, verr)
+		}
+	}
+}
+
+func TestLoad_SQLite(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	_, err := Load(fs, []string{"-dbdialect", "sqlite3", "-dburl", "sqlite3://bookings.db"})
+	if err != nil {
+		t.Errorf("expected a sqlite3 url to be valid, got %v", err)
+	}
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	_, err = Load(fs, []string{"-dbdialect", "sqlite3", "-dburl", "postgres://localhost/bookings"})
+	if err == nil || !strings.Contains(err.Error(), "sqlite3://") {
+		t.Errorf("expected an error about the sqlite3 url, got %v", err)
+	}
+}
+
+func TestLoad_InvalidEnvironment(t *testing.T) {
+	os.Setenv("BOOKINGS_DB_PORT", "five")
+	defer os.Unsetenv("BOOKINGS_DB_PORT")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	_, err := Load(fs, []string{"-dbname", "bookings", "-dbuser", "bookings"})
+	if err == nil || !strings.Contains(err.Error(), "BOOKINGS_DB_PORT") {
+		t.Errorf("expected an error naming BOOKINGS_DB_PORT, got %v", err)
+	}
+}
+
+func TestDatabaseSettings_DSN(t *testing.T) {
+	d := DefaultSettings().Database
+	d.Name = "bookings"
+	d.User = "bookings"
+	d.Options = map[string]string{"sslmode": "require", "connect_timeout": "5", "application_name": "bookings"}
+
+	expected := "host=localhost port=5432 dbname=bookings user=bookings password= sslmode=disable application_name=bookings connect_timeout=5"
+	if d.DSN() != expected {
+		t.Errorf("expected %s, got %s", expected, d.DSN())
+	}
+}
@@ -2,6 +2,7 @@ package driver
 
 import (
 	"database/sql"
+	"strings"
 	"time"
 
 	_ "github.com/jackc/pgconn"
@@ -9,9 +10,15 @@ import (
 	_ "github.com/jackc/pgx/v4/stdlib"
 )
 
+const (
+	DialectPostgres = "postgres"
+	DialectSQLite   = "sqlite3"
+)
+
 //DB holds the database connection pool
 type DB struct {
-	SQL *sql.DB
+	SQL     *sql.DB
+	Dialect string
 }
 
 var dbConn = &DB{}
@@ -20,17 +27,47 @@ const maxOpenDbConn = 10
 const maxIdleDbConn = 5
 const maxDbLifetime = 5 * time.Minute
 
+//Pool holds the connection pool limits
+type Pool struct {
+	MaxOpen     int
+	MaxIdle     int
+	MaxLifetime time.Duration
+}
+
+//DefaultPool is the pool used by ConnectSQL
+var DefaultPool = Pool{
+	MaxOpen:     maxOpenDbConn,
+	MaxIdle:     maxIdleDbConn,
+	MaxLifetime: maxDbLifetime,
+}
+
 func ConnectSQL(dsn string) (*DB, error) {
+	return ConnectSQLWithPool(dsn, DefaultPool)
+}
+
+//ConnectSQLWithPool connects to the database and sizes the connection pool.
+//A sqlite:// or sqlite3:// DSN opens a SQLite file; anything else is handed to Postgres.
+func ConnectSQLWithPool(dsn string, pool Pool) (*DB, error) {
 	d, err := NewDatabase(dsn)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+
+	dialect, _, _ := ParseDSN(dsn)
+
+	if dialect == DialectSQLite {
+		//SQLite allows one writer at a time, and every connection to :memory: is a separate database
+		pool.MaxOpen = 1
+		pool.MaxIdle = 1
+		pool.MaxLifetime = 0
 	}
 
-	d.SetMaxOpenConns(maxOpenDbConn)
-	d.SetMaxIdleConns(maxIdleDbConn)
-	d.SetConnMaxLifetime(maxDbLifetime)
+	d.SetMaxOpenConns(pool.MaxOpen)
+	d.SetMaxIdleConns(pool.MaxIdle)
+	d.SetConnMaxLifetime(pool.MaxLifetime)
 
 	dbConn.SQL = d
+	dbConn.Dialect = dialect
 
 	err = testDB(d)
 	if err != nil {
@@ -40,8 +77,38 @@ func ConnectSQL(dsn string) (*DB, error) {
 	return dbConn, nil
 }
 
+//sqliteParams are added to SQLite DSNs that do not set them
+var sqliteParams = []string{"_foreign_keys=on", "_busy_timeout=5000", "_journal_mode=WAL"}
+
+//ParseDSN returns the dialect of dsn, and the driver name and data source to open it with
+func ParseDSN(dsn string) (dialect, driverName, source string) {
+	for _, scheme := range []string{"sqlite3://", "sqlite://"} {
+		if strings.HasPrefix(dsn, scheme) {
+			source = "file:" + strings.TrimPrefix(dsn, scheme)
+
+			for _, param := range sqliteParams {
+				key := param[:strings.Index(param, "=")+1]
+				if strings.Contains(source, key) {
+					continue
+				}
+				if strings.Contains(source, "?") {
+					source += "&" + param
+				} else {
+					source += "?" + param
+				}
+			}
+
+			return DialectSQLite, sqliteDriverName, source
+		}
+	}
+
+	return DialectPostgres, "pgx", dsn
+}
+
 func NewDatabase(dsn string) (*sql.DB, error) {
-	db, err := sql.Open("pgx", dsn)
+	_, driverName, source := ParseDSN(dsn)
+
+	db, err := sql.Open(driverName, source)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,42 @@
+package driver
+
+import "testing"
+
+func TestRebind(t *testing.T) {
+	var tests = []struct {
+		query    string
+		expected string
+	}{
+		{"select 1", "select 1"},
+		{"select * from rooms where id = $1", "select * from rooms where id = ?1"},
+		{"update t set a = $2 where b = $1 and c = $10", "update t set a = ?2 where b = ?1 and c = ?10"},
+		{"select '$1', \"$2\" from t where a = $3", "select '$1', \"$2\" from t where a = ?3"},
+		{"select 'it''s $1' where a = $1", "select 'it''s $1' where a = ?1"},
+	}
+
+	for _, e := range tests {
+		if q := rebind(e.query); q != e.expected {
+			t.Errorf("rebind(%q): expected %q, got %q", e.query, e.expected, q)
+		}
+	}
+}
+
+func TestParseDSN(t *testing.T) {
+	var tests = []struct {
+		dsn     string
+		dialect string
+		source  string
+	}{
+		{"host=localhost dbname=bookings", DialectPostgres, "host=localhost dbname=bookings"},
+		{"postgres://user@localhost/bookings", DialectPostgres, "postgres://user@localhost/bookings"},
+		{"sqlite3://bookings.db", DialectSQLite, "file:bookings.db?_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL"},
+		{"sqlite://:memory:?_busy_timeout=100", DialectSQLite, "file::memory:?_busy_timeout=100&_foreign_keys=on&_journal_mode=WAL"},
+	}
+
+	for _, e := range tests {
+		dialect, _, source := ParseDSN(e.dsn)
+		if dialect != e.dialect || source != e.source {
+			t.Errorf("ParseDSN(%q): expected %s %q, got %s %q", e.dsn, e.dialect, e.source, dialect, source)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package forms
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Decode copies the form into the struct dst points to and validates it. Each struct field is read from the
+// form field named by its form tag, and checked by the rules in its validate tag, separated by commas:
+//
+//	required       the field cannot be blank
+//	min=n, max=n   the field has at least, or at most, n characters
+//	email          the field is an email address
+//	phone          the field is a phone number in E.164 form
+//	range=a:b      the field is a whole number from a to b
+//	oneof=a|b|c    the field is one of the values
+//	matches=other  the field holds the same value as the form field other
+//
+// Struct fields can be strings, integers, bools or times, which are read as dates in DateLayout. Rules other
+// than required are skipped for empty fields. Errors are collected per field in f.Errors. Strings are copied
+// even when they fail validation, so a form can be shown again as it was filled in, while other fields are
+// left unchanged unless they pass. Decode only returns an error if dst or one of its tags cannot be used.
+func (f *Form) Decode(dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("forms: Decode needs a pointer to a struct, got %T", dst)
+	}
+	v = v.Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		name := sf.Tag.Get("form")
+		if name == "" || name == "-" || sf.PkgPath != "" {
+			continue
+		}
+
+		if !supported(sf.Type) {
+			return fmt.Errorf("forms: field %s: unsupported type %s", sf.Name, sf.Type)
+		}
+
+		err := f.validate(name, sf.Tag.Get("validate"))
+		if err != nil {
+			return fmt.Errorf("forms: field %s: %w", sf.Name, err)
+		}
+
+		if !f.Has(name) {
+			continue
+		}
+
+		f.set(v.Field(i), name)
+	}
+
+	return nil
+}
+
+// supported returns true if Decode can store form fields in struct fields of type t
+func supported(t reflect.Type) bool {
+	if t == timeType {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+// validate applies the rules of a validate tag to a form field. Every rule is parsed, so a mistake in a tag
+// is reported whatever the form holds.
+func (f *Form) validate(field, tag string) error {
+	if tag == "" {
+		return nil
+	}
+
+	required := false
+	var checks []func()
+
+	for _, rule := range strings.Split(tag, ",") {
+		name, arg := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, arg = rule[:i], rule[i+1:]
+		}
+
+		switch name {
+		case "required":
+			required = true
+		case "min", "max":
+			n, err := strconv.Atoi(arg)
+			if err != nil {
+				return fmt.Errorf("invalid rule %q", rule)
+			}
+			if name == "min" {
+				checks = append(checks, func() { f.MinLength(field, n) })
+			} else {
+				checks = append(checks, func() { f.MaxLength(field, n) })
+			}
+		case "email":
+			checks = append(checks, func() { f.IsEmail(field) })
+		case "phone":
+			checks = append(checks, func() { f.IsPhone(field) })
+		case "range":
+			var min, max int
+			if _, err := fmt.Sscanf(arg, "%d:%d", &min, &max); err != nil {
+				return fmt.Errorf("invalid rule %q", rule)
+			}
+			checks = append(checks, func() { f.InRange(field, min, max) })
+		case "oneof":
+			values := strings.Split(arg, "|")
+			checks = append(checks, func() { f.OneOf(field, values...) })
+		case "matches":
+			if arg == "" {
+				return fmt.Errorf("invalid rule %q", rule)
+			}
+			checks = append(checks, func() { f.Matches(field, arg) })
+		default:
+			return fmt.Errorf("unknown rule %q", rule)
+		}
+	}
+
+	if required {
+		f.Required(field)
+	}
+	if strings.TrimSpace(f.Get(field)) == "" {
+		return nil
+	}
+
+	for _, check := range checks {
+		check()
+	}
+
+	return nil
+}
+
+// set stores a form field in a struct field of a supported type, adding an error to the form field if it
+// has the wrong form. Only strings are stored once the form field has an error.
+func (f *Form) set(dst reflect.Value, field string) {
+	x := strings.TrimSpace(f.Get(field))
+
+	if dst.Kind() == reflect.String {
+		dst.SetString(f.Get(field))
+		return
+	}
+	if len(f.Errors[field]) > 0 {
+		return
+	}
+
+	if dst.Type() == timeType {
+		if f.IsDate(field) {
+			dst.Set(reflect.ValueOf(f.Date(field)))
+		}
+		return
+	}
+
+	switch dst.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(x, 10, dst.Type().Bits())
+		if err != nil {
+			f.fail(field, "forms.whole_number")
+			return
+		}
+		dst.SetInt(n)
+	case reflect.Bool:
+		if x == "on" {
+			dst.SetBool(true)
+			return
+		}
+		b, err := strconv.ParseBool(x)
+		if err != nil {
+			f.fail(field, "forms.bool")
+			return
+		}
+		dst.SetBool(b)
+	}
+}
@@ -1,27 +1,43 @@
 package forms
 
 import (
-	"fmt"
 	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/Rha02/bookings/internal/i18n"
 	"github.com/asaskevich/govalidator"
 )
 
+// DateLayout is the format dates are entered in
+const DateLayout = "01-02-2006"
+
+// e164 matches phone numbers in E.164 form, such as +14155552671
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+
 // creates a custom form struct
 type Form struct {
 	url.Values
 	Errors errors
+	// Locale is the language of the error messages, the default one when empty
+	Locale string
 }
 
 // New initializes a form struct
 func New(data url.Values) *Form {
 	return &Form{
-		data,
-		errors(map[string][]string{}),
+		Values: data,
+		Errors: errors(map[string][]string{}),
 	}
 }
 
+// fail adds the message with key in the form's locale to the errors of field
+func (f *Form) fail(field, key string, args ...interface{}) {
+	f.Errors.Add(field, i18n.T(f.Locale, key, args...))
+}
+
 // Valid returns true if there are no errors, otherwise false
 func (f *Form) Valid() bool {
 	return len(f.Errors) == 0
@@ -39,7 +55,7 @@ func (f *Form) Required(fields ...string) {
 	for _, field := range fields {
 		value := f.Get(field)
 		if strings.TrimSpace(value) == "" {
-			f.Errors.Add(field, "This field cannot be blank")
+			f.fail(field, "forms.blank")
 		}
 	}
 }
@@ -48,7 +64,7 @@ func (f *Form) Required(fields ...string) {
 func (f *Form) MinLength(field string, length int) bool {
 	x := f.Get(field)
 	if len(x) < length {
-		f.Errors.Add(field, fmt.Sprintf("This field must be at least %d characters long", length))
+		f.fail(field, "forms.min_length", length)
 		return false
 	}
 	return true
@@ -57,6 +73,126 @@ func (f *Form) MinLength(field string, length int) bool {
 // IsEmail checks for valid email address
 func (f *Form) IsEmail(field string) {
 	if !govalidator.IsEmail(f.Get(field)) {
-		f.Errors.Add(field, "Invalid email address")
+		f.fail(field, "forms.email")
+	}
+}
+
+// MaxLength checks whether a field has at most "length" characters in it
+func (f *Form) MaxLength(field string, length int) bool {
+	if len([]rune(f.Get(field))) > length {
+		f.fail(field, "forms.max_length", length)
+		return false
+	}
+	return true
+}
+
+// IsPhone checks that a field holds a phone number in E.164 form. Empty fields are left to Required.
+func (f *Form) IsPhone(field string) bool {
+	if !f.Has(field) {
+		return false
+	}
+	if !e164.MatchString(f.Get(field)) {
+		f.fail(field, "forms.phone")
+		return false
+	}
+	return true
+}
+
+// InRange checks that a field holds a whole number from min to max. Empty fields are left to Required.
+func (f *Form) InRange(field string, min, max int) bool {
+	if !f.Has(field) {
+		return false
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(f.Get(field)))
+	if err != nil || n < min || n > max {
+		f.fail(field, "forms.range", min, max)
+		return false
+	}
+	return true
+}
+
+// OneOf checks that a field holds one of the values. Empty fields are left to Required.
+func (f *Form) OneOf(field string, values ...string) bool {
+	if !f.Has(field) {
+		return false
+	}
+	x := f.Get(field)
+	for _, v := range values {
+		if x == v {
+			return true
+		}
+	}
+	f.fail(field, "forms.one_of", strings.Join(values, ", "))
+	return false
+}
+
+// Matches checks that a field holds the same value as another, such as a password and its confirmation
+func (f *Form) Matches(field, other string) bool {
+	if f.Get(field) != f.Get(other) {
+		f.fail(field, "forms.matches", strings.ReplaceAll(other, "_", " "))
+		return false
+	}
+	return true
+}
+
+// Date returns the date in a field, or the zero time if it does not hold one in DateLayout
+func (f *Form) Date(field string) time.Time {
+	t, err := time.Parse(DateLayout, strings.TrimSpace(f.Get(field)))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// IsDate checks that a field holds a date in DateLayout. Empty fields are left to Required.
+func (f *Form) IsDate(field string) bool {
+	if !f.Has(field) {
+		return false
 	}
+	if f.Date(field).IsZero() {
+		f.fail(field, "forms.date")
+		return false
+	}
+	return true
+}
+
+// NotInPast checks that the date in a field is not before today. Fields without a date are skipped.
+func (f *Form) NotInPast(field string, today time.Time) bool {
+	d := f.Date(field)
+	if d.IsZero() {
+		return false
+	}
+	if d.Before(today) {
+		f.fail(field, "forms.past")
+		return false
+	}
+	return true
+}
+
+// EndAfterStart checks that the date in end is after the date in start, adding the error to end.
+// It is skipped unless both fields hold a date.
+func (f *Form) EndAfterStart(start, end string) bool {
+	s, e := f.Date(start), f.Date(end)
+	if s.IsZero() || e.IsZero() {
+		return false
+	}
+	if !e.After(s) {
+		f.fail(end, "forms.end_after_start")
+		return false
+	}
+	return true
+}
+
+// MaxSpan checks that the date in end is at most days after the date in start, adding the error to end.
+// It is skipped unless both fields hold a date.
+func (f *Form) MaxSpan(start, end string, days int) bool {
+	s, e := f.Date(start), f.Date(end)
+	if s.IsZero() || e.IsZero() {
+		return false
+	}
+	if e.After(s.AddDate(0, 0, days)) {
+		f.fail(end, "forms.max_span", days)
+		return false
+	}
+	return true
 }
@@ -4,6 +4,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 )
 
 func TestForm_Valid(t *testing.T) {
@@ -108,3 +109,209 @@ func TestForm_IsEmail(t *testing.T) {
 		t.Error("Expected the form to be valid, but got invalid")
 	}
 }
+
+func TestForm_Dates(t *testing.T) {
+	today := time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC)
+
+	var tests = []struct {
+		name     string
+		start    string
+		end      string
+		expected map[string]string
+	}{
+		{"valid", "01-10-2050", "01-12-2050", map[string]string{}},
+		{"empty", "", "", map[string]string{}},
+		{"invalid", "2050-01-10", "01-32-2050", map[string]string{"start": "Invalid date, use mm-dd-yyyy", "end": "Invalid date, use mm-dd-yyyy"}},
+		{"in the past", "01-09-2050", "01-12-2050", map[string]string{"start": "This date is in the past"}},
+		{"end before start", "01-12-2050", "01-11-2050", map[string]string{"end": "This date must be after the start date"}},
+		{"end on start", "01-12-2050", "01-12-2050", map[string]string{"end": "This date must be after the start date"}},
+		{"longest span", "01-10-2050", "01-17-2050", map[string]string{}},
+		{"too long", "01-10-2050", "01-18-2050", map[string]string{"end": "This date must be at most 7 days after the start date"}},
+	}
+
+	for _, e := range tests {
+		form := New(url.Values{"start": {e.start}, "end": {e.end}})
+		form.IsDate("start")
+		form.IsDate("end")
+		form.NotInPast("start", today)
+		form.EndAfterStart("start", "end")
+		form.MaxSpan("start", "end", 7)
+
+		for _, field := range []string{"start", "end"} {
+			if got := form.Errors.Get(field); got != e.expected[field] {
+				t.Errorf("%s: expected %s error %q, got %q", e.name, field, e.expected[field], got)
+			}
+		}
+	}
+
+	form := New(url.Values{"start": {"01-10-2050"}})
+	if !form.Date("start").Equal(today) {
+		t.Errorf("expected %s, got %s", today, form.Date("start"))
+	}
+	if !form.Date("end").IsZero() {
+		t.Error("expected the zero time for a missing date")
+	}
+}
+
+func TestForm_Validators(t *testing.T) {
+	var tests = []struct {
+		name  string
+		value string
+		check func(f *Form) bool
+		valid bool
+	}{
+		{"max length", "abcd", func(f *Form) bool { return f.MaxLength("field", 4) }, true},
+		{"max length exceeded", "abcde", func(f *Form) bool { return f.MaxLength("field", 4) }, false},
+		{"max length counts characters", "ñññ", func(f *Form) bool { return f.MaxLength("field", 3) }, true},
+		{"phone", "+14155552671", func(f *Form) bool { return f.IsPhone("field") }, true},
+		{"phone without country code", "4155552671", func(f *Form) bool { return f.IsPhone("field") }, false},
+		{"phone with separators", "+1 415 555 2671", func(f *Form) bool { return f.IsPhone("field") }, false},
+		{"phone too long", "+1234567890123456", func(f *Form) bool { return f.IsPhone("field") }, false},
+		{"in range", "10", func(f *Form) bool { return f.InRange("field", 1, 10) }, true},
+		{"out of range", "11", func(f *Form) bool { return f.InRange("field", 1, 10) }, false},
+		{"not a number", "ten", func(f *Form) bool { return f.InRange("field", 1, 10) }, false},
+		{"one of", "b", func(f *Form) bool { return f.OneOf("field", "a", "b") }, true},
+		{"not one of", "c", func(f *Form) bool { return f.OneOf("field", "a", "b") }, false},
+		{"matches", "secret", func(f *Form) bool { return f.Matches("field", "other") }, true},
+		{"does not match", "secrets", func(f *Form) bool { return f.Matches("field", "other") }, false},
+	}
+
+	for _, e := range tests {
+		form := New(url.Values{"field": {e.value}, "other": {"secret"}})
+
+		if ok := e.check(form); ok != e.valid || form.Valid() != e.valid {
+			t.Errorf("%s: expected valid %t, got %t with errors %v", e.name, e.valid, ok, form.Errors)
+		}
+	}
+
+	//empty fields are left to Required
+	form := New(url.Values{})
+	form.IsPhone("field")
+	form.InRange("field", 1, 10)
+	form.OneOf("field", "a")
+	if !form.Valid() {
+		t.Errorf("expected empty fields to be skipped, got %v", form.Errors)
+	}
+}
+
+func TestForm_Decode(t *testing.T) {
+	type signup struct {
+		Name     string    `form:"name" validate:"required,min=3,max=10"`
+		Email    string    `form:"email" validate:"required,email"`
+		Phone    string    `form:"phone" validate:"phone"`
+		Guests   int       `form:"guests" validate:"range=1:4"`
+		Plan     string    `form:"plan" validate:"oneof=basic|full"`
+		Password string    `form:"password" validate:"required"`
+		Confirm  string    `form:"confirm" validate:"matches=password"`
+		Arrival  time.Time `form:"arrival"`
+		News     bool      `form:"news"`
+		Note     string
+		internal string `form:"internal"`
+	}
+
+	form := New(url.Values{
+		"name": {"Joseph"}, "email": {"jclyde@bookings.loc"}, "phone": {"+14155552671"}, "guests": {"2"},
+		"plan": {"full"}, "password": {"secret"}, "confirm": {"secret"}, "arrival": {"01-02-2050"}, "news": {"on"},
+		"Note": {"ignored"}, "internal": {"ignored"},
+	})
+
+	var s signup
+	if err := form.Decode(&s); err != nil {
+		t.Fatal(err)
+	}
+	if !form.Valid() {
+		t.Fatalf("expected a valid form, got %v", form.Errors)
+	}
+
+	expected := signup{
+		Name: "Joseph", Email: "jclyde@bookings.loc", Phone: "+14155552671", Guests: 2, Plan: "full",
+		Password: "secret", Confirm: "secret", Arrival: time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC), News: true,
+	}
+	if s != expected {
+		t.Errorf("expected %+v, got %+v", expected, s)
+	}
+
+	form = New(url.Values{
+		"name": {"Jo"}, "email": {"jclyde"}, "phone": {"555"}, "guests": {"five"}, "plan": {"gold"},
+		"password": {"secret"}, "confirm": {"secrets"}, "arrival": {"2050-01-02"}, "news": {"maybe"},
+	})
+
+	s = signup{Guests: 1}
+	if err := form.Decode(&s); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, field := range []string{"name", "email", "phone", "guests", "plan", "confirm", "arrival", "news"} {
+		if form.Errors.Get(field) == "" {
+			t.Errorf("expected an error for %s", field)
+		}
+	}
+	if form.Errors.Get("password") != "" {
+		t.Errorf("expected no error for password, got %s", form.Errors.Get("password"))
+	}
+	if s.Name != "Jo" || s.Guests != 1 {
+		t.Errorf("expected strings to be kept and other invalid fields left unchanged, got %+v", s)
+	}
+
+	form = New(url.Values{})
+	if err := form.Decode(&s); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"name", "email", "password"} {
+		if form.Errors.Get(field) != "This field cannot be blank" {
+			t.Errorf("expected %s to be required, got %q", field, form.Errors.Get(field))
+		}
+	}
+	if len(form.Errors) != 3 {
+		t.Errorf("expected only the required fields to have errors, got %v", form.Errors)
+	}
+}
+
+func TestForm_DecodeErrors(t *testing.T) {
+	var tests = []struct {
+		name string
+		dst  interface{}
+	}{
+		{"not a pointer", struct{}{}},
+		{"not a struct", new(string)},
+		{"unsupported type", &struct {
+			Rate float64 `form:"rate"`
+		}{}},
+		{"unknown rule", &struct {
+			Name string `form:"name" validate:"required,shiny"`
+		}{}},
+		{"invalid rule", &struct {
+			Guests int `form:"guests" validate:"range=1-4"`
+		}{}},
+	}
+
+	for _, e := range tests {
+		if err := New(url.Values{}).Decode(e.dst); err == nil {
+			t.Errorf("%s: expected an error", e.name)
+		}
+	}
+}
+
+func TestForm_Locale(t *testing.T) {
+	form := New(url.Values{"first_name": {"Jo"}, "start": {"13-45-2050"}})
+	form.Locale = "es"
+
+	form.Required("last_name")
+	form.MinLength("first_name", 3)
+	form.IsDate("start")
+
+	var tests = []struct {
+		field    string
+		expected string
+	}{
+		{"last_name", "Este campo no puede estar vacío"},
+		{"first_name", "Este campo debe tener al menos 3 caracteres"},
+		{"start", "Fecha no válida, use mm-dd-aaaa"},
+	}
+
+	for _, e := range tests {
+		if got := form.Errors.Get(e.field); got != e.expected {
+			t.Errorf("%s: expected %q, got %q", e.field, e.expected, got)
+		}
+	}
+}
@@ -1,18 +1,30 @@
 package handlers
 
 import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io/ioutil"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/Rha02/bookings/internal/availability"
 	"github.com/Rha02/bookings/internal/config"
 	"github.com/Rha02/bookings/internal/driver"
 	"github.com/Rha02/bookings/internal/forms"
 	"github.com/Rha02/bookings/internal/helpers"
+	"github.com/Rha02/bookings/internal/i18n"
+	"github.com/Rha02/bookings/internal/importer"
+	"github.com/Rha02/bookings/internal/logging"
+	"github.com/Rha02/bookings/internal/metrics"
 	"github.com/Rha02/bookings/internal/models"
 	"github.com/Rha02/bookings/internal/render"
 	"github.com/Rha02/bookings/internal/repository"
@@ -33,14 +45,14 @@ type Repository struct {
 func NewRepo(a *config.AppConfig, db *driver.DB) *Repository {
 	return &Repository{
 		App: a,
-		DB:  dbrepo.NewPostgresRepo(db.SQL, a),
+		DB:  dbrepo.New(db, a),
 	}
 }
 
 func NewTestRepo(a *config.AppConfig) *Repository {
 	return &Repository{
 		App: a,
-		DB:  dbrepo.NewTestingRepo(a),
+		DB:  dbrepo.NewMemoryRepo(a),
 	}
 }
 
@@ -70,18 +82,48 @@ func (m *Repository) Colonels(rw http.ResponseWriter, r *http.Request) {
 	render.Template(rw, r, "colonels.page.html", &models.TemplateData{})
 }
 
+//tr returns the message with key in the locale of the request, formatted with args
+func tr(r *http.Request, key string, args ...interface{}) string {
+	return i18n.T(i18n.FromContext(r.Context()), key, args...)
+}
+
+//newForm returns a form of values whose errors are in the locale of the request
+func newForm(r *http.Request, values url.Values) *forms.Form {
+	form := forms.New(values)
+	form.Locale = i18n.FromContext(r.Context())
+	return form
+}
+
+//SetLocale remembers the language chosen by the visitor and takes them back to the page they chose it on
+func (m *Repository) SetLocale(rw http.ResponseWriter, r *http.Request) {
+	locale := chi.URLParam(r, "locale")
+	if !i18n.Supported(locale) {
+		helpers.ClientError(rw, r, http.StatusNotFound)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "locale", locale)
+
+	back := "/"
+	if ref, err := url.Parse(r.Referer()); err == nil && ref.Host == r.Host && strings.HasPrefix(ref.Path, "/") && !strings.HasPrefix(ref.Path, "//") {
+		back = ref.RequestURI()
+	}
+
+	http.Redirect(rw, r, back, http.StatusSeeOther)
+}
+
 // Reservation renders the make a reservation page
 func (m *Repository) Reservation(rw http.ResponseWriter, r *http.Request) {
 	res, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
 	if !ok {
-		m.App.Session.Put(r.Context(), "error", "Can't get reservation from session")
+		m.App.Session.Put(r.Context(), "error", tr(r, "error.session_reservation"))
 		http.Redirect(rw, r, "/", http.StatusSeeOther)
 		return
 	}
 
 	room, err := m.DB.GetRoomByID(res.RoomID)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Can't find room")
+		m.App.Session.Put(r.Context(), "error", tr(r, "error.find_room"))
 		http.Redirect(rw, r, "/", http.StatusSeeOther)
 		return
 	}
@@ -107,64 +149,83 @@ func (m *Repository) Reservation(rw http.ResponseWriter, r *http.Request) {
 	})
 }
 
+//guestForm holds the guest's details from the reservation form
+type guestForm struct {
+	FirstName string `form:"first_name" validate:"required,min=3,max=255"`
+	LastName  string `form:"last_name" validate:"required,max=255"`
+	Email     string `form:"email" validate:"required,email,max=255"`
+	Phone     string `form:"phone" validate:"max=255"`
+}
+
 // PostReservation handles the posting of a reservation form
 func (m *Repository) PostReservation(rw http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Can't parse form!")
+		m.App.Session.Put(r.Context(), "error", tr(r, "error.parse_form"))
 		http.Redirect(rw, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	layout := "01-02-2006"
+	form := newForm(r, r.PostForm)
+
+	checkStayDates(form, "start_date", "end_date")
+	if !form.Valid() {
+		m.App.Session.Put(r.Context(), "error", stayDatesError(form, "start_date", "end_date"))
+		http.Redirect(rw, r, "/", http.StatusSeeOther)
+		return
+	}
 
-	sd := r.Form.Get("start_date")
-	ed := r.Form.Get("end_date")
+	startDate := form.Date("start_date")
+	endDate := form.Date("end_date")
 
-	startDate, err := time.Parse(layout, sd)
+	roomID, err := strconv.Atoi(r.Form.Get("room_id"))
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Can't parse start date")
+		m.App.Session.Put(r.Context(), "error", tr(r, "error.invalid_data"))
 		http.Redirect(rw, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	endDate, err := time.Parse(layout, ed)
+	room, err := m.DB.GetRoomByID(roomID)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Can't parse end date")
+		m.App.Session.Put(r.Context(), "error", tr(r, "error.invalid_data"))
 		http.Redirect(rw, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	roomID, err := strconv.Atoi(r.Form.Get("room_id"))
+	err = availability.Bookable(m.DB, m.App.StayRules, roomID, startDate, endDate, availability.Today())
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Invalid data")
-		http.Redirect(rw, r, "/", http.StatusSeeOther)
+		var ruleErr *availability.RuleError
+		if !errors.As(err, &ruleErr) {
+			logging.FromRequest(r).Error().Err(err).Int("room_id", roomID).Msg("cannot check stay rules")
+			m.App.Session.Put(r.Context(), "error", tr(r, "error.check_availability"))
+			http.Redirect(rw, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		m.App.Session.Put(r.Context(), "error", ruleErr.Message.In(i18n.FromContext(r.Context())))
+		http.Redirect(rw, r, "/search-availability", http.StatusSeeOther)
 		return
 	}
 
-	room, err := m.DB.GetRoomByID(roomID)
+	var guest guestForm
+	err = form.Decode(&guest)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Invalid data")
-		http.Redirect(rw, r, "/", http.StatusSeeOther)
+		helpers.ServerError(rw, r, err)
 		return
 	}
 
 	reservation := models.Reservation{
-		FirstName: r.Form.Get("first_name"),
-		LastName:  r.Form.Get("last_name"),
-		Phone:     r.Form.Get("phone"),
-		Email:     r.Form.Get("email"),
+		FirstName: guest.FirstName,
+		LastName:  guest.LastName,
+		Phone:     guest.Phone,
+		Email:     guest.Email,
 		StartDate: startDate,
 		EndDate:   endDate,
 		RoomID:    roomID,
+		Locale:    i18n.FromContext(r.Context()),
 		Room:      room,
 	}
 
-	form := forms.New(r.PostForm)
-	form.Required("first_name", "last_name", "email")
-	form.MinLength("first_name", 3)
-	form.IsEmail("email")
-
 	if !form.Valid() {
 		data := make(map[string]interface{})
 		data["reservation"] = reservation
@@ -182,57 +243,46 @@ func (m *Repository) PostReservation(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	newReservationID, err := m.DB.InsertReservation(reservation)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Can't insert reservation into database")
-		http.Redirect(rw, r, "/", http.StatusSeeOther)
-		return
+	mailData := models.ReservationMail{
+		Reservation: reservation,
+		Property:    m.App.Property,
+		Locale:      reservation.Locale,
 	}
 
-	restriction := models.RoomRestriction{
-		StartDate:     reservation.StartDate,
-		EndDate:       reservation.EndDate,
-		RoomID:        reservation.RoomID,
-		ReservationID: newReservationID,
-		RestrictionID: 1,
+	confirmation, err := render.LocalizedMail("reservation-confirmation", reservation.Locale, mailData)
+	if err != nil {
+		helpers.ServerError(rw, r, err)
+		return
 	}
+	confirmation.To = reservation.Email
+	confirmation.From = m.App.Property.Email
 
-	err = m.DB.InsertRoomRestriction(restriction)
+	//the notification goes to the property, so it is not sent in the guest's language
+	mailData.Locale = i18n.Default
+	notification, err := render.Mail("reservation-notification", mailData)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Can't insert room restriction")
-		http.Redirect(rw, r, "/", http.StatusSeeOther)
+		helpers.ServerError(rw, r, err)
 		return
 	}
+	notification.To = m.App.Property.Email
+	notification.From = m.App.Property.Email
 
-	htmlMessage := fmt.Sprintf(`
-		<strong>Reservation Confirmation</strong><br>
-		Dear %s, <br>
-		This is to confirm your reservation from %s to %s
-	`, reservation.FirstName, reservation.StartDate.Format(layout), reservation.EndDate.Format(layout))
-
-	msg := models.MailData{
-		To:       reservation.Email,
-		From:     "server@bookings.loc",
-		Subject:  "Reservation Confirmation",
-		Content:  htmlMessage,
-		Template: "basic.html",
+	buffer := availability.BufferNights(m.App.StayRules, reservation.RoomID, reservation.StartDate)
+	newID, err := m.DB.BookReservation(reservation, buffer, []models.MailData{confirmation, notification})
+	if errors.Is(err, repository.ErrUnavailable) {
+		m.App.Session.Put(r.Context(), "error", tr(r, "error.no_availability"))
+		http.Redirect(rw, r, "/search-availability", http.StatusSeeOther)
+		return
 	}
-
-	m.App.MailChan <- msg
-
-	htmlMessage = fmt.Sprintf(`
-		<strong>Reservation Notification</strong><br>
-		A reservation was made for room %s from %s to %s
-	`, reservation.Room.RoomName, reservation.StartDate.Format(layout), reservation.EndDate.Format(layout))
-
-	msg = models.MailData{
-		To:      "server@bookings.loc",
-		From:    "server@bookings.loc",
-		Subject: "Reservation Confirmation",
-		Content: htmlMessage,
+	if err != nil {
+		logging.FromRequest(r).Error().Err(err).Int("room_id", reservation.RoomID).Msg("cannot book reservation")
+		m.App.Session.Put(r.Context(), "error", tr(r, "error.insert_reservation"))
+		http.Redirect(rw, r, "/", http.StatusSeeOther)
+		return
 	}
-
-	m.App.MailChan <- msg
+	metrics.ReservationCreated()
+	logging.AddFields(r, map[string]interface{}{"reservation_id": newID})
+	logging.FromRequest(r).Info().Int("room_id", reservation.RoomID).Msg("reservation booked")
 
 	m.App.Session.Put(r.Context(), "reservation", reservation)
 
@@ -249,11 +299,32 @@ func (m *Repository) Contact(rw http.ResponseWriter, r *http.Request) {
 	render.Template(rw, r, "contact.page.html", &models.TemplateData{})
 }
 
+//maxStayNights is the longest stay that can be searched for or booked
+const maxStayNights = 365
+
+//checkStayDates validates the arrival and departure dates in the start and end fields of form
+func checkStayDates(form *forms.Form, start, end string) {
+	form.Required(start, end)
+	form.IsDate(start)
+	form.IsDate(end)
+	form.NotInPast(start, availability.Today())
+	form.EndAfterStart(start, end)
+	form.MaxSpan(start, end, maxStayNights)
+}
+
+//stayDatesError returns the first error of the start and end fields of form, naming the date it is about
+func stayDatesError(form *forms.Form, start, end string) string {
+	if msg := form.Errors.Get(start); msg != "" {
+		return i18n.T(form.Locale, "dates.arrival_error", msg)
+	}
+	return i18n.T(form.Locale, "dates.departure_error", form.Errors.Get(end))
+}
+
 // PostAvailability
 func (m *Repository) PostAvailability(rw http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Can't parse form!")
+		m.App.Session.Put(r.Context(), "error", tr(r, "error.parse_form"))
 		http.Redirect(rw, r, "/", http.StatusSeeOther)
 		return
 	}
@@ -261,36 +332,61 @@ func (m *Repository) PostAvailability(rw http.ResponseWriter, r *http.Request) {
 	start := r.Form.Get("start")
 	end := r.Form.Get("end")
 
-	layout := "01-02-2006"
-
-	startDate, err := time.Parse(layout, start)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Can't parse start date")
+	form := newForm(r, r.Form)
+	checkStayDates(form, "start", "end")
+	if !form.Valid() {
+		m.App.Session.Put(r.Context(), "error", stayDatesError(form, "start", "end"))
 		http.Redirect(rw, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	endDate, err := time.Parse(layout, end)
+	startDate := form.Date("start")
+	endDate := form.Date("end")
+
+	rooms, err := m.DB.SearchAvailabilityForAllRooms(startDate, endDate)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Can't parse end date")
+		m.App.Session.Put(r.Context(), "error", tr(r, "error.search"))
 		http.Redirect(rw, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	rooms, err := m.DB.SearchAvailabilityForAllRooms(startDate, endDate)
+	rooms, rule, err := m.bookableRooms(rooms, startDate, endDate, i18n.FromContext(r.Context()))
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Can't search for availability")
+		m.App.Session.Put(r.Context(), "error", tr(r, "error.search"))
 		http.Redirect(rw, r, "/", http.StatusSeeOther)
 		return
 	}
 
+	data := make(map[string]interface{})
+
 	if len(rooms) == 0 {
-		m.App.Session.Put(r.Context(), "error", "No availability")
-		http.Redirect(rw, r, "/search-availability", http.StatusSeeOther)
+		suggestions, err := availability.Suggest(m.DB, m.App.StayRules, startDate, endDate, availability.Today())
+		if err != nil {
+			logging.FromRequest(r).Error().Err(err).Msg("cannot suggest alternative dates")
+		}
+
+		if len(suggestions) == 0 {
+			if rule == "" {
+				rule = tr(r, "error.no_availability")
+			}
+			m.App.Session.Put(r.Context(), "error", rule)
+			http.Redirect(rw, r, "/search-availability", http.StatusSeeOther)
+			return
+		}
+
+		data["suggestions"] = suggestions
+
+		render.Template(rw, r, "search-availability.page.html", &models.TemplateData{
+			Data: data,
+			StringMap: map[string]string{
+				"start_date": start,
+				"end_date":   end,
+				"rule":       rule,
+			},
+		})
 		return
 	}
 
-	data := make(map[string]interface{})
 	data["rooms"] = rooms
 
 	res := models.Reservation{
@@ -305,12 +401,82 @@ func (m *Repository) PostAvailability(rw http.ResponseWriter, r *http.Request) {
 	})
 }
 
+//bookableRooms returns the rooms the stay rules allow a stay from start to end in,
+//and the message of the first rule that ruled a room out, in the locale
+func (m *Repository) bookableRooms(rooms []models.Room, start, end time.Time, locale string) ([]models.Room, string, error) {
+	var bookable []models.Room
+	var rule string
+
+	for _, room := range rooms {
+		err := availability.Bookable(m.DB, m.App.StayRules, room.ID, start, end, availability.Today())
+
+		var ruleErr *availability.RuleError
+		switch {
+		case errors.As(err, &ruleErr):
+			if rule == "" {
+				rule = ruleErr.Message.In(locale)
+			}
+		case err != nil:
+			return nil, "", err
+		default:
+			bookable = append(bookable, room)
+		}
+	}
+
+	return bookable, rule, nil
+}
+
 type jsonResponse struct {
-	OK        bool   `json:"ok"`
-	Message   string `json:"message"`
-	RoomID    string `json:"room_id"`
-	StartDate string `json:"start_date"`
-	EndDate   string `json:"end_date"`
+	OK          bool             `json:"ok"`
+	Message     string           `json:"message"`
+	RoomID      string           `json:"room_id"`
+	StartDate   string           `json:"start_date"`
+	EndDate     string           `json:"end_date"`
+	Rule        string           `json:"rule,omitempty"`
+	Suggestions []jsonSuggestion `json:"suggestions,omitempty"`
+}
+
+//jsonSuggestion is an alternative stay offered when a room is not available
+type jsonSuggestion struct {
+	StartDate string     `json:"start_date"`
+	EndDate   string     `json:"end_date"`
+	Rooms     []jsonRoom `json:"rooms"`
+}
+
+//jsonRoom is a room free for a suggested stay, with the link that books it
+type jsonRoom struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	BookURL string `json:"book_url"`
+}
+
+//jsonSuggestions converts alternative stays to their JSON form
+func jsonSuggestions(suggestions []availability.Suggestion) []jsonSuggestion {
+	var out []jsonSuggestion
+
+	for _, s := range suggestions {
+		js := jsonSuggestion{
+			StartDate: render.HumanDate(s.StartDate),
+			EndDate:   render.HumanDate(s.EndDate),
+		}
+
+		for _, room := range s.Rooms {
+			q := url.Values{}
+			q.Set("id", strconv.Itoa(room.ID))
+			q.Set("s", js.StartDate)
+			q.Set("e", js.EndDate)
+
+			js.Rooms = append(js.Rooms, jsonRoom{
+				ID:      room.ID,
+				Name:    room.RoomName,
+				BookURL: "/book-room?" + q.Encode(),
+			})
+		}
+
+		out = append(out, js)
+	}
+
+	return out
 }
 
 // AvailabilityJSON handles request for availability and send JSON response
@@ -319,7 +485,7 @@ func (m *Repository) AvailabilityJSON(rw http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		resp := jsonResponse{
 			OK:      false,
-			Message: "Internal Server Error",
+			Message: tr(r, "error.internal"),
 		}
 
 		out, _ := json.MarshalIndent(resp, "", "  ")
@@ -331,11 +497,24 @@ func (m *Repository) AvailabilityJSON(rw http.ResponseWriter, r *http.Request) {
 	sd := r.Form.Get("start")
 	ed := r.Form.Get("end")
 
-	layout := "01-02-2006"
+	form := newForm(r, r.Form)
+	checkStayDates(form, "start", "end")
+	if !form.Valid() {
+		resp := jsonResponse{
+			OK:        false,
+			Message:   stayDatesError(form, "start", "end"),
+			StartDate: sd,
+			EndDate:   ed,
+		}
 
-	startDate, _ := time.Parse(layout, sd)
+		out, _ := json.MarshalIndent(resp, "", "  ")
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write(out)
+		return
+	}
 
-	endDate, _ := time.Parse(layout, ed)
+	startDate := form.Date("start")
+	endDate := form.Date("end")
 
 	roomID, _ := strconv.Atoi(r.Form.Get("room_id"))
 
@@ -343,7 +522,7 @@ func (m *Repository) AvailabilityJSON(rw http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		resp := jsonResponse{
 			OK:      false,
-			Message: "Error connecting to database",
+			Message: tr(r, "error.database"),
 		}
 
 		out, _ := json.MarshalIndent(resp, "", "  ")
@@ -354,23 +533,152 @@ func (m *Repository) AvailabilityJSON(rw http.ResponseWriter, r *http.Request) {
 
 	resp := jsonResponse{
 		OK:        available,
-		Message:   "Available!",
+		Message:   tr(r, "availability.json_available"),
 		RoomID:    strconv.Itoa(roomID),
 		StartDate: sd,
 		EndDate:   ed,
 	}
 
+	if available {
+		err = availability.Bookable(m.DB, m.App.StayRules, roomID, startDate, endDate, availability.Today())
+
+		var ruleErr *availability.RuleError
+		if errors.As(err, &ruleErr) {
+			resp.OK = false
+			resp.Message = tr(r, "availability.json_not_available")
+			resp.Rule = ruleErr.Message.In(i18n.FromContext(r.Context()))
+		} else if err != nil {
+			logging.FromRequest(r).Error().Err(err).Int("room_id", roomID).Msg("cannot check stay rules")
+			resp.OK = false
+			resp.Message = tr(r, "error.database")
+		}
+	} else {
+		resp.Message = tr(r, "availability.json_not_available")
+	}
+
+	if !resp.OK {
+		suggestions, err := availability.Suggest(m.DB, m.App.StayRules, startDate, endDate, availability.Today())
+		if err != nil {
+			logging.FromRequest(r).Error().Err(err).Msg("cannot suggest alternative dates")
+		}
+		resp.Suggestions = jsonSuggestions(suggestions)
+	}
+
 	out, _ := json.MarshalIndent(resp, "", "     ")
 
 	rw.Header().Set("Content-Type", "application/json")
 	rw.Write(out)
 }
 
+//jsonBookedDates lists the nights in a window that cannot be booked, for date pickers to disable
+type jsonBookedDates struct {
+	OK        bool     `json:"ok"`
+	Message   string   `json:"message,omitempty"`
+	RoomID    int      `json:"room_id,omitempty"`
+	StartDate string   `json:"start_date,omitempty"`
+	EndDate   string   `json:"end_date,omitempty"`
+	Booked    []string `json:"booked"`
+}
+
+func writeBookedDates(rw http.ResponseWriter, status int, resp jsonBookedDates) {
+	if resp.Booked == nil {
+		resp.Booked = []string{}
+	}
+
+	out, _ := json.MarshalIndent(resp, "", "  ")
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	rw.Write(out)
+}
+
+//BookedDates returns the nights from start up to end that the room in room_id cannot be booked for,
+//or that no room can be booked for when room_id is empty. The window defaults to a year from today.
+func (m *Repository) BookedDates(rw http.ResponseWriter, r *http.Request) {
+	layout := "01-02-2006"
+	q := r.URL.Query()
+
+	startDate := availability.Today()
+	if sd := q.Get("start"); sd != "" {
+		t, err := time.Parse(layout, sd)
+		if err != nil {
+			writeBookedDates(rw, http.StatusBadRequest, jsonBookedDates{Message: tr(r, "error.start_date")})
+			return
+		}
+		startDate = t
+	}
+
+	endDate := startDate.AddDate(1, 0, 0)
+	if ed := q.Get("end"); ed != "" {
+		t, err := time.Parse(layout, ed)
+		if err != nil {
+			writeBookedDates(rw, http.StatusBadRequest, jsonBookedDates{Message: tr(r, "error.end_date")})
+			return
+		}
+		endDate = t
+	}
+
+	if !endDate.After(startDate) || endDate.After(startDate.AddDate(0, 0, availability.MaxBookedDays)) {
+		writeBookedDates(rw, http.StatusBadRequest, jsonBookedDates{
+			Message: tr(r, "error.booked_window", availability.MaxBookedDays),
+		})
+		return
+	}
+
+	resp := jsonBookedDates{
+		OK:        true,
+		StartDate: render.HumanDate(startDate),
+		EndDate:   render.HumanDate(endDate),
+	}
+
+	var booked []time.Time
+
+	if id := q.Get("room_id"); id != "" {
+		roomID, err := strconv.Atoi(id)
+		if err != nil {
+			writeBookedDates(rw, http.StatusBadRequest, jsonBookedDates{Message: tr(r, "error.invalid_room_id")})
+			return
+		}
+
+		if _, err = m.DB.GetRoomByID(roomID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				writeBookedDates(rw, http.StatusNotFound, jsonBookedDates{Message: tr(r, "error.room_not_found")})
+				return
+			}
+			logging.FromRequest(r).Error().Err(err).Int("room_id", roomID).Msg("cannot get room")
+			writeBookedDates(rw, http.StatusInternalServerError, jsonBookedDates{Message: tr(r, "error.database")})
+			return
+		}
+
+		resp.RoomID = roomID
+		booked, err = availability.BookedNights(m.DB, roomID, startDate, endDate)
+		if err != nil {
+			logging.FromRequest(r).Error().Err(err).Int("room_id", roomID).Msg("cannot get booked dates")
+			writeBookedDates(rw, http.StatusInternalServerError, jsonBookedDates{Message: tr(r, "error.database")})
+			return
+		}
+	} else {
+		var err error
+		booked, err = availability.FullyBookedNights(m.DB, startDate, endDate)
+		if err != nil {
+			logging.FromRequest(r).Error().Err(err).Msg("cannot get booked dates")
+			writeBookedDates(rw, http.StatusInternalServerError, jsonBookedDates{Message: tr(r, "error.database")})
+			return
+		}
+	}
+
+	for _, d := range booked {
+		resp.Booked = append(resp.Booked, render.HumanDate(d))
+	}
+
+	writeBookedDates(rw, http.StatusOK, resp)
+}
+
 //ReservationSummary displays the reservation summary page
 func (m *Repository) ReservationSummary(rw http.ResponseWriter, r *http.Request) {
 	reservation, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
 	if !ok {
-		m.App.Session.Put(r.Context(), "error", "Can't get reservation from session")
+		m.App.Session.Put(r.Context(), "error", tr(r, "error.session_reservation"))
 		http.Redirect(rw, r, "/", http.StatusSeeOther)
 		return
 	}
@@ -400,14 +708,14 @@ func (m *Repository) ChooseRoom(rw http.ResponseWriter, r *http.Request) {
 
 	roomID, err := strconv.Atoi(exploded[2])
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Can't get room id from url")
+		m.App.Session.Put(r.Context(), "error", tr(r, "error.room_id"))
 		http.Redirect(rw, r, "/", http.StatusSeeOther)
 		return
 	}
 
 	res, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
 	if !ok {
-		m.App.Session.Put(r.Context(), "error", "Can't get reservation from session")
+		m.App.Session.Put(r.Context(), "error", tr(r, "error.session_reservation"))
 		http.Redirect(rw, r, "/", http.StatusSeeOther)
 		return
 	}
@@ -423,25 +731,27 @@ func (m *Repository) ChooseRoom(rw http.ResponseWriter, r *http.Request) {
 func (m *Repository) BookRoom(rw http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(r.URL.Query().Get("id"))
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Can't get id from the url query")
+		m.App.Session.Put(r.Context(), "error", tr(r, "error.query_id"))
 		http.Redirect(rw, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	sd := r.URL.Query().Get("s")
-	ed := r.URL.Query().Get("e")
-
-	layout := "01-02-2006"
-
-	startDate, _ := time.Parse(layout, sd)
+	form := newForm(r, r.URL.Query())
+	checkStayDates(form, "s", "e")
+	if !form.Valid() {
+		m.App.Session.Put(r.Context(), "error", stayDatesError(form, "s", "e"))
+		http.Redirect(rw, r, "/", http.StatusSeeOther)
+		return
+	}
 
-	endDate, _ := time.Parse(layout, ed)
+	startDate := form.Date("s")
+	endDate := form.Date("e")
 
 	var res models.Reservation
 
 	room, err := m.DB.GetRoomByID(id)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Can't get room from the database")
+		m.App.Session.Put(r.Context(), "error", tr(r, "error.get_room"))
 		http.Redirect(rw, r, "/", http.StatusSeeOther)
 		return
 	}
@@ -468,13 +778,13 @@ func (m *Repository) PostShowLogin(rw http.ResponseWriter, r *http.Request) {
 
 	err := r.ParseForm()
 	if err != nil {
-		log.Println(err)
+		logging.FromRequest(r).Warn().Err(err).Msg("cannot parse login form")
 	}
 
 	email := r.Form.Get("email")
 	password := r.Form.Get("password")
 
-	form := forms.New(r.PostForm)
+	form := newForm(r, r.PostForm)
 	form.Required("email", "password")
 	form.IsEmail("email")
 
@@ -487,13 +797,13 @@ func (m *Repository) PostShowLogin(rw http.ResponseWriter, r *http.Request) {
 
 	id, _, err := m.DB.Authenticate(email, password)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Invalid login credentials")
+		m.App.Session.Put(r.Context(), "error", tr(r, "error.login"))
 		http.Redirect(rw, r, "/login", http.StatusSeeOther)
 		return
 	}
 
 	m.App.Session.Put(r.Context(), "user_id", id)
-	m.App.Session.Put(r.Context(), "flash", "Logged in successfully!")
+	m.App.Session.Put(r.Context(), "flash", tr(r, "flash.logged_in"))
 
 	http.Redirect(rw, r, "/", http.StatusSeeOther)
 }
@@ -513,34 +823,119 @@ func (m *Repository) AdminDashboard(rw http.ResponseWriter, r *http.Request) {
 
 //AdminNewReservations shows all new reservations in admin tool
 func (m *Repository) AdminNewReservations(rw http.ResponseWriter, r *http.Request) {
-	reservations, err := m.DB.AllNewReservations()
+	m.adminReservationList(rw, r, "new", "new", "admin-new-reservations.page.html")
+}
+
+//AdminAllReservations shows all reservations that were processed
+func (m *Repository) AdminAllReservations(rw http.ResponseWriter, r *http.Request) {
+	m.adminReservationList(rw, r, "all", "", "admin-all-reservations.page.html")
+}
+
+//adminReservationList renders one page of reservations using the paging, sorting and filter options in the url query.
+//A non-empty status restricts the list to reservations with that status.
+func (m *Repository) adminReservationList(rw http.ResponseWriter, r *http.Request, src, status, tmpl string) {
+	f, query := reservationFilterFromQuery(r.URL.Query())
+	if status != "" {
+		f.Status = status
+		query.Del("status")
+	}
+
+	reservations, total, err := m.DB.SearchReservations(f)
+	if err != nil {
+		helpers.ServerError(rw, r, err)
+		return
+	}
+
+	rooms, err := m.DB.AllRooms()
 	if err != nil {
-		helpers.ServerError(rw, err)
+		helpers.ServerError(rw, r, err)
 		return
 	}
 
 	data := make(map[string]interface{})
 	data["reservations"] = reservations
+	data["rooms"] = rooms
+	data["pagination"] = models.Pagination{
+		Page:     f.Page,
+		PageSize: f.PageSize,
+		Total:    total,
+		Sort:     f.Sort,
+		Desc:     f.Desc,
+		Query:    query,
+	}
 
-	render.Template(rw, r, "admin-new-reservations.page.html", &models.TemplateData{
-		Data: data,
+	stringMap := make(map[string]string)
+	stringMap["src"] = src
+	stringMap["q"] = f.Query
+	stringMap["status"] = f.Status
+	stringMap["from"] = query.Get("from")
+	stringMap["to"] = query.Get("to")
+
+	intMap := make(map[string]int)
+	intMap["room_id"] = f.RoomID
+	intMap["page_size"] = f.PageSize
+
+	render.Template(rw, r, tmpl, &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+		IntMap:    intMap,
 	})
 }
 
-//AdminAllReservations shows all reservations that were processed
-func (m *Repository) AdminAllReservations(rw http.ResponseWriter, r *http.Request) {
-	reservations, err := m.DB.AllReservations()
-	if err != nil {
-		helpers.ServerError(rw, err)
-		return
+//reservationFilterFromQuery reads list options from a url query. It also returns the filter values
+//that were understood, so that page and sort links can carry them along.
+func reservationFilterFromQuery(q url.Values) (models.ReservationFilter, url.Values) {
+	layout := "01-02-2006"
+	kept := url.Values{}
+
+	f := models.ReservationFilter{
+		Page:     1,
+		PageSize: models.DefaultPageSize,
+		Sort:     "start_date",
 	}
 
-	data := make(map[string]interface{})
-	data["reservations"] = reservations
+	if page, err := strconv.Atoi(q.Get("page")); err == nil && page > 0 {
+		f.Page = page
+	}
 
-	render.Template(rw, r, "admin-all-reservations.page.html", &models.TemplateData{
-		Data: data,
-	})
+	if size, err := strconv.Atoi(q.Get("size")); err == nil && size > 0 {
+		f.PageSize = size
+		if f.PageSize > models.MaxPageSize {
+			f.PageSize = models.MaxPageSize
+		}
+	}
+
+	if sort := q.Get("sort"); sort != "" {
+		f.Sort = sort
+	}
+	f.Desc = q.Get("dir") == "desc"
+
+	if roomID, err := strconv.Atoi(q.Get("room")); err == nil && roomID > 0 {
+		f.RoomID = roomID
+		kept.Set("room", q.Get("room"))
+	}
+
+	if from, err := time.Parse(layout, q.Get("from")); err == nil {
+		f.From = from
+		kept.Set("from", q.Get("from"))
+	}
+
+	if to, err := time.Parse(layout, q.Get("to")); err == nil {
+		f.To = to
+		kept.Set("to", q.Get("to"))
+	}
+
+	if status := q.Get("status"); status == "new" || status == "processed" || status == "cancelled" {
+		f.Status = status
+		kept.Set("status", status)
+	}
+
+	if text := strings.TrimSpace(q.Get("q")); text != "" {
+		f.Query = text
+		kept.Set("q", text)
+	}
+
+	return f, kept
 }
 
 func (m *Repository) AdminReservationsCalendar(rw http.ResponseWriter, r *http.Request) {
@@ -584,7 +979,7 @@ func (m *Repository) AdminReservationsCalendar(rw http.ResponseWriter, r *http.R
 
 	rooms, err := m.DB.AllRooms()
 	if err != nil {
-		helpers.ServerError(rw, err)
+		helpers.ServerError(rw, r, err)
 		return
 	}
 
@@ -601,7 +996,7 @@ func (m *Repository) AdminReservationsCalendar(rw http.ResponseWriter, r *http.R
 
 		restrictions, err := m.DB.GetRestrictionsForRoomByDate(x.ID, firstOfMonth, lastOfMonth)
 		if err != nil {
-			helpers.ServerError(rw, err)
+			helpers.ServerError(rw, r, err)
 			return
 		}
 
@@ -634,9 +1029,10 @@ func (m *Repository) AdminShowReservation(rw http.ResponseWriter, r *http.Reques
 
 	id, err := strconv.Atoi(exploded[4])
 	if err != nil {
-		helpers.ServerError(rw, err)
+		helpers.ServerError(rw, r, err)
 		return
 	}
+	logging.AddFields(r, map[string]interface{}{"reservation_id": id})
 
 	src := exploded[3]
 
@@ -651,7 +1047,7 @@ func (m *Repository) AdminShowReservation(rw http.ResponseWriter, r *http.Reques
 
 	res, err := m.DB.GetReservationByID(id)
 	if err != nil {
-		helpers.ServerError(rw, err)
+		helpers.ServerError(rw, r, err)
 		return
 	}
 
@@ -665,10 +1061,12 @@ func (m *Repository) AdminShowReservation(rw http.ResponseWriter, r *http.Reques
 	})
 }
 
+//AdminPostShowReservation updates the guest details of a reservation. Its dates cannot be changed here,
+//so the stay rules are not checked again.
 func (m *Repository) AdminPostShowReservation(rw http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
-		helpers.ServerError(rw, err)
+		helpers.ServerError(rw, r, err)
 		return
 	}
 
@@ -676,9 +1074,10 @@ func (m *Repository) AdminPostShowReservation(rw http.ResponseWriter, r *http.Re
 
 	id, err := strconv.Atoi(exploded[4])
 	if err != nil {
-		helpers.ServerError(rw, err)
+		helpers.ServerError(rw, r, err)
 		return
 	}
+	logging.AddFields(r, map[string]interface{}{"reservation_id": id})
 
 	src := exploded[3]
 
@@ -687,7 +1086,7 @@ func (m *Repository) AdminPostShowReservation(rw http.ResponseWriter, r *http.Re
 
 	res, err := m.DB.GetReservationByID(id)
 	if err != nil {
-		helpers.ServerError(rw, err)
+		helpers.ServerError(rw, r, err)
 		return
 	}
 
@@ -695,10 +1094,11 @@ func (m *Repository) AdminPostShowReservation(rw http.ResponseWriter, r *http.Re
 	res.LastName = r.Form.Get("last_name")
 	res.Email = r.Form.Get("email")
 	res.Phone = r.Form.Get("phone")
+	res.Notes = r.Form.Get("notes")
 
 	err = m.DB.UpdateReservation(res)
 	if err != nil {
-		helpers.ServerError(rw, err)
+		helpers.ServerError(rw, r, err)
 		return
 	}
 
@@ -717,14 +1117,12 @@ func (m *Repository) AdminPostShowReservation(rw http.ResponseWriter, r *http.Re
 //AdminProcessReservation marks a reservation as processed
 func (m *Repository) AdminProcessReservation(rw http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
-	log.Println(id)
 	src := chi.URLParam(r, "src")
-
-	log.Println(src)
+	logging.AddFields(r, map[string]interface{}{"reservation_id": id})
 
 	err := m.DB.UpdateProcessedForReservation(id, 1)
 	if err != nil {
-		helpers.ServerError(rw, err)
+		helpers.ServerError(rw, r, err)
 		return
 	}
 
@@ -743,10 +1141,11 @@ func (m *Repository) AdminProcessReservation(rw http.ResponseWriter, r *http.Req
 func (m *Repository) AdminDeleteReservation(rw http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
 	src := chi.URLParam(r, "src")
+	logging.AddFields(r, map[string]interface{}{"reservation_id": id})
 
 	err := m.DB.DeleteReservation(id)
 	if err != nil {
-		helpers.ServerError(rw, err)
+		helpers.ServerError(rw, r, err)
 		return
 	}
 
@@ -762,11 +1161,36 @@ func (m *Repository) AdminDeleteReservation(rw http.ResponseWriter, r *http.Requ
 	}
 }
 
+//AdminCancelReservation cancels a reservation, freeing its room and stopping any scheduled emails
+func (m *Repository) AdminCancelReservation(rw http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	src := chi.URLParam(r, "src")
+	logging.AddFields(r, map[string]interface{}{"reservation_id": id})
+
+	err := m.DB.CancelReservation(id)
+	if err != nil {
+		helpers.ServerError(rw, r, err)
+		return
+	}
+	metrics.ReservationCancelled()
+
+	year := r.URL.Query().Get("y")
+	month := r.URL.Query().Get("m")
+
+	m.App.Session.Put(r.Context(), "flash", "Reservation cancelled")
+
+	if year == "" {
+		http.Redirect(rw, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+	} else {
+		http.Redirect(rw, r, fmt.Sprintf("/admin/reservations-calendar?y=%s&m=%s", year, month), http.StatusSeeOther)
+	}
+}
+
 //AdminPostReservationsCalendar handles post of reservations calendar
 func (m *Repository) AdminPostReservationsCalendar(rw http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
-		helpers.ServerError(rw, err)
+		helpers.ServerError(rw, r, err)
 		return
 	}
 
@@ -775,7 +1199,7 @@ func (m *Repository) AdminPostReservationsCalendar(rw http.ResponseWriter, r *ht
 
 	rooms, _ := m.DB.AllRooms()
 	if err != nil {
-		helpers.ServerError(rw, err)
+		helpers.ServerError(rw, r, err)
 		return
 	}
 
@@ -790,7 +1214,7 @@ func (m *Repository) AdminPostReservationsCalendar(rw http.ResponseWriter, r *ht
 					if !form.Has(fmt.Sprintf("remove_block_%d_%s", room.ID, name)) {
 						err := m.DB.DeleteBlockByID(value)
 						if err != nil {
-							helpers.ServerError(rw, err)
+							helpers.ServerError(rw, r, err)
 							return
 						}
 					}
@@ -799,21 +1223,554 @@ func (m *Repository) AdminPostReservationsCalendar(rw http.ResponseWriter, r *ht
 		}
 	}
 
+	//blocks keep the buffer nights of the stays next to them, and the other stay rules only apply to stays
+	var refused []string
+
 	for name := range r.PostForm {
 		if strings.HasPrefix(name, "add_block") {
 			exploded := strings.Split(name, "_")
 			roomID, _ := strconv.Atoi(exploded[2])
 			t, _ := time.Parse("01-02-2006", exploded[3])
 
-			err := m.DB.InsertBlockForRoom(roomID, t)
+			err := availability.CheckBlock(m.DB, m.App.StayRules, roomID, t)
+			var ruleErr *availability.RuleError
+			if errors.As(err, &ruleErr) {
+				refused = append(refused, fmt.Sprintf("room %d on %s: %s", roomID, exploded[3], ruleErr))
+				continue
+			}
+			if err != nil {
+				helpers.ServerError(rw, r, err)
+				return
+			}
+
+			err = m.DB.InsertBlockForRoom(roomID, t)
 			if err != nil {
-				helpers.ServerError(rw, err)
+				helpers.ServerError(rw, r, err)
 				return
 			}
 		}
 	}
 
-	m.App.Session.Put(r.Context(), "flash", "Changes saved")
+	if len(refused) > 0 {
+		sort.Strings(refused)
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Blocks not added for %s", strings.Join(refused, "; ")))
+	} else {
+		m.App.Session.Put(r.Context(), "flash", "Changes saved")
+	}
 
 	http.Redirect(rw, r, fmt.Sprintf("/admin/reservations-calendar?y=%d&m=%d", year, month), http.StatusSeeOther)
 }
+
+//searchResultsLimit is the number of results shown by the admin guest search
+const searchResultsLimit = 50
+
+//AdminSearch searches reservations by guest name, email, phone and notes
+func (m *Repository) AdminSearch(rw http.ResponseWriter, r *http.Request) {
+	text := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	stringMap := make(map[string]string)
+	stringMap["q"] = text
+
+	data := make(map[string]interface{})
+
+	if text != "" {
+		reservations, err := m.DB.FullTextSearchReservations(text, searchResultsLimit)
+		if err != nil {
+			helpers.ServerError(rw, r, err)
+			return
+		}
+		data["reservations"] = reservations
+	}
+
+	render.Template(rw, r, "admin-search.page.html", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+//AdminGuests lists guest profiles, optionally filtered by name, email or phone
+func (m *Repository) AdminGuests(rw http.ResponseWriter, r *http.Request) {
+	text := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	guests, total, err := m.DB.SearchGuests(text, models.DefaultPageSize, (page-1)*models.DefaultPageSize)
+	if err != nil {
+		helpers.ServerError(rw, r, err)
+		return
+	}
+
+	query := url.Values{}
+	if text != "" {
+		query.Set("q", text)
+	}
+
+	data := make(map[string]interface{})
+	data["guests"] = guests
+	data["pagination"] = models.Pagination{
+		Page:     page,
+		PageSize: models.DefaultPageSize,
+		Total:    total,
+		Query:    query,
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["q"] = text
+
+	render.Template(rw, r, "admin-guests.page.html", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+//AdminShowGuest shows a guest profile with contact details and stay history
+func (m *Repository) AdminShowGuest(rw http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(rw, r, http.StatusBadRequest)
+		return
+	}
+
+	guest, err := m.DB.GetGuestByID(id)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't find guest")
+		http.Redirect(rw, r, "/admin/guests", http.StatusSeeOther)
+		return
+	}
+
+	reservations, err := m.DB.GetReservationsForGuest(id)
+	if err != nil {
+		helpers.ServerError(rw, r, err)
+		return
+	}
+
+	duplicates, err := m.DB.FindDuplicateGuests(guest)
+	if err != nil {
+		helpers.ServerError(rw, r, err)
+		return
+	}
+
+	today := time.Now().Truncate(24 * time.Hour)
+
+	var past, upcoming, cancelled []models.Reservation
+	nights := 0
+
+	//cancelled stays are listed on their own and do not count toward the guest's stays and nights
+	for _, res := range reservations {
+		if res.Cancelled() {
+			cancelled = append(cancelled, res)
+			continue
+		}
+
+		nights += res.Nights()
+		if res.EndDate.After(today) {
+			upcoming = append(upcoming, res)
+		} else {
+			past = append(past, res)
+		}
+	}
+
+	data := make(map[string]interface{})
+	data["guest"] = guest
+	data["past"] = past
+	data["upcoming"] = upcoming
+	data["cancelled"] = cancelled
+	data["duplicates"] = duplicates
+
+	intMap := make(map[string]int)
+	intMap["stays"] = len(past) + len(upcoming)
+	intMap["nights"] = nights
+
+	render.Template(rw, r, "admin-guest-show.page.html", &models.TemplateData{
+		Data:   data,
+		IntMap: intMap,
+		Form:   forms.New(nil),
+	})
+}
+
+//AdminPostGuest updates a guest's contact details and notes
+func (m *Repository) AdminPostGuest(rw http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(rw, r, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(rw, r, http.StatusBadRequest)
+		return
+	}
+
+	guest, err := m.DB.GetGuestByID(id)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't find guest")
+		http.Redirect(rw, r, "/admin/guests", http.StatusSeeOther)
+		return
+	}
+
+	guest.FirstName = r.Form.Get("first_name")
+	guest.LastName = r.Form.Get("last_name")
+	guest.Phone = r.Form.Get("phone")
+	guest.Notes = r.Form.Get("notes")
+
+	err = m.DB.UpdateGuest(guest)
+	if err != nil {
+		helpers.ServerError(rw, r, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Changes saved")
+
+	http.Redirect(rw, r, fmt.Sprintf("/admin/guests/%d", id), http.StatusSeeOther)
+}
+
+//AdminMergeGuest merges a duplicate guest profile into the guest being viewed
+func (m *Repository) AdminMergeGuest(rw http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(rw, r, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(rw, r, http.StatusBadRequest)
+		return
+	}
+
+	sourceID, err := strconv.Atoi(r.Form.Get("source_id"))
+	if err != nil || sourceID == id {
+		m.App.Session.Put(r.Context(), "error", "Choose another guest to merge")
+		http.Redirect(rw, r, fmt.Sprintf("/admin/guests/%d", id), http.StatusSeeOther)
+		return
+	}
+
+	source, err := m.DB.GetGuestByID(sourceID)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Can't find guest %d", sourceID))
+		http.Redirect(rw, r, fmt.Sprintf("/admin/guests/%d", id), http.StatusSeeOther)
+		return
+	}
+
+	err = m.DB.MergeGuests(id, sourceID)
+	if err != nil {
+		helpers.ServerError(rw, r, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Merged %s into this profile", source.Email))
+
+	http.Redirect(rw, r, fmt.Sprintf("/admin/guests/%d", id), http.StatusSeeOther)
+}
+
+//maxImportSize is the largest CSV file accepted by the admin import page
+const maxImportSize = 5 << 20
+
+//newImportToken returns a random token naming an uploaded import file
+func newImportToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+//AdminImport shows the reservations import page
+func (m *Repository) AdminImport(rw http.ResponseWriter, r *http.Request) {
+	stringMap := make(map[string]string)
+	stringMap["columns"] = strings.Join(importer.Columns, ",")
+
+	render.Template(rw, r, "admin-import.page.html", &models.TemplateData{
+		StringMap: stringMap,
+	})
+}
+
+//AdminPostImport checks an uploaded CSV file and shows a dry-run report
+func (m *Repository) AdminPostImport(rw http.ResponseWriter, r *http.Request) {
+	err := r.ParseMultipartForm(maxImportSize)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't read the uploaded file")
+		http.Redirect(rw, r, "/admin/import", http.StatusSeeOther)
+		return
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Choose a CSV file to import")
+		http.Redirect(rw, r, "/admin/import", http.StatusSeeOther)
+		return
+	}
+	defer file.Close()
+
+	content, err := ioutil.ReadAll(file)
+	if err != nil {
+		helpers.ServerError(rw, r, err)
+		return
+	}
+
+	report, err := importer.DryRun(m.DB, m.App.StayRules, bytes.NewReader(content))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Can't import file: %s", err))
+		http.Redirect(rw, r, "/admin/import", http.StatusSeeOther)
+		return
+	}
+
+	//the file is kept in the database until the import is confirmed, and only its token in the session
+	token, err := newImportToken()
+	if err != nil {
+		helpers.ServerError(rw, r, err)
+		return
+	}
+
+	err = m.DB.SaveImportUpload(token, string(content))
+	if err != nil {
+		helpers.ServerError(rw, r, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "import_token", token)
+
+	data := make(map[string]interface{})
+	data["report"] = report
+
+	stringMap := make(map[string]string)
+	stringMap["columns"] = strings.Join(importer.Columns, ",")
+
+	render.Template(rw, r, "admin-import.page.html", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+//AdminPostImportCommit imports the valid rows of the file checked by AdminPostImport
+func (m *Repository) AdminPostImportCommit(rw http.ResponseWriter, r *http.Request) {
+	token := m.App.Session.PopString(r.Context(), "import_token")
+	if token == "" {
+		m.App.Session.Put(r.Context(), "error", "Upload the file again before importing it")
+		http.Redirect(rw, r, "/admin/import", http.StatusSeeOther)
+		return
+	}
+
+	content, err := m.DB.TakeImportUpload(token)
+	if err == sql.ErrNoRows {
+		m.App.Session.Put(r.Context(), "error", "Upload the file again before importing it")
+		http.Redirect(rw, r, "/admin/import", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(rw, r, err)
+		return
+	}
+
+	report, err := importer.Commit(m.DB, m.App.StayRules, strings.NewReader(content))
+	if err != nil {
+		helpers.ServerError(rw, r, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Imported %d reservations", report.ImportedCount()))
+
+	data := make(map[string]interface{})
+	data["report"] = report
+
+	stringMap := make(map[string]string)
+	stringMap["columns"] = strings.Join(importer.Columns, ",")
+
+	render.Template(rw, r, "admin-import.page.html", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+//AdminOutbox lists queued, sent and failed emails
+func (m *Repository) AdminOutbox(rw http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case models.OutboxPending, models.OutboxSent, models.OutboxDead:
+	default:
+		status = ""
+	}
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	messages, total, err := m.DB.SearchOutboxMessages(status, models.DefaultPageSize, (page-1)*models.DefaultPageSize)
+	if err != nil {
+		helpers.ServerError(rw, r, err)
+		return
+	}
+
+	query := url.Values{}
+	if status != "" {
+		query.Set("status", status)
+	}
+
+	data := make(map[string]interface{})
+	data["messages"] = messages
+	data["pagination"] = models.Pagination{
+		Page:     page,
+		PageSize: models.DefaultPageSize,
+		Total:    total,
+		Query:    query,
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["status"] = status
+
+	render.Template(rw, r, "admin-outbox.page.html", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+//AdminResendOutbox queues an outbox message to be sent again straight away
+func (m *Repository) AdminResendOutbox(rw http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(rw, r, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(rw, r, http.StatusBadRequest)
+		return
+	}
+
+	redirect := "/admin/outbox"
+	if status := r.Form.Get("status"); status != "" {
+		redirect += "?" + url.Values{"status": {status}}.Encode()
+	}
+
+	msg, err := m.DB.GetOutboxMessageByID(id)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't find email")
+		http.Redirect(rw, r, redirect, http.StatusSeeOther)
+		return
+	}
+
+	msg.Status = models.OutboxPending
+	msg.Attempts = 0
+	msg.NextAttemptAt = time.Now()
+	msg.LastError = ""
+	msg.SentAt = time.Time{}
+
+	err = m.DB.UpdateOutboxMessage(msg)
+	if err != nil {
+		helpers.ServerError(rw, r, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Email %d queued to be sent again", id))
+
+	http.Redirect(rw, r, redirect, http.StatusSeeOther)
+}
+
+//AdminEmailSchedules shows the emails sent automatically before and after stays
+func (m *Repository) AdminEmailSchedules(rw http.ResponseWriter, r *http.Request) {
+	schedules, err := m.DB.AllEmailSchedules()
+	if err != nil {
+		helpers.ServerError(rw, r, err)
+		return
+	}
+
+	templates, err := render.MailTemplateNames()
+	if err != nil {
+		helpers.ServerError(rw, r, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["schedules"] = schedules
+	data["templates"] = templates
+
+	render.Template(rw, r, "admin-email-schedules.page.html", &models.TemplateData{
+		Data: data,
+		Form: forms.New(nil),
+	})
+}
+
+//AdminPostEmailSchedule updates the template, timing and state of a scheduled email
+func (m *Repository) AdminPostEmailSchedule(rw http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(rw, r, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(rw, r, http.StatusBadRequest)
+		return
+	}
+
+	schedule, err := m.DB.GetEmailScheduleByID(id)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't find scheduled email")
+		http.Redirect(rw, r, "/admin/email-schedules", http.StatusSeeOther)
+		return
+	}
+
+	templates, err := render.MailTemplateNames()
+	if err != nil {
+		helpers.ServerError(rw, r, err)
+		return
+	}
+
+	days, err := strconv.Atoi(r.Form.Get("days"))
+	if err != nil || days < 0 || days > 365 {
+		m.App.Session.Put(r.Context(), "error", "Days must be a number from 0 to 365")
+		http.Redirect(rw, r, "/admin/email-schedules", http.StatusSeeOther)
+		return
+	}
+
+	tmpl := r.Form.Get("template")
+	known := false
+	for _, name := range templates {
+		if name == tmpl {
+			known = true
+		}
+	}
+	if !known {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Unknown email template %q", tmpl))
+		http.Redirect(rw, r, "/admin/email-schedules", http.StatusSeeOther)
+		return
+	}
+
+	switch r.Form.Get("when") {
+	case "before-arrival":
+		schedule.Anchor, schedule.OffsetDays = models.AnchorArrival, -days
+	case "after-arrival":
+		schedule.Anchor, schedule.OffsetDays = models.AnchorArrival, days
+	case "before-departure":
+		schedule.Anchor, schedule.OffsetDays = models.AnchorDeparture, -days
+	case "after-departure":
+		schedule.Anchor, schedule.OffsetDays = models.AnchorDeparture, days
+	default:
+		m.App.Session.Put(r.Context(), "error", "Choose when the email is sent")
+		http.Redirect(rw, r, "/admin/email-schedules", http.StatusSeeOther)
+		return
+	}
+
+	if name := strings.TrimSpace(r.Form.Get("name")); name != "" {
+		schedule.Name = name
+	}
+	schedule.Template = tmpl
+	schedule.Enabled = r.Form.Get("enabled") != ""
+
+	err = m.DB.UpdateEmailSchedule(schedule)
+	if err != nil {
+		helpers.ServerError(rw, r, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Saved %s", schedule.Name))
+
+	http.Redirect(rw, r, "/admin/email-schedules", http.StatusSeeOther)
+}
@@ -1,15 +1,22 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/Rha02/bookings/internal/i18n"
 	"github.com/Rha02/bookings/internal/models"
+	"github.com/go-chi/chi/v5"
 )
 
 // type postData struct {
@@ -36,9 +43,16 @@ var theTests = []struct {
 	{"new-res", "/admin/reservations-new", "GET", http.StatusOK},
 	{"all-res", "/admin/reservations-all", "GET", http.StatusOK},
 	{"show-res", "/admin/reservations/new/1/show", "GET", http.StatusOK},
+	{"import", "/admin/import", "GET", http.StatusOK},
+	{"guests", "/admin/guests", "GET", http.StatusOK},
+	{"show-guest", "/admin/guests/1", "GET", http.StatusOK},
+	{"outbox", "/admin/outbox?status=dead", "GET", http.StatusOK},
+	{"email-schedules", "/admin/email-schedules", "GET", http.StatusOK},
 }
 
 func TestHandlers(t *testing.T) {
+	seedRepo(t)
+
 	routes := getRoutes()
 	ts := httptest.NewTLSServer(routes)
 	defer ts.Close()
@@ -85,9 +99,9 @@ var reservationTests = []struct {
 	{
 		name: "non-existent-room",
 		reservation: models.Reservation{
-			RoomID: 2,
+			RoomID: 99,
 			Room: models.Room{
-				ID:       2,
+				ID:       99,
 				RoomName: "Non-existent room",
 			},
 		},
@@ -98,6 +112,8 @@ var reservationTests = []struct {
 }
 
 func TestReservation(t *testing.T) {
+	memRepo.Reset()
+
 	for _, test := range reservationTests {
 		req, _ := http.NewRequest("GET", "/make-reservation", nil)
 		ctx := getCtx(req)
@@ -136,6 +152,8 @@ func TestReservation(t *testing.T) {
 var postReservationTests = []struct {
 	name               string
 	postData           url.Values
+	rules              []models.StayRule
+	fault              string
 	expectedStatusCode int
 	expectedLocation   string
 	expectedHTML       string
@@ -210,7 +228,7 @@ var postReservationTests = []struct {
 			"last_name":  {"Clyde"},
 			"email":      {"jclyde@bookings.loc"},
 			"phone":      {"123123123"},
-			"room_id":    {"2"},
+			"room_id":    {"99"},
 		},
 		expectedStatusCode: http.StatusSeeOther,
 		expectedLocation:   "/",
@@ -229,6 +247,20 @@ var postReservationTests = []struct {
 		expectedStatusCode: http.StatusOK,
 		expectedHTML:       `action="/make-reservation"`,
 	},
+	{
+		name: "last-name-too-long",
+		postData: url.Values{
+			"start_date": {"01-01-2050"},
+			"end_date":   {"01-02-2050"},
+			"first_name": {"Joseph"},
+			"last_name":  {strings.Repeat("Clyde", 60)},
+			"email":      {"jclyde@bookings.loc"},
+			"phone":      {"123123123"},
+			"room_id":    {"1"},
+		},
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       `This field must be at most 255 characters long`,
+	},
 	{
 		name: "failed-to-insert-reservation",
 		postData: url.Values{
@@ -238,13 +270,58 @@ var postReservationTests = []struct {
 			"last_name":  {"Clyde"},
 			"email":      {"jclyde@bookings.loc"},
 			"phone":      {"123123123"},
-			"room_id":    {"3"},
+			"room_id":    {"1"},
+		},
+		fault:              "BookReservation",
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/",
+	},
+	{
+		name: "failed-to-get-room",
+		postData: url.Values{
+			"start_date": {"01-01-2050"},
+			"end_date":   {"01-02-2050"},
+			"first_name": {"Joseph"},
+			"last_name":  {"Clyde"},
+			"email":      {"jclyde@bookings.loc"},
+			"phone":      {"123123123"},
+			"room_id":    {"1"},
+		},
+		fault:              "GetRoomByID",
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/",
+	},
+	{
+		name: "end-before-start",
+		postData: url.Values{
+			"start_date": {"01-02-2050"},
+			"end_date":   {"01-01-2050"},
+			"first_name": {"Joseph"},
+			"last_name":  {"Clyde"},
+			"email":      {"jclyde@bookings.loc"},
+			"phone":      {"123123123"},
+			"room_id":    {"1"},
 		},
 		expectedStatusCode: http.StatusSeeOther,
 		expectedLocation:   "/",
 	},
 	{
-		name: "failed-to-insert-room-restriction",
+		name: "broken-stay-rule",
+		postData: url.Values{
+			"start_date": {"01-01-2050"},
+			"end_date":   {"01-02-2050"},
+			"first_name": {"Joseph"},
+			"last_name":  {"Clyde"},
+			"email":      {"jclyde@bookings.loc"},
+			"phone":      {"123123123"},
+			"room_id":    {"1"},
+		},
+		rules:              []models.StayRule{{MinNights: 2}},
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/search-availability",
+	},
+	{
+		name: "failed-to-check-buffer",
 		postData: url.Values{
 			"start_date": {"01-01-2050"},
 			"end_date":   {"01-02-2050"},
@@ -252,15 +329,25 @@ var postReservationTests = []struct {
 			"last_name":  {"Clyde"},
 			"email":      {"jclyde@bookings.loc"},
 			"phone":      {"123123123"},
-			"room_id":    {"1000"},
+			"room_id":    {"1"},
 		},
+		rules:              []models.StayRule{{BufferNights: 1}},
+		fault:              "GetRestrictionsForRoomByDate",
 		expectedStatusCode: http.StatusSeeOther,
 		expectedLocation:   "/",
 	},
 }
 
 func TestPostReservation(t *testing.T) {
+	defer func() { app.StayRules = nil }()
+
 	for _, test := range postReservationTests {
+		memRepo.Reset()
+		app.StayRules = test.rules
+		if test.fault != "" {
+			memRepo.Fail(test.fault, errors.New("some error"))
+		}
+
 		var req *http.Request
 
 		if test.postData != nil {
@@ -303,8 +390,12 @@ func TestPostReservation(t *testing.T) {
 var postAvailabilityTests = []struct {
 	name               string
 	postData           url.Values
+	blockedRooms       []int
+	rules              []models.StayRule
+	fault              string
 	expectedStatusCode int
 	expectedLocation   string
+	expectedHTML       string
 }{
 	{
 		name: "valid-post",
@@ -340,18 +431,20 @@ var postAvailabilityTests = []struct {
 	{
 		name: "error-searching-availability",
 		postData: url.Values{
-			"start": {"01-01-3000"},
+			"start": {"01-01-2050"},
 			"end":   {"01-02-2050"},
 		},
+		fault:              "SearchAvailabilityForAllRooms",
 		expectedStatusCode: http.StatusSeeOther,
 		expectedLocation:   "/",
 	},
 	{
 		name: "error-searching-availability",
 		postData: url.Values{
-			"start": {"01-01-3000"},
+			"start": {"01-01-2050"},
 			"end":   {"01-02-2050"},
 		},
+		fault:              "SearchAvailabilityForAllRooms",
 		expectedStatusCode: http.StatusSeeOther,
 		expectedLocation:   "/",
 	},
@@ -359,15 +452,76 @@ var postAvailabilityTests = []struct {
 		name: "rooms-not-available",
 		postData: url.Values{
 			"start": {"01-01-2050"},
-			"end":   {"01-01-2100"},
+			"end":   {"01-02-2050"},
+		},
+		blockedRooms:       []int{1, 2},
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       `/book-room?id=1&s=01-02-2050&e=01-03-2050`,
+	},
+	{
+		name: "error-suggesting-dates",
+		postData: url.Values{
+			"start": {"01-01-2050"},
+			"end":   {"01-02-2050"},
+		},
+		blockedRooms:       []int{1, 2},
+		fault:              "GetRestrictionsForRoomByDate",
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/search-availability",
+	},
+	{
+		name: "end-before-start",
+		postData: url.Values{
+			"start": {"01-02-2050"},
+			"end":   {"01-01-2050"},
+		},
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/",
+	},
+	{
+		name: "start-in-past",
+		postData: url.Values{
+			"start": {"01-01-2020"},
+			"end":   {"01-02-2020"},
+		},
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/",
+	},
+	{
+		name: "stay-rule-for-one-room",
+		postData: url.Values{
+			"start": {"01-01-2050"},
+			"end":   {"01-02-2050"},
+		},
+		rules:              []models.StayRule{{RoomIDs: []int{1}, MinNights: 2}},
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       `href="/choose-room/2"`,
+	},
+	{
+		name: "stay-rule-for-every-room",
+		postData: url.Values{
+			"start": {"01-01-2050"},
+			"end":   {"01-02-2050"},
 		},
+		rules:              []models.StayRule{{MinNights: 2}},
 		expectedStatusCode: http.StatusSeeOther,
 		expectedLocation:   "/search-availability",
 	},
 }
 
 func TestPostAvailability(t *testing.T) {
+	defer func() { app.StayRules = nil }()
+
 	for _, e := range postAvailabilityTests {
+		memRepo.Reset()
+		app.StayRules = e.rules
+		for _, roomID := range e.blockedRooms {
+			memRepo.InsertBlockForRoom(roomID, time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC))
+		}
+		if e.fault != "" {
+			memRepo.Fail(e.fault, errors.New("some error"))
+		}
+
 		var req *http.Request
 
 		if e.postData != nil {
@@ -397,6 +551,106 @@ func TestPostAvailability(t *testing.T) {
 				t.Errorf("failed %s: expected location %s, but got %s", e.name, e.expectedLocation, actualLoc.String())
 			}
 		}
+
+		if e.expectedHTML != "" && !strings.Contains(rr.Body.String(), e.expectedHTML) {
+			t.Errorf("failed %s: expected %s in the page", e.name, e.expectedHTML)
+		}
+	}
+}
+
+var availabilityJSONTests = []struct {
+	name            string
+	postData        url.Values
+	blockedRooms    []int
+	expectedOK      bool
+	expectedMessage string
+}{
+	{"available", url.Values{"start": {"01-01-2050"}, "end": {"01-02-2050"}, "room_id": {"1"}}, nil, true, "Available!"},
+	{"not-available", url.Values{"start": {"01-01-2050"}, "end": {"01-02-2050"}, "room_id": {"1"}}, []int{1}, false, "Not available"},
+	{"invalid-start-date", url.Values{"start": {"2050-01-01"}, "end": {"01-02-2050"}, "room_id": {"1"}}, nil, false, "Arrival date: Invalid date, use mm-dd-yyyy"},
+	{"missing-end-date", url.Values{"start": {"01-01-2050"}, "room_id": {"1"}}, nil, false, "Departure date: This field cannot be blank"},
+	{"end-before-start", url.Values{"start": {"01-02-2050"}, "end": {"01-01-2050"}, "room_id": {"1"}}, nil, false, "Departure date: This date must be after the start date"},
+	{"too-long", url.Values{"start": {"01-01-2050"}, "end": {"01-02-2051"}, "room_id": {"1"}}, nil, false, "Departure date: This date must be at most 365 days after the start date"},
+}
+
+func TestAvailabilityJSON(t *testing.T) {
+	for _, e := range availabilityJSONTests {
+		memRepo.Reset()
+		for _, roomID := range e.blockedRooms {
+			memRepo.InsertBlockForRoom(roomID, time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC))
+		}
+
+		req, _ := http.NewRequest("POST", "/search-availability-json", strings.NewReader(e.postData.Encode()))
+		req = req.WithContext(getCtx(req))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AvailabilityJSON)
+
+		handler.ServeHTTP(rr, req)
+
+		var resp jsonResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed %s: cannot parse response: %s", e.name, err)
+		}
+
+		if resp.OK != e.expectedOK || resp.Message != e.expectedMessage {
+			t.Errorf("failed %s: expected ok %t and message %q, got %t and %q", e.name, e.expectedOK, e.expectedMessage, resp.OK, resp.Message)
+		}
+	}
+}
+
+var bookedDatesTests = []struct {
+	name               string
+	query              string
+	fault              string
+	expectedStatusCode int
+	expectedBooked     []string
+}{
+	{"room", "room_id=1&start=01-01-2050&end=01-05-2050", "", http.StatusOK, []string{"01-01-2050", "01-02-2050"}},
+	{"every-room", "start=01-01-2050&end=01-05-2050", "", http.StatusOK, []string{}},
+	{"default-window", "room_id=1", "", http.StatusOK, []string{}},
+	{"invalid-start-date", "room_id=1&start=2050-01-01&end=01-05-2050", "", http.StatusBadRequest, nil},
+	{"end-before-start", "room_id=1&start=01-05-2050&end=01-01-2050", "", http.StatusBadRequest, nil},
+	{"window-too-long", "room_id=1&start=01-01-2050&end=01-05-2051", "", http.StatusBadRequest, nil},
+	{"invalid-room-id", "room_id=one", "", http.StatusBadRequest, nil},
+	{"unknown-room", "room_id=9", "", http.StatusNotFound, nil},
+	{"error-getting-restrictions", "room_id=1", "GetRestrictionsForRoomByDate", http.StatusInternalServerError, nil},
+}
+
+func TestBookedDates(t *testing.T) {
+	for _, e := range bookedDatesTests {
+		seedRepo(t)
+		if e.fault != "" {
+			memRepo.Fail(e.fault, errors.New("some error"))
+		}
+
+		req, _ := http.NewRequest("GET", "/booked-dates?"+e.query, nil)
+		req = req.WithContext(getCtx(req))
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.BookedDates)
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: expected status %d, got status %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		var resp jsonBookedDates
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed %s: cannot parse response: %s", e.name, err)
+		}
+
+		if resp.OK != (e.expectedStatusCode == http.StatusOK) {
+			t.Errorf("failed %s: expected ok %t, got %t", e.name, !resp.OK, resp.OK)
+		}
+
+		if e.expectedBooked != nil && strings.Join(resp.Booked, ",") != strings.Join(e.expectedBooked, ",") {
+			t.Errorf("failed %s: expected booked %v, got %v", e.name, e.expectedBooked, resp.Booked)
+		}
 	}
 }
 
@@ -553,9 +807,23 @@ var bookRoomTests = []struct {
 		expectedStatusCode: http.StatusSeeOther,
 		expectedLocation:   "/",
 	},
+	{
+		name:               "invalid-dates",
+		urlQuery:           "/book-room?s=2050-01-01&e=01-02-2050&id=1",
+		reservation:        models.Reservation{},
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/",
+	},
+	{
+		name:               "end-before-start",
+		urlQuery:           "/book-room?s=01-02-2050&e=01-01-2050&id=1",
+		reservation:        models.Reservation{},
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/",
+	},
 	{
 		name:               "invalid-room-id",
-		urlQuery:           "/book-room?s=01-01-2050&e=01-02-2050&id=2",
+		urlQuery:           "/book-room?s=01-01-2050&e=01-02-2050&id=99",
 		reservation:        models.Reservation{},
 		expectedStatusCode: http.StatusSeeOther,
 		expectedLocation:   "/",
@@ -563,6 +831,8 @@ var bookRoomTests = []struct {
 }
 
 func TestBookRoom(t *testing.T) {
+	memRepo.Reset()
+
 	for _, e := range bookRoomTests {
 		req, _ := http.NewRequest("GET", e.urlQuery, nil)
 
@@ -621,6 +891,13 @@ var loginTests = []struct {
 }
 
 func TestLogin(t *testing.T) {
+	memRepo.Reset()
+
+	_, err := memRepo.UpsertUser(models.User{Email: "test@test.loc", AccessLevel: 3}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	for _, test := range loginTests {
 		postedData := url.Values{}
 		postedData.Add("email", test.email)
@@ -737,6 +1014,8 @@ var adminPostShowReservationTests = []struct {
 }
 
 func TestAdminPostShowReservation(t *testing.T) {
+	seedRepo(t)
+
 	for _, e := range adminPostShowReservationTests {
 		var req *http.Request
 
@@ -770,6 +1049,17 @@ func TestAdminPostShowReservation(t *testing.T) {
 			}
 		}
 	}
+
+	res, err := memRepo.GetReservationByID(1)
+	if err != nil || res.Email != "joseph@clyde.com" || res.Phone != "1234567890" {
+		t.Errorf("reservation was not updated: %+v (err %v)", res, err)
+	}
+
+	//the new email moves the stay to its own guest profile
+	guests, _, _ := memRepo.SearchGuests("joseph@clyde.com", 10, 0)
+	if len(guests) != 1 || guests[0].ID != res.GuestID || guests[0].StayCount != 1 || res.GuestID == 1 {
+		t.Errorf("expected the reservation to be linked to a new guest, got guest %d and %+v", res.GuestID, guests)
+	}
 }
 
 var adminPostReservationsCalendarTests = []struct {
@@ -783,10 +1073,10 @@ var adminPostReservationsCalendarTests = []struct {
 		name: "valid-post",
 		uri:  "/admin/reservations-calendar?y=2030&m=7",
 		postData: url.Values{
-			"add_block_2_7-25-2030":    {"1"},
-			"remove_block_1_7-20-2030": {"1"},
-			"m":                        {"7"},
-			"y":                        {"2030"},
+			"add_block_2_07-25-2030":    {"1"},
+			"remove_block_1_07-20-2030": {"1"},
+			"m":                         {"7"},
+			"y":                         {"2030"},
 		},
 		expectedStatusCode: http.StatusSeeOther,
 		expectedLocation:   "/admin/reservations-calendar?y=2030&m=7",
@@ -795,6 +1085,10 @@ var adminPostReservationsCalendarTests = []struct {
 
 func TestAdminPostReservationsCalendar(t *testing.T) {
 	for _, e := range adminPostReservationsCalendarTests {
+		memRepo.Reset()
+		memRepo.InsertBlockForRoom(1, time.Date(2030, 7, 20, 0, 0, 0, 0, time.UTC))
+		memRepo.InsertBlockForRoom(1, time.Date(2030, 7, 30, 0, 0, 0, 0, time.UTC))
+
 		var req *http.Request
 
 		if e.postData != nil {
@@ -807,10 +1101,11 @@ func TestAdminPostReservationsCalendar(t *testing.T) {
 		req = req.WithContext(ctx)
 
 		blockMap := make(map[string]int)
-		blockMap["7-30-2030"] = 1
-		blockMap["7-20-2030"] = 1
+		blockMap["07-20-2030"] = 1
+		blockMap["07-30-2030"] = 2
 
 		session.Put(ctx, "block_map_1", blockMap)
+		session.Put(ctx, "block_map_2", map[string]int{})
 
 		req.RequestURI = e.uri
 
@@ -832,82 +1127,660 @@ func TestAdminPostReservationsCalendar(t *testing.T) {
 				t.Errorf("failed %s: expected location %s, got location %s", e.name, e.expectedLocation, actualLoc.String())
 			}
 		}
+
+		//the checked block is kept, the unchecked one removed and the new one added
+		var nights = []struct {
+			roomID    int
+			day       int
+			available bool
+		}{
+			{1, 20, false},
+			{1, 30, true},
+			{2, 25, false},
+		}
+
+		for _, n := range nights {
+			start := time.Date(2030, 7, n.day, 0, 0, 0, 0, time.UTC)
+			available, _ := memRepo.CheckAvailabilityByDatesByRoomID(start, start.AddDate(0, 0, 1), n.roomID)
+			if available != n.available {
+				t.Errorf("failed %s: room %d on July %d: expected available %t", e.name, n.roomID, n.day, n.available)
+			}
+		}
 	}
 }
 
-// var adminProcessResTests = []struct {
-// 	name               string
-// 	query              string
-// 	expectedStatusCode int
-// 	expectedLocation   string
-// }{
-// 	{
-// 		name:               "process-res-from-cal",
-// 		query:              "?y=2050&m=7",
-// 		expectedStatusCode: http.StatusSeeOther,
-// 		expectedLocation:   "/admin/reservations-calendar?y=2050&m=7",
-// 	},
-// 	{
-// 		name:               "process-res-from-other-src",
-// 		query:              "",
-// 		expectedStatusCode: http.StatusSeeOther,
-// 		expectedLocation:   "/admin/reservations-new",
-// 	},
-// }
+func TestAdminPostReservationsCalendar_StayBuffer(t *testing.T) {
+	memRepo.Reset()
+	app.StayRules = []models.StayRule{{Name: "Cleaning", RoomIDs: []int{2}, MinNights: 3, BufferNights: 2}}
+	defer func() { app.StayRules = nil }()
 
-// func TestAdminProcessReservation(t *testing.T) {
-// 	for _, e := range adminProcessResTests {
-// 		req, _ := http.NewRequest("GET", fmt.Sprintf("/admin/process-reservation/cal/1/do%s", e.query), nil)
+	_, err := memRepo.BookReservation(models.Reservation{
+		FirstName: "Joseph", LastName: "Clyde", Email: "jclyde@bookings.loc", RoomID: 2,
+		StartDate: time.Date(2030, 7, 10, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2030, 7, 12, 0, 0, 0, 0, time.UTC),
+	}, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-// 		ctx := getCtx(req)
-// 		req = req.WithContext(ctx)
+	postData := url.Values{
+		"add_block_2_07-13-2030": {"1"},
+		"add_block_2_07-20-2030": {"1"},
+		"m":                      {"7"},
+		"y":                      {"2030"},
+	}
 
-// 		handler := http.HandlerFunc(Repo.AdminProcessReservation)
+	req, _ := http.NewRequest("POST", "/admin/reservations-calendar", strings.NewReader(postData.Encode()))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-// 		rr := httptest.NewRecorder()
+	session.Put(ctx, "block_map_1", map[string]int{})
+	session.Put(ctx, "block_map_2", map[string]int{})
 
-// 		handler.ServeHTTP(rr, req)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminPostReservationsCalendar).ServeHTTP(rr, req)
 
-// 		if rr.Code != e.expectedStatusCode {
-// 			t.Errorf("failed %s: expected status %d, got status %d", e.name, e.expectedStatusCode, rr.Code)
-// 		}
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("expected status %d, got %d", http.StatusSeeOther, rr.Code)
+	}
 
-// 		if e.expectedLocation != "" {
-// 			actualLoc, _ := rr.Result().Location()
+	//the block inside the buffer after the stay is refused, and the minimum stay does not apply to blocks
+	var nights = []struct {
+		day       int
+		available bool
+	}{
+		{13, true},
+		{20, false},
+	}
 
-// 			if actualLoc.String() != e.expectedLocation {
-// 				t.Errorf("failed %s: expected location %s, got location %s", e.name, e.expectedLocation, actualLoc.String())
-// 			}
-// 		}
-// 	}
-// }
+	for _, n := range nights {
+		start := time.Date(2030, 7, n.day, 0, 0, 0, 0, time.UTC)
+		available, _ := memRepo.CheckAvailabilityByDatesByRoomID(start, start.AddDate(0, 0, 1), 2)
+		if available != n.available {
+			t.Errorf("room 2 on July %d: expected available %t", n.day, n.available)
+		}
+	}
 
-func getCtx(req *http.Request) context.Context {
-	ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
-	if err != nil {
-		log.Println(err)
+	msg := session.GetString(ctx, "error")
+	if msg != "Blocks not added for room 2 on 07-13-2030: This room needs 2 nights free between stays" {
+		t.Errorf("expected the refused block to be reported, got %q", msg)
 	}
-	return ctx
 }
 
-// func TestRepository_AvailabilityJSON(t *testing.T) {
-// 	reqBody := "start=01-01-2050"
-// 	reqBody = fmt.Sprintf("%s&%s", reqBody, "end=01-02-2050")
-// 	reqBody = fmt.Sprintf("%s&%s", reqBody, "room_id=1")
+var adminReservationListTests = []struct {
+	name         string
+	url          string
+	empty        bool
+	expectedHTML string
+}{
+	{
+		name:         "all-reservations",
+		url:          "/admin/reservations-all",
+		empty:        true,
+		expectedHTML: "No reservations found",
+	},
+	{
+		name:         "all-reservations-filtered",
+		url:          "/admin/reservations-all?q=clyde&room=1&from=01-01-2050&to=02-01-2050&status=processed&sort=last_name&dir=desc&page=2&size=10",
+		expectedHTML: `href="?dir=asc&amp;from=01-01-2050&amp;q=clyde&amp;room=1&amp;size=10&amp;sort=last_name&amp;status=processed&amp;to=02-01-2050"`,
+	},
+	{
+		name:         "search",
+		url:          "/admin/search?q=clyde",
+		expectedHTML: `href="/admin/reservations/all/1/show">Joseph Clyde</a>`,
+	},
+	{
+		name:         "search-no-results",
+		url:          "/admin/search?q=smith",
+		expectedHTML: "No reservations match",
+	},
+	{
+		name:         "guests",
+		url:          "/admin/guests?q=clyde",
+		expectedHTML: `href="/admin/guests/1">Joseph Clyde</a>`,
+	},
+	{
+		name:         "guest-profile",
+		url:          "/admin/guests/1",
+		expectedHTML: `<strong>Total nights:</strong> 5`,
+	},
+	{
+		name:         "outbox",
+		url:          "/admin/outbox?status=dead",
+		expectedHTML: `mailer: cannot connect to localhost:1025`,
+	},
+	{
+		name:         "email-schedules",
+		url:          "/admin/email-schedules",
+		expectedHTML: `<option value="post-stay-thanks" selected>post-stay-thanks</option>`,
+	},
+	{
+		name:         "new-reservations",
+		url:          "/admin/reservations-new?status=processed",
+		expectedHTML: `action="/admin/reservations-new"`,
+	},
+}
 
-// 	req, err := http.NewRequest("POST", "/search-availability-json", strings.NewReader(reqBody))
-// 	if err != nil {
-// 		t.Error("Error trying to create a request")
-// 	}
+func TestAdminReservationLists(t *testing.T) {
+	routes := getRoutes()
 
-// 	ctx := getCtx(req)
-// 	req = req.WithContext(ctx)
+	for _, e := range adminReservationListTests {
+		if e.empty {
+			memRepo.Reset()
+		} else {
+			seedRepo(t)
+		}
 
-// 	req.Header.Set("Content-Type", "x-www-form-urlencoded")
+		req, _ := http.NewRequest("GET", e.url, nil)
 
-// 	handler := http.HandlerFunc(Repo.AvailabilityJSON)
+		rr := httptest.NewRecorder()
 
-// 	rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("failed %s: expected status %d, got status %d", e.name, http.StatusOK, rr.Code)
+		}
+
+		html := rr.Body.String()
+		if !strings.Contains(html, e.expectedHTML) {
+			t.Errorf("failed %s: expected to find %s, but didn't", e.name, e.expectedHTML)
+		}
+	}
+}
+
+func TestReservationFilterFromQuery(t *testing.T) {
+	q := url.Values{}
+	q.Set("page", "3")
+	q.Set("size", "1000")
+	q.Set("sort", "last_name")
+	q.Set("dir", "desc")
+	q.Set("room", "2")
+	q.Set("from", "01-01-2050")
+	q.Set("to", "invalid")
+	q.Set("status", "deleted")
+	q.Set("q", " smith ")
+
+	f, kept := reservationFilterFromQuery(q)
+
+	if f.Page != 3 || f.PageSize != models.MaxPageSize || f.Offset() != 2*models.MaxPageSize {
+		t.Errorf("unexpected paging: page %d, size %d", f.Page, f.PageSize)
+	}
+
+	if f.Sort != "last_name" || !f.Desc {
+		t.Errorf("unexpected sorting: %s desc=%t", f.Sort, f.Desc)
+	}
+
+	if f.RoomID != 2 || f.From.IsZero() || !f.To.IsZero() || f.Status != "" || f.Query != "smith" {
+		t.Errorf("unexpected filters: %+v", f)
+	}
+
+	if kept.Get("to") != "" || kept.Get("status") != "" || kept.Get("q") != "smith" {
+		t.Errorf("invalid filters should not be kept in links: %v", kept)
+	}
+}
+
+func TestAdminShowGuest_Cancelled(t *testing.T) {
+	seedRepo(t)
+
+	if err := memRepo.CancelReservation(1); err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest("GET", "/admin/guests/1", nil)
+	rr := httptest.NewRecorder()
+	getRoutes().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got status %d", http.StatusOK, rr.Code)
+	}
+
+	//the cancelled stay is still listed but not counted
+	html := rr.Body.String()
+	for _, expected := range []string{
+		`<strong>Stays:</strong> 1`,
+		`<strong>Total nights:</strong> 3`,
+		`Cancelled Stays`,
+		`href="/admin/reservations/all/1/show"`,
+	} {
+		if !strings.Contains(html, expected) {
+			t.Errorf("expected to find %s, but didn't", expected)
+		}
+	}
+
+	guests, _, _ := memRepo.SearchGuests("jclyde", 10, 0)
+	if len(guests) != 1 || guests[0].StayCount != 1 || guests[0].LastArrival.Year() != 2020 {
+		t.Errorf("expected the cancelled stay to be left out of the guest list, got %+v", guests)
+	}
+}
+
+var adminGuestPostTests = []struct {
+	name             string
+	url              string
+	postData         url.Values
+	expectedLocation string
+}{
+	{
+		name: "update-guest",
+		url:  "/admin/guests/1",
+		postData: url.Values{
+			"first_name": {"Joseph"},
+			"last_name":  {"Clyde"},
+			"phone":      {"123123123"},
+			"notes":      {"Prefers a quiet room"},
+		},
+		expectedLocation: "/admin/guests/1",
+	},
+	{
+		name:             "update-missing-guest",
+		url:              "/admin/guests/99",
+		postData:         url.Values{"first_name": {"Joseph"}},
+		expectedLocation: "/admin/guests",
+	},
+	{
+		name:             "merge-guest",
+		url:              "/admin/guests/1/merge",
+		postData:         url.Values{"source_id": {"2"}},
+		expectedLocation: "/admin/guests/1",
+	},
+	{
+		name:             "merge-into-itself",
+		url:              "/admin/guests/1/merge",
+		postData:         url.Values{"source_id": {"1"}},
+		expectedLocation: "/admin/guests/1",
+	},
+	{
+		name:             "merge-missing-guest",
+		url:              "/admin/guests/1/merge",
+		postData:         url.Values{"source_id": {"99"}},
+		expectedLocation: "/admin/guests/1",
+	},
+}
+
+func TestAdminGuestPosts(t *testing.T) {
+	seedRepo(t)
+
+	routes := getRoutes()
+
+	for _, e := range adminGuestPostTests {
+		req, _ := http.NewRequest("POST", e.url, strings.NewReader(e.postData.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("failed %s: expected status %d, got status %d", e.name, http.StatusSeeOther, rr.Code)
+		}
+
+		actualLoc, _ := rr.Result().Location()
+		if actualLoc.String() != e.expectedLocation {
+			t.Errorf("failed %s: expected location %s, got location %s", e.name, e.expectedLocation, actualLoc.String())
+		}
+	}
+
+	guest, _ := memRepo.GetGuestByID(1)
+	if guest.Notes != "Prefers a quiet room" {
+		t.Errorf("guest was not updated: %+v", guest)
+	}
+
+	if _, err := memRepo.GetGuestByID(2); err == nil {
+		t.Error("guest 2 still exists after being merged")
+	}
+
+	reservations, _ := memRepo.GetReservationsForGuest(1)
+	if len(reservations) != 3 {
+		t.Errorf("expected the merged guest to have 3 reservations, got %d", len(reservations))
+	}
+}
+
+var adminResendOutboxTests = []struct {
+	name             string
+	url              string
+	postData         url.Values
+	expectedLocation string
+}{
+	{"resend", "/admin/outbox/1/resend", url.Values{"status": {"dead"}}, "/admin/outbox?status=dead"},
+	{"resend-missing", "/admin/outbox/99/resend", url.Values{}, "/admin/outbox"},
+}
+
+func TestAdminResendOutbox(t *testing.T) {
+	seedRepo(t)
+
+	routes := getRoutes()
+
+	for _, e := range adminResendOutboxTests {
+		req, _ := http.NewRequest("POST", e.url, strings.NewReader(e.postData.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("failed %s: expected status %d, got status %d", e.name, http.StatusSeeOther, rr.Code)
+		}
+
+		actualLoc, _ := rr.Result().Location()
+		if actualLoc.String() != e.expectedLocation {
+			t.Errorf("failed %s: expected location %s, got location %s", e.name, e.expectedLocation, actualLoc.String())
+		}
+	}
+
+	msg, _ := memRepo.GetOutboxMessageByID(1)
+	if msg.Status != models.OutboxPending || msg.Attempts != 0 || msg.LastError != "" {
+		t.Errorf("email was not queued again: %+v", msg)
+	}
+}
+
+var adminEmailScheduleTests = []struct {
+	name             string
+	url              string
+	postData         url.Values
+	expectedLocation string
+	expectedError    string
+}{
+	{
+		name:             "valid",
+		url:              "/admin/email-schedules/1",
+		postData:         url.Values{"template": {"pre-arrival-reminder"}, "days": {"5"}, "when": {"before-arrival"}, "enabled": {"1"}},
+		expectedLocation: "/admin/email-schedules",
+	},
+	{
+		name:             "missing-schedule",
+		url:              "/admin/email-schedules/3",
+		postData:         url.Values{"template": {"pre-arrival-reminder"}, "days": {"5"}, "when": {"before-arrival"}},
+		expectedLocation: "/admin/email-schedules",
+		expectedError:    "Can't find scheduled email",
+	},
+	{
+		name:             "unknown-template",
+		url:              "/admin/email-schedules/1",
+		postData:         url.Values{"template": {"non-existent"}, "days": {"5"}, "when": {"before-arrival"}},
+		expectedLocation: "/admin/email-schedules",
+		expectedError:    `Unknown email template "non-existent"`,
+	},
+	{
+		name:             "invalid-days",
+		url:              "/admin/email-schedules/1",
+		postData:         url.Values{"template": {"pre-arrival-reminder"}, "days": {"-2"}, "when": {"before-arrival"}},
+		expectedLocation: "/admin/email-schedules",
+		expectedError:    "Days must be a number from 0 to 365",
+	},
+	{
+		name:             "invalid-when",
+		url:              "/admin/email-schedules/1",
+		postData:         url.Values{"template": {"pre-arrival-reminder"}, "days": {"2"}, "when": {"whenever"}},
+		expectedLocation: "/admin/email-schedules",
+		expectedError:    "Choose when the email is sent",
+	},
+}
+
+func TestAdminPostEmailSchedule(t *testing.T) {
+	memRepo.Reset()
+
+	for _, e := range adminEmailScheduleTests {
+		req, _ := http.NewRequest("POST", e.url, strings.NewReader(e.postData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := chi.NewRouter()
+		handler.Post("/admin/email-schedules/{id}", Repo.AdminPostEmailSchedule)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("failed %s: expected status %d, got status %d", e.name, http.StatusSeeOther, rr.Code)
+		}
+
+		actualLoc, _ := rr.Result().Location()
+		if actualLoc.String() != e.expectedLocation {
+			t.Errorf("failed %s: expected location %s, got location %s", e.name, e.expectedLocation, actualLoc.String())
+		}
+
+		if msg := session.PopString(ctx, "error"); msg != e.expectedError {
+			t.Errorf("failed %s: expected error %q, got %q", e.name, e.expectedError, msg)
+		}
+	}
+}
+
+func TestAdminCancelReservation(t *testing.T) {
+	seedRepo(t)
+
+	routes := getRoutes()
+
+	req, _ := http.NewRequest("GET", "/admin/cancel-reservation/all/1/do", nil)
+	rr := httptest.NewRecorder()
+	routes.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("expected status %d, got %d", http.StatusSeeOther, rr.Code)
+	}
+
+	actualLoc, _ := rr.Result().Location()
+	if actualLoc.String() != "/admin/reservations-all" {
+		t.Errorf("expected location /admin/reservations-all, got %s", actualLoc.String())
+	}
+
+	res, _ := memRepo.GetReservationByID(1)
+	if !res.Cancelled() {
+		t.Error("reservation was not cancelled")
+	}
+
+	available, _ := memRepo.CheckAvailabilityByDatesByRoomID(res.StartDate, res.EndDate, res.RoomID)
+	if !available {
+		t.Error("room is still booked after the reservation was cancelled")
+	}
+}
+
+var adminPostImportTests = []struct {
+	name               string
+	file               string
+	expectedStatusCode int
+	expectedLocation   string
+	expectedHTML       string
+}{
+	{
+		name: "valid-file",
+		file: "first_name,last_name,email,phone,start_date,end_date,room_id\n" +
+			"Joseph,Clyde,jclyde@bookings.loc,123123123,01-01-2050,01-03-2050,1\n",
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "Room is already booked or blocked for these dates",
+	},
+	{
+		name:               "missing-file",
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/admin/import",
+	},
+	{
+		name:               "missing-column",
+		file:               "first_name,last_name\nJoseph,Clyde\n",
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/admin/import",
+	},
+}
+
+func TestAdminPostImport(t *testing.T) {
+	seedRepo(t)
+
+	for _, e := range adminPostImportTests {
+		body := new(bytes.Buffer)
+		writer := multipart.NewWriter(body)
+		if e.file != "" {
+			part, _ := writer.CreateFormFile("file", "reservations.csv")
+			part.Write([]byte(e.file))
+		}
+		writer.Close()
+
+		req, _ := http.NewRequest("POST", "/admin/import", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+
+		handler := http.HandlerFunc(Repo.AdminPostImport)
+
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: expected status %d, got status %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+
+		if e.expectedHTML != "" {
+			html := rr.Body.String()
+			if !strings.Contains(html, e.expectedHTML) {
+				t.Errorf("failed %s: expected to find %s, but didn't", e.name, e.expectedHTML)
+			}
+		}
+	}
+}
+
+func TestAdminPostImportCommit(t *testing.T) {
+	memRepo.Reset()
+
+	file := "first_name,last_name,email,phone,start_date,end_date,room_id\n" +
+		"Joseph,Clyde,jclyde@bookings.loc,123123123,01-01-2050,01-03-2050,1\n"
+
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("file", "reservations.csv")
+	part.Write([]byte(file))
+	writer.Close()
+
+	req, _ := http.NewRequest("POST", "/admin/import", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+
+	rr := httptest.NewRecorder()
+
+	http.HandlerFunc(Repo.AdminPostImport).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d for the upload, got status %d", http.StatusOK, rr.Code)
+	}
+
+	// only a token naming the upload is kept in the session
+	token := session.GetString(ctx, "import_token")
+	if token == "" || strings.Contains(token, "Clyde") {
+		t.Fatalf("expected a token for the upload in the session, got %q", token)
+	}
+
+	req, _ = http.NewRequest("POST", "/admin/import/commit", nil)
+	req = req.WithContext(ctx)
+
+	handler := http.HandlerFunc(Repo.AdminPostImportCommit)
+
+	rr = httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status %d, got status %d", http.StatusOK, rr.Code)
+	}
+
+	_, total, _ := memRepo.SearchReservations(models.ReservationFilter{Page: 1, PageSize: 10, Query: "clyde"})
+	if total != 1 {
+		t.Errorf("expected the reservation to be imported, found %d", total)
+	}
+
+	// the file can only be committed once, even with the same token
+	session.Put(ctx, "import_token", token)
+
+	rr = httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("expected status %d on second commit, got status %d", http.StatusSeeOther, rr.Code)
+	}
+}
+
+// var adminProcessResTests = []struct {
+// 	name               string
+// 	query              string
+// 	expectedStatusCode int
+// 	expectedLocation   string
+// }{
+// 	{
+// 		name:               "process-res-from-cal",
+// 		query:              "?y=2050&m=7",
+// 		expectedStatusCode: http.StatusSeeOther,
+// 		expectedLocation:   "/admin/reservations-calendar?y=2050&m=7",
+// 	},
+// 	{
+// 		name:               "process-res-from-other-src",
+// 		query:              "",
+// 		expectedStatusCode: http.StatusSeeOther,
+// 		expectedLocation:   "/admin/reservations-new",
+// 	},
+// }
+
+// func TestAdminProcessReservation(t *testing.T) {
+// 	for _, e := range adminProcessResTests {
+// 		req, _ := http.NewRequest("GET", fmt.Sprintf("/admin/process-reservation/cal/1/do%s", e.query), nil)
+
+// 		ctx := getCtx(req)
+// 		req = req.WithContext(ctx)
+
+// 		handler := http.HandlerFunc(Repo.AdminProcessReservation)
+
+// 		rr := httptest.NewRecorder()
+
+// 		handler.ServeHTTP(rr, req)
+
+// 		if rr.Code != e.expectedStatusCode {
+// 			t.Errorf("failed %s: expected status %d, got status %d", e.name, e.expectedStatusCode, rr.Code)
+// 		}
+
+// 		if e.expectedLocation != "" {
+// 			actualLoc, _ := rr.Result().Location()
+
+// 			if actualLoc.String() != e.expectedLocation {
+// 				t.Errorf("failed %s: expected location %s, got location %s", e.name, e.expectedLocation, actualLoc.String())
+// 			}
+// 		}
+// 	}
+// }
+
+func getCtx(req *http.Request) context.Context {
+	ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
+	if err != nil {
+		log.Println(err)
+	}
+	return ctx
+}
+
+// func TestRepository_AvailabilityJSON(t *testing.T) {
+// 	reqBody := "start=01-01-2050"
+// 	reqBody = fmt.Sprintf("%s&%s", reqBody, "end=01-02-2050")
+// 	reqBody = fmt.Sprintf("%s&%s", reqBody, "room_id=1")
+
+// 	req, err := http.NewRequest("POST", "/search-availability-json", strings.NewReader(reqBody))
+// 	if err != nil {
+// 		t.Error("Error trying to create a request")
+// 	}
+
+// 	ctx := getCtx(req)
+// 	req = req.WithContext(ctx)
+
+// 	req.Header.Set("Content-Type", "x-www-form-urlencoded")
+
+// 	handler := http.HandlerFunc(Repo.AvailabilityJSON)
+
+// 	rr := httptest.NewRecorder()
 
 // 	handler.ServeHTTP(rr, req)
 
@@ -974,3 +1847,282 @@ func getCtx(req *http.Request) context.Context {
 // 		t.Error("Expected to fail searching for availability, but it didn't")
 // 	}
 // }
+
+//TestBookingFlow books a room and checks that the booking shows up in later availability searches
+func TestBookingFlow(t *testing.T) {
+	memRepo.Reset()
+
+	routes := getRoutes()
+	dates := url.Values{
+		"start": {"03-10-2050"},
+		"end":   {"03-12-2050"},
+	}
+
+	searchAvailability := func() string {
+		req, _ := http.NewRequest("POST", "/search-availability", strings.NewReader(dates.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("search-availability: expected status %d, got status %d", http.StatusOK, rr.Code)
+		}
+
+		return rr.Body.String()
+	}
+
+	body := searchAvailability()
+	if !strings.Contains(body, `href="/choose-room/1"`) || !strings.Contains(body, `href="/choose-room/2"`) {
+		t.Fatal("expected both rooms to be available")
+	}
+
+	postData := url.Values{
+		"start_date": {"03-10-2050"},
+		"end_date":   {"03-12-2050"},
+		"first_name": {"Joseph"},
+		"last_name":  {"Clyde"},
+		"email":      {"jclyde@bookings.loc"},
+		"phone":      {"123123123"},
+		"room_id":    {"1"},
+	}
+
+	req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(postData.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	routes.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("make-reservation: expected status %d, got status %d", http.StatusOK, rr.Code)
+	}
+
+	for roomID, expected := range map[string]bool{"1": false, "2": true} {
+		form := url.Values{
+			"start":   dates["start"],
+			"end":     dates["end"],
+			"room_id": {roomID},
+		}
+
+		req, _ := http.NewRequest("POST", "/search-availability-json", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		var j jsonResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &j); err != nil {
+			t.Fatal("failed to parse json")
+		}
+
+		if j.OK != expected {
+			t.Errorf("room %s: expected available %t, got %t", roomID, expected, j.OK)
+		}
+	}
+
+	body = searchAvailability()
+	if strings.Contains(body, `href="/choose-room/1"`) || !strings.Contains(body, `href="/choose-room/2"`) {
+		t.Error("expected only Colonel's Suite to be available")
+	}
+
+	_, total, _ := memRepo.SearchReservations(models.ReservationFilter{Page: 1, PageSize: 10})
+	if total != 1 {
+		t.Errorf("expected 1 reservation, got %d", total)
+	}
+
+	_, queued, _ := memRepo.SearchOutboxMessages("", 10, 0)
+	if queued != 2 {
+		t.Errorf("expected 2 emails to be queued, got %d", queued)
+	}
+}
+
+var setLocaleTests = []struct {
+	name               string
+	locale             string
+	referer            string
+	expectedStatusCode int
+	expectedLocation   string
+}{
+	{"back-to-page", "es", "http://example.com/about?x=1", http.StatusSeeOther, "/about?x=1"},
+	{"no-referer", "es", "", http.StatusSeeOther, "/"},
+	{"other-site", "es", "http://evil.example/about", http.StatusSeeOther, "/"},
+	{"unsupported", "xx", "http://example.com/about", http.StatusNotFound, ""},
+}
+
+func TestSetLocale(t *testing.T) {
+	for _, e := range setLocaleTests {
+		req := httptest.NewRequest("GET", "/locale/"+e.locale, nil)
+		req.Header.Set("Referer", e.referer)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+
+		handler := chi.NewRouter()
+		handler.Get("/locale/{locale}", Repo.SetLocale)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: expected status %d, got status %d", e.name, e.expectedStatusCode, rr.Code)
+			continue
+		}
+		if e.expectedStatusCode != http.StatusSeeOther {
+			if chosen := session.GetString(ctx, "locale"); chosen != "" {
+				t.Errorf("failed %s: expected no locale to be chosen, got %s", e.name, chosen)
+			}
+			continue
+		}
+
+		actualLoc, _ := rr.Result().Location()
+		if actualLoc.String() != e.expectedLocation {
+			t.Errorf("failed %s: expected location %s, got location %s", e.name, e.expectedLocation, actualLoc.String())
+		}
+		if chosen := session.GetString(ctx, "locale"); chosen != e.locale {
+			t.Errorf("failed %s: expected %s to be chosen, got %q", e.name, e.locale, chosen)
+		}
+	}
+}
+
+//TestLocalizedBooking books a room in Spanish, from the search to the emails sent
+func TestLocalizedBooking(t *testing.T) {
+	memRepo.Reset()
+	memRepo.InsertBlockForRoom(1, time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC))
+	memRepo.InsertBlockForRoom(2, time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	post := func(handler http.HandlerFunc, data url.Values) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/", strings.NewReader(data.Encode()))
+		req = req.WithContext(i18n.WithLocale(getCtx(req), "es"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := post(Repo.PostAvailability, url.Values{"start": {"01-01-2050"}, "end": {"01-02-2050"}})
+	for _, expected := range []string{
+		`<html lang="es">`,
+		"No hay habitaciones disponibles del 01-01-2050 al 01-02-2050. Las fechas libres más cercanas son:",
+		"del 2 de enero de 2050 al 3 de enero de 2050",
+		`/book-room?id=1&s=01-02-2050&e=01-03-2050`,
+		"Tu hogar lejos de casa",
+	} {
+		if !strings.Contains(rr.Body.String(), expected) {
+			t.Errorf("expected %q in the search results", expected)
+		}
+	}
+
+	guest := url.Values{
+		"start_date": {"01-02-2050"},
+		"end_date":   {"01-03-2050"},
+		"first_name": {"Jo"},
+		"last_name":  {"Clyde"},
+		"email":      {"jclyde@bookings.loc"},
+		"room_id":    {"1"},
+	}
+
+	rr = post(Repo.PostReservation, guest)
+	for _, expected := range []string{
+		"Este campo debe tener al menos 3 caracteres",
+		"Llegada: 2 de enero de 2050",
+		"Tu hogar lejos de casa",
+	} {
+		if !strings.Contains(rr.Body.String(), expected) {
+			t.Errorf("expected %q in the reservation form", expected)
+		}
+	}
+
+	guest.Set("first_name", "Joseph")
+	if rr = post(Repo.PostReservation, guest); rr.Code != http.StatusOK {
+		t.Fatalf("expected the reservation to be booked, got status %d", rr.Code)
+	}
+
+	reservations, _, _ := memRepo.SearchReservations(models.ReservationFilter{Page: 1, PageSize: 10})
+	if len(reservations) != 1 || reservations[0].Locale != "es" {
+		t.Fatalf("expected a reservation made in Spanish, got %+v", reservations)
+	}
+
+	messages, _, _ := memRepo.SearchOutboxMessages("", 10, 0)
+	subjects := map[string]string{}
+	for _, msg := range messages {
+		subjects[msg.Mail.To] = msg.Mail.Subject
+	}
+
+	if subjects["jclyde@bookings.loc"] != "Confirmación de reserva" {
+		t.Errorf("expected the guest to be sent a confirmation in Spanish, got %q", subjects["jclyde@bookings.loc"])
+	}
+	if subjects[app.Property.Email] != "Reservation Notification" {
+		t.Errorf("expected the property to be notified in English, got %q", subjects[app.Property.Email])
+	}
+}
+
+func TestLocalizedRules(t *testing.T) {
+	memRepo.Reset()
+	app.StayRules = []models.StayRule{{MinNights: 2}}
+	defer func() { app.StayRules = nil }()
+
+	data := url.Values{"start": {"01-01-2050"}, "end": {"01-02-2050"}, "room_id": {"1"}}
+	req, _ := http.NewRequest("POST", "/search-availability-json", strings.NewReader(data.Encode()))
+	req = req.WithContext(i18n.WithLocale(getCtx(req), "es"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AvailabilityJSON).ServeHTTP(rr, req)
+
+	var j jsonResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &j); err != nil {
+		t.Fatal("failed to parse json")
+	}
+
+	if j.OK || j.Rule != "La estancia mínima para estas fechas es de 2 noches" {
+		t.Errorf("expected the rule in Spanish, got %+v", j)
+	}
+}
+
+func TestLocalizedJSONMessages(t *testing.T) {
+	memRepo.Reset()
+	memRepo.InsertBlockForRoom(2, time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	//the locale is picked from the header as the Locale middleware does
+	localized := func(req *http.Request) *http.Request {
+		req.Header.Set("Accept-Language", "es-ES,es;q=0.9,en;q=0.5")
+		return req.WithContext(i18n.WithLocale(getCtx(req), i18n.Negotiate(req.Header.Get("Accept-Language"))))
+	}
+
+	var tests = []struct {
+		roomID  string
+		message string
+	}{
+		{"1", "¡Disponible!"},
+		{"2", "No disponible"},
+	}
+
+	for _, e := range tests {
+		data := url.Values{"start": {"01-01-2050"}, "end": {"01-02-2050"}, "room_id": {e.roomID}}
+		req, _ := http.NewRequest("POST", "/search-availability-json", strings.NewReader(data.Encode()))
+		req = localized(req)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AvailabilityJSON).ServeHTTP(rr, req)
+
+		var j jsonResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &j); err != nil {
+			t.Fatal("failed to parse json")
+		}
+
+		if j.Message != e.message {
+			t.Errorf("room %s: expected message %q, got %q", e.roomID, e.message, j.Message)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/booked-dates?room_id=99", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.BookedDates).ServeHTTP(rr, localized(req))
+
+	var j jsonBookedDates
+	if err := json.Unmarshal(rr.Body.Bytes(), &j); err != nil {
+		t.Fatal("failed to parse json")
+	}
+
+	if rr.Code != http.StatusNotFound || j.Message != "No se encontró la habitación" {
+		t.Errorf("expected the missing room in Spanish, got %d %q", rr.Code, j.Message)
+	}
+}
@@ -8,29 +8,43 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	texttemplate "text/template"
 	"time"
 
 	"github.com/Rha02/bookings/internal/config"
+	"github.com/Rha02/bookings/internal/i18n"
 	"github.com/Rha02/bookings/internal/models"
 	"github.com/Rha02/bookings/internal/render"
+	"github.com/Rha02/bookings/internal/repository/dbrepo"
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/chi/v5"
 	"github.com/justinas/nosurf"
+	"github.com/rs/zerolog"
 )
 
 var app config.AppConfig
 
+//memRepo is the repository behind the handlers under test
+var memRepo *dbrepo.MemoryRepo
+
 var session *scs.SessionManager
 
 var pathToTemplates = "./../../templates"
 
+var pathToMailTemplates = "./../../email-templates"
+
 var functions = template.FuncMap{
 	"humanDate":  render.HumanDate,
 	"formatDate": render.FormatDate,
 	"iterate":    render.Iterate,
 	"add":        render.Add,
+	"t":          i18n.T,
+	"date":       i18n.FormatDate,
+	"number":     i18n.FormatNumber,
+	"locales":    i18n.Locales,
 }
 
 func TestMain(m *testing.M) {
@@ -43,11 +57,7 @@ func TestMain(m *testing.M) {
 	//Change this to true when in production, keep it false when in development
 	app.InProduction = false
 
-	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-	app.InfoLog = infoLog
-
-	errorLog := log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
-	app.ErrorLog = errorLog
+	app.Logger = zerolog.New(os.Stdout).With().Timestamp().Logger()
 
 	session = scs.New()
 	session.Lifetime = 24 * time.Hour
@@ -57,13 +67,6 @@ func TestMain(m *testing.M) {
 
 	app.Session = session
 
-	mailChan := make(chan models.MailData)
-	app.MailChan = mailChan
-
-	defer close(mailChan)
-
-	listenForMail()
-
 	tc, err := CreateTestTemplateCache()
 	if err != nil {
 		log.Fatal("Cannot create template cache", err)
@@ -72,21 +75,26 @@ func TestMain(m *testing.M) {
 	app.TemplateCache = tc
 	app.UseCache = true
 
+	mtc, err := CreateTestMailTemplateCache()
+	if err != nil {
+		log.Fatal("Cannot create mail template cache", err)
+	}
+
+	app.MailTemplateCache = mtc
+
+	app.Property = models.Property{
+		Name:  "Fort Dagon Bed and Breakfast",
+		Email: "server@bookings.loc",
+	}
+
 	repo := NewTestRepo(&app)
+	memRepo = repo.DB.(*dbrepo.MemoryRepo)
 	NewHandlers(repo)
 	render.NewRenderer(&app)
 
 	os.Exit(m.Run())
 }
 
-func listenForMail() {
-	go func() {
-		for {
-			<-app.MailChan
-		}
-	}()
-}
-
 func getRoutes() http.Handler {
 	mux := chi.NewRouter()
 
@@ -124,6 +132,24 @@ func getRoutes() http.Handler {
 
 	mux.Get("/admin/process-reservation/{src}/{id}/do", Repo.AdminProcessReservation)
 	mux.Get("/admin/delete-reservation/{src}/{id}/do", Repo.AdminDeleteReservation)
+	mux.Get("/admin/cancel-reservation/{src}/{id}/do", Repo.AdminCancelReservation)
+
+	mux.Get("/admin/search", Repo.AdminSearch)
+
+	mux.Get("/admin/guests", Repo.AdminGuests)
+	mux.Get("/admin/guests/{id}", Repo.AdminShowGuest)
+	mux.Post("/admin/guests/{id}", Repo.AdminPostGuest)
+	mux.Post("/admin/guests/{id}/merge", Repo.AdminMergeGuest)
+
+	mux.Get("/admin/import", Repo.AdminImport)
+	mux.Post("/admin/import", Repo.AdminPostImport)
+	mux.Post("/admin/import/commit", Repo.AdminPostImportCommit)
+
+	mux.Get("/admin/outbox", Repo.AdminOutbox)
+	mux.Post("/admin/outbox/{id}/resend", Repo.AdminResendOutbox)
+
+	mux.Get("/admin/email-schedules", Repo.AdminEmailSchedules)
+	mux.Post("/admin/email-schedules/{id}", Repo.AdminPostEmailSchedule)
 
 	mux.Get("/contact", Repo.Contact)
 
@@ -134,6 +160,40 @@ func getRoutes() http.Handler {
 	return mux
 }
 
+//seedRepo restores the repository to a freshly migrated database and adds the bookings of Joseph Clyde:
+//reservations 1 and 2 of guest 1, for 2 and 3 nights, and reservation 3 made under another email, which
+//created guest 2. Each booking queued one email, and the first of those could not be delivered.
+func seedRepo(t *testing.T) {
+	memRepo.Reset()
+
+	bookings := []models.Reservation{
+		{FirstName: "Joseph", LastName: "Clyde", Email: "jclyde@bookings.loc", Phone: "123123123", RoomID: 1,
+			StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{FirstName: "Joseph", LastName: "Clyde", Email: "jclyde@bookings.loc", Phone: "123123123", RoomID: 2,
+			StartDate: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2020, 1, 4, 0, 0, 0, 0, time.UTC)},
+		{FirstName: "Joseph", LastName: "Clyde", Email: "joseph.clyde@example.com", RoomID: 2,
+			StartDate: time.Date(2051, 6, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2051, 6, 2, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, res := range bookings {
+		mail := models.MailData{To: res.Email, From: app.Property.Email, Subject: "Reservation Confirmation"}
+		if _, err := memRepo.BookReservation(res, 0, []models.MailData{mail}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msg, err := memRepo.GetOutboxMessageByID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.Status = models.OutboxDead
+	msg.Attempts = 8
+	msg.LastError = "mailer: cannot connect to localhost:1025"
+	if err = memRepo.UpdateOutboxMessage(msg); err != nil {
+		t.Fatal(err)
+	}
+}
+
 //NoSurf adds a CSRF protection to all POST requests
 func NoSurf(next http.Handler) http.Handler {
 	csrfHandler := nosurf.New(next)
@@ -186,3 +246,34 @@ func CreateTestTemplateCache() (map[string]*template.Template, error) {
 
 	return myCache, nil
 }
+
+//CreateTestMailTemplateCache creates an email template cache as a map
+func CreateTestMailTemplateCache() (map[string]*models.MailTemplate, error) {
+	myCache := map[string]*models.MailTemplate{}
+
+	pages, err := filepath.Glob(fmt.Sprintf("%s/*.mail.html", pathToMailTemplates))
+	if err != nil {
+		return myCache, err
+	}
+	for _, page := range pages {
+		name := strings.TrimSuffix(filepath.Base(page), ".mail.html")
+		textPage := fmt.Sprintf("%s/%s.mail.txt", pathToMailTemplates, name)
+
+		ht, err := template.New(filepath.Base(page)).Funcs(functions).ParseFiles(page, fmt.Sprintf("%s/basic.layout.html", pathToMailTemplates))
+		if err != nil {
+			return myCache, err
+		}
+
+		tt, err := texttemplate.New(filepath.Base(textPage)).Funcs(texttemplate.FuncMap(functions)).ParseFiles(textPage, fmt.Sprintf("%s/basic.layout.txt", pathToMailTemplates))
+		if err != nil {
+			return myCache, err
+		}
+
+		myCache[name] = &models.MailTemplate{
+			HTML: ht,
+			Text: tt,
+		}
+	}
+
+	return myCache, nil
+}
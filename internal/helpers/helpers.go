@@ -1,11 +1,11 @@
 package helpers
 
 import (
-	"fmt"
 	"net/http"
 	"runtime/debug"
 
 	"github.com/Rha02/bookings/internal/config"
+	"github.com/Rha02/bookings/internal/logging"
 )
 
 var app *config.AppConfig
@@ -15,14 +15,13 @@ func NewHelpers(a *config.AppConfig) {
 	app = a
 }
 
-func ClientError(rw http.ResponseWriter, status int) {
-	app.InfoLog.Println("Client error with status of", status)
+func ClientError(rw http.ResponseWriter, r *http.Request, status int) {
+	logging.FromRequest(r).Info().Int("status", status).Msg("client error")
 	http.Error(rw, http.StatusText(status), status)
 }
 
-func ServerError(rw http.ResponseWriter, err error) {
-	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
-	app.ErrorLog.Println(trace)
+func ServerError(rw http.ResponseWriter, r *http.Request, err error) {
+	logging.FromRequest(r).Error().Err(err).Str("stack", string(debug.Stack())).Msg("server error")
 	http.Error(rw, http.StatusText(500), 500)
 }
 
@@ -0,0 +1,241 @@
+package i18n
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Default is the locale used when no other is asked for or supported, and whose catalog fills the gaps of the others
+const Default = "en"
+
+//go:embed locales/*.json
+var files embed.FS
+
+//catalogs holds the messages of every supported locale by key
+var catalogs = mustLoad()
+
+func mustLoad() map[string]map[string]string {
+	catalogs, err := load()
+	if err != nil {
+		panic(err)
+	}
+	return catalogs
+}
+
+//load reads the message catalogs, one locales/<locale>.json file of keys and messages per locale
+func load() (map[string]map[string]string, error) {
+	names, err := files.ReadDir("locales")
+	if err != nil {
+		return nil, err
+	}
+
+	catalogs := map[string]map[string]string{}
+	for _, f := range names {
+		content, err := files.ReadFile(path.Join("locales", f.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		messages := map[string]string{}
+		if err = json.Unmarshal(content, &messages); err != nil {
+			return nil, fmt.Errorf("i18n: %s: %w", f.Name(), err)
+		}
+
+		catalogs[strings.TrimSuffix(f.Name(), ".json")] = messages
+	}
+
+	if _, ok := catalogs[Default]; !ok {
+		return nil, fmt.Errorf("i18n: no catalog for the default locale %s", Default)
+	}
+
+	return catalogs, nil
+}
+
+//Locales returns the supported locales, sorted
+func Locales() []string {
+	var locales []string
+	for locale := range catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+//Supported returns true if there is a catalog for the locale
+func Supported(locale string) bool {
+	_, ok := catalogs[locale]
+	return ok
+}
+
+//Negotiate returns the supported locale best matching an Accept-Language header, such as "es-MX,es;q=0.9,en;q=0.5",
+//or Default if none match. A language with a region matches the catalog of its language.
+func Negotiate(acceptLanguage string) string {
+	type choice struct {
+		tag string
+		q   float64
+	}
+
+	var choices []choice
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(part, ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				v, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil {
+					v = 0
+				}
+				q = v
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+
+		choices = append(choices, choice{tag, q})
+	}
+
+	sort.SliceStable(choices, func(i, j int) bool {
+		return choices[i].q > choices[j].q
+	})
+
+	for _, c := range choices {
+		if c.tag == "*" {
+			return Default
+		}
+		if Supported(c.tag) {
+			return c.tag
+		}
+		if i := strings.IndexAny(c.tag, "-_"); i > 0 && Supported(c.tag[:i]) {
+			return c.tag[:i]
+		}
+	}
+
+	return Default
+}
+
+//Message is text translated when it is shown, such as a message built before the locale of its reader is known.
+//Messages passed as arguments to T are translated into the same locale.
+type Message interface {
+	In(locale string) string
+}
+
+type message struct {
+	key  string
+	args []interface{}
+}
+
+func (m message) In(locale string) string {
+	return T(locale, m.key, m.args...)
+}
+
+//Msg returns the message with key, formatted with args when it is shown
+func Msg(key string, args ...interface{}) Message {
+	return message{key, args}
+}
+
+type count struct {
+	key string
+	n   int
+}
+
+func (c count) In(locale string) string {
+	return Plural(locale, c.key, c.n)
+}
+
+//Count returns the message of Plural for n, formatted when it is shown
+func Count(key string, n int) Message {
+	return count{key, n}
+}
+
+//T returns the message with key in the locale, formatted with args as by fmt.Sprintf. Messages missing from
+//the locale's catalog are taken from the default one, and the key itself is returned if that has none either.
+func T(locale, key string, args ...interface{}) string {
+	format, ok := catalogs[locale][key]
+	if !ok {
+		format, ok = catalogs[Default][key]
+	}
+	if !ok {
+		format = key
+	}
+
+	if len(args) == 0 {
+		return format
+	}
+
+	localized := make([]interface{}, len(args))
+	for i, arg := range args {
+		if m, ok := arg.(Message); ok {
+			arg = m.In(locale)
+		}
+		localized[i] = arg
+	}
+
+	return fmt.Sprintf(format, localized...)
+}
+
+//Plural returns the message with key.one for a count of 1 and key.other for any other count, formatted with n
+func Plural(locale, key string, n int) string {
+	if n == 1 {
+		return T(locale, key+".one", n)
+	}
+	return T(locale, key+".other", n)
+}
+
+//FormatDate returns the date of t as written in the locale, such as January 2, 2006 or 2 de enero de 2006
+func FormatDate(locale string, t time.Time) string {
+	return strings.NewReplacer(
+		"{day}", strconv.Itoa(t.Day()),
+		"{month}", T(locale, fmt.Sprintf("month.%d", int(t.Month()))),
+		"{year}", strconv.Itoa(t.Year()),
+	).Replace(T(locale, "format.date"))
+}
+
+//FormatNumber returns n with its digits grouped in thousands as written in the locale, such as 1,234 or 1.234
+func FormatNumber(locale string, n int) string {
+	digits := strconv.Itoa(n)
+	sign := ""
+	if n < 0 {
+		sign, digits = "-", digits[1:]
+	}
+
+	sep := T(locale, "format.thousands")
+
+	var b strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteString(sep)
+		}
+		b.WriteRune(d)
+	}
+
+	return sign + b.String()
+}
+
+type contextKey struct{}
+
+//WithLocale returns a copy of ctx carrying the locale
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, contextKey{}, locale)
+}
+
+//FromContext returns the locale carried by ctx, or Default if it carries none
+func FromContext(ctx context.Context) string {
+	if locale, ok := ctx.Value(contextKey{}).(string); ok && locale != "" {
+		return locale
+	}
+	return Default
+}
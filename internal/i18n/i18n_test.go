@@ -0,0 +1,126 @@
+package i18n
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNegotiate(t *testing.T) {
+	var tests = []struct {
+		name     string
+		header   string
+		expected string
+	}{
+		{"empty", "", "en"},
+		{"exact", "es", "es"},
+		{"region", "es-MX", "es"},
+		{"upper case", "ES-es", "es"},
+		{"weighted", "fr;q=0.9, es;q=0.8, en;q=0.5", "es"},
+		{"order of weights", "en;q=0.4,es;q=0.7", "es"},
+		{"refused", "es;q=0", "en"},
+		{"unsupported", "fr-CA,de", "en"},
+		{"wildcard", "fr,*;q=0.5,es;q=0.1", "en"},
+		{"bad weight", "es;q=x,en", "en"},
+	}
+
+	for _, e := range tests {
+		if got := Negotiate(e.header); got != e.expected {
+			t.Errorf("%s: expected %s for %q, got %s", e.name, e.expected, e.header, got)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	var tests = []struct {
+		name     string
+		locale   string
+		key      string
+		args     []interface{}
+		expected string
+	}{
+		{"english", "en", "nav.home", nil, "Home"},
+		{"spanish", "es", "nav.home", nil, "Inicio"},
+		{"unsupported locale", "fr", "nav.home", nil, "Home"},
+		{"unknown key", "es", "no.such.key", nil, "no.such.key"},
+		{"arguments", "es", "forms.min_length", []interface{}{3}, "Este campo debe tener al menos 3 caracteres"},
+		{"message argument", "es", "rules.min_nights", []interface{}{Count("nights", 2)}, "La estancia mínima para estas fechas es de 2 noches"},
+		{"one", "en", "rules.buffer", []interface{}{Count("nights", 1)}, "This room needs 1 night free between stays"},
+		{"nested message", "es", "rules.closed_to_arrival", []interface{}{Msg("weekday.plural.saturday")}, "No se admiten llegadas los sábados en estas fechas"},
+	}
+
+	for _, e := range tests {
+		if got := T(e.locale, e.key, e.args...); got != e.expected {
+			t.Errorf("%s: expected %q, got %q", e.name, e.expected, got)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	day := time.Date(2050, 3, 7, 0, 0, 0, 0, time.UTC)
+
+	if got := FormatDate("en", day); got != "March 7, 2050" {
+		t.Errorf("expected March 7, 2050, got %q", got)
+	}
+	if got := FormatDate("es", day); got != "7 de marzo de 2050" {
+		t.Errorf("expected 7 de marzo de 2050, got %q", got)
+	}
+
+	var numbers = []struct {
+		locale   string
+		n        int
+		expected string
+	}{
+		{"en", 0, "0"},
+		{"en", 999, "999"},
+		{"en", 1000, "1,000"},
+		{"en", -1234567, "-1,234,567"},
+		{"es", 1234567, "1.234.567"},
+	}
+
+	for _, e := range numbers {
+		if got := FormatNumber(e.locale, e.n); got != e.expected {
+			t.Errorf("expected %s for %d in %s, got %s", e.expected, e.n, e.locale, got)
+		}
+	}
+}
+
+func TestContext(t *testing.T) {
+	if got := FromContext(context.Background()); got != Default {
+		t.Errorf("expected the default locale without one set, got %s", got)
+	}
+	if got := FromContext(WithLocale(context.Background(), "es")); got != "es" {
+		t.Errorf("expected es, got %s", got)
+	}
+}
+
+//TestCatalogs checks that every catalog has the keys of the default one, with the same formatting verbs
+func TestCatalogs(t *testing.T) {
+	verbs := regexp.MustCompile(`%[a-z]`)
+
+	if len(Locales()) < 2 || !Supported("es") {
+		t.Fatalf("expected the es catalog to be loaded, got %v", Locales())
+	}
+
+	for _, locale := range Locales() {
+		for key, message := range catalogs[Default] {
+			translated, ok := catalogs[locale][key]
+			if !ok {
+				t.Errorf("%s: missing %s", locale, key)
+				continue
+			}
+			want := strings.Join(verbs.FindAllString(message, -1), "")
+			if got := strings.Join(verbs.FindAllString(translated, -1), ""); got != want {
+				t.Errorf("%s: %s has verbs %q, expected %q", locale, key, got, want)
+			}
+		}
+
+		for key := range catalogs[locale] {
+			if _, ok := catalogs[Default][key]; !ok {
+				t.Errorf("%s: %s is not in the default catalog", locale, key)
+			}
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Rha02/bookings/internal/availability"
+	"github.com/Rha02/bookings/internal/forms"
+	"github.com/Rha02/bookings/internal/models"
+	"github.com/Rha02/bookings/internal/repository"
+)
+
+//Columns lists the CSV header fields an import file must contain
+var Columns = []string{"first_name", "last_name", "email", "phone", "start_date", "end_date", "room_id"}
+
+//dateLayouts are the date formats accepted in the start_date and end_date columns
+var dateLayouts = []string{"01-02-2006", "2006-01-02"}
+
+//Row holds a single line of an import file and the outcome of checking it
+type Row struct {
+	Line        int
+	Reservation models.Reservation
+	Errors      []string
+	Conflict    string
+	Imported    bool
+}
+
+//Valid returns true if the row passed validation and does not conflict with other bookings
+func (r Row) Valid() bool {
+	return len(r.Errors) == 0 && r.Conflict == ""
+}
+
+//Report is the result of checking, and optionally committing, an import file
+type Report struct {
+	Rows      []Row
+	Committed bool
+}
+
+//ValidCount returns the number of rows that can be imported
+func (r *Report) ValidCount() int {
+	count := 0
+	for _, row := range r.Rows {
+		if row.Valid() {
+			count++
+		}
+	}
+	return count
+}
+
+//ErrorCount returns the number of rows that failed validation
+func (r *Report) ErrorCount() int {
+	count := 0
+	for _, row := range r.Rows {
+		if len(row.Errors) > 0 {
+			count++
+		}
+	}
+	return count
+}
+
+//ConflictCount returns the number of valid rows that clash with existing or earlier bookings
+func (r *Report) ConflictCount() int {
+	count := 0
+	for _, row := range r.Rows {
+		if len(row.Errors) == 0 && row.Conflict != "" {
+			count++
+		}
+	}
+	return count
+}
+
+//ImportedCount returns the number of rows written to the database
+func (r *Report) ImportedCount() int {
+	count := 0
+	for _, row := range r.Rows {
+		if row.Imported {
+			count++
+		}
+	}
+	return count
+}
+
+//Parse reads CSV data and validates every row with the same rules used by the reservation form.
+//Malformed rows are reported as rows with an error, and only a file that cannot be read fails.
+func Parse(r io.Reader) ([]Row, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("import file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]int)
+	for i, name := range header {
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for _, column := range Columns {
+		if _, ok := index[column]; !ok {
+			return nil, fmt.Errorf("import file is missing the %s column", column)
+		}
+	}
+
+	var rows []Row
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return rows, err
+			}
+
+			msg := fmt.Sprintf("Malformed row: %s", parseErr.Err)
+			if parseErr.Err == csv.ErrFieldCount {
+				msg = "Wrong number of fields"
+			}
+			rows = append(rows, Row{Line: parseErr.StartLine, Errors: []string{msg}})
+			continue
+		}
+
+		line, _ := reader.FieldPos(0)
+
+		values := url.Values{}
+		for _, column := range Columns {
+			values.Set(column, strings.TrimSpace(record[index[column]]))
+		}
+
+		rows = append(rows, parseRow(line, values))
+	}
+
+	return rows, nil
+}
+
+//parseRow validates the fields of a single record and builds its reservation
+func parseRow(line int, values url.Values) Row {
+	row := Row{Line: line}
+
+	form := forms.New(values)
+	form.Required(Columns...)
+	form.MinLength("first_name", 3)
+	form.IsEmail("email")
+
+	for _, field := range Columns {
+		for _, msg := range form.Errors[field] {
+			row.Errors = append(row.Errors, fmt.Sprintf("%s: %s", field, msg))
+		}
+	}
+
+	row.Reservation = models.Reservation{
+		FirstName: values.Get("first_name"),
+		LastName:  values.Get("last_name"),
+		Email:     values.Get("email"),
+		Phone:     values.Get("phone"),
+	}
+
+	startDate, err := parseDate(values.Get("start_date"))
+	if err != nil && form.Errors.Get("start_date") == "" {
+		row.Errors = append(row.Errors, "start_date: Invalid date")
+	}
+
+	endDate, err := parseDate(values.Get("end_date"))
+	if err != nil && form.Errors.Get("end_date") == "" {
+		row.Errors = append(row.Errors, "end_date: Invalid date")
+	}
+
+	if !startDate.IsZero() && !endDate.IsZero() && !endDate.After(startDate) {
+		row.Errors = append(row.Errors, "end_date: Departure must be after arrival")
+	}
+
+	roomID, err := strconv.Atoi(values.Get("room_id"))
+	if err != nil && form.Errors.Get("room_id") == "" {
+		row.Errors = append(row.Errors, "room_id: Invalid room id")
+	}
+
+	row.Reservation.StartDate = startDate
+	row.Reservation.EndDate = endDate
+	row.Reservation.RoomID = roomID
+
+	return row
+}
+
+func parseDate(s string) (time.Time, error) {
+	var err error
+	for _, layout := range dateLayouts {
+		var t time.Time
+		t, err = time.Parse(layout, s)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+//Check looks up the room of every valid row, marks rows that break the stay rules as invalid and
+//marks rows that clash with current availability or with an earlier row of the same file
+func Check(repo repository.DatabaseRepo, rules []models.StayRule, rows []Row) error {
+	rooms := make(map[int]models.Room)
+	accepted := make(map[int][]int)
+	today := availability.Today()
+
+	for i := range rows {
+		row := &rows[i]
+		if len(row.Errors) > 0 {
+			continue
+		}
+
+		room, ok := rooms[row.Reservation.RoomID]
+		if !ok {
+			var err error
+			room, err = repo.GetRoomByID(row.Reservation.RoomID)
+			if err != nil {
+				row.Errors = append(row.Errors, fmt.Sprintf("room_id: Room %d does not exist", row.Reservation.RoomID))
+				continue
+			}
+			rooms[room.ID] = room
+		}
+		row.Reservation.Room = room
+
+		res := row.Reservation
+
+		err := availability.CheckRules(rules, res.RoomID, res.StartDate, res.EndDate, today)
+		if err != nil {
+			row.Errors = append(row.Errors, fmt.Sprintf("start_date: %s", err))
+			continue
+		}
+
+		available, err := repo.CheckAvailabilityByDatesByRoomID(row.Reservation.StartDate, row.Reservation.EndDate, row.Reservation.RoomID)
+		if err != nil {
+			return err
+		}
+
+		if !available {
+			row.Conflict = "Room is already booked or blocked for these dates"
+			continue
+		}
+
+		err = availability.Bookable(repo, rules, res.RoomID, res.StartDate, res.EndDate, today)
+		var ruleErr *availability.RuleError
+		if errors.As(err, &ruleErr) {
+			row.Conflict = ruleErr.Error()
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		//stays of the file need the buffer nights between them as well
+		buffer := availability.BufferNights(rules, res.RoomID, res.StartDate)
+
+		for _, j := range accepted[res.RoomID] {
+			other := rows[j].Reservation
+			if res.StartDate.Before(other.EndDate.AddDate(0, 0, buffer)) && res.EndDate.AddDate(0, 0, buffer).After(other.StartDate) {
+				row.Conflict = fmt.Sprintf("Overlaps the booking on line %d", rows[j].Line)
+				break
+			}
+		}
+
+		if row.Conflict == "" {
+			accepted[row.Reservation.RoomID] = append(accepted[row.Reservation.RoomID], i)
+		}
+	}
+
+	return nil
+}
+
+//DryRun parses and checks CSV data without writing anything to the database
+func DryRun(repo repository.DatabaseRepo, rules []models.StayRule, r io.Reader) (*Report, error) {
+	rows, err := Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	err = Check(repo, rules, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Report{Rows: rows}, nil
+}
+
+//Commit checks CSV data and books every valid row. Each row is stored with its room restriction in one
+//transaction that checks the room and its buffer nights again, so a stay booked since the check is reported as a conflict
+//instead of being imported. A row that cannot be stored is reported with the error and the others are
+//still imported.
+func Commit(repo repository.DatabaseRepo, rules []models.StayRule, r io.Reader) (*Report, error) {
+	report, err := DryRun(repo, rules, r)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range report.Rows {
+		row := &report.Rows[i]
+		if !row.Valid() {
+			continue
+		}
+
+		buffer := availability.BufferNights(rules, row.Reservation.RoomID, row.Reservation.StartDate)
+		id, err := repo.BookReservation(row.Reservation, buffer, nil)
+		if errors.Is(err, repository.ErrUnavailable) {
+			row.Conflict = "Room was booked or blocked for these dates during the import"
+			continue
+		}
+		if err != nil {
+			row.Errors = append(row.Errors, fmt.Sprintf("Could not be saved: %s", err))
+			continue
+		}
+
+		row.Reservation.ID = id
+		row.Imported = true
+	}
+
+	report.Committed = true
+
+	return report, nil
+}
@@ -0,0 +1,215 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Rha02/bookings/internal/config"
+	"github.com/Rha02/bookings/internal/models"
+	"github.com/Rha02/bookings/internal/repository/dbrepo"
+)
+
+func TestParse(t *testing.T) {
+	data := `first_name,last_name,email,phone,start_date,end_date,room_id
+Joseph,Clyde,jclyde@bookings.loc,123123123,01-01-2050,01-03-2050,1
+J,Clyde,jclyde@bookings.loc,123123123,01-01-2050,01-03-2050,1
+Joseph,Clyde,invalid,123123123,2050-01-05,2050-01-07,2
+Joseph,Clyde,jclyde@bookings.loc,123123123,01-05-2050,01-03-2050,1
+Joseph,Clyde,jclyde@bookings.loc,123123123,01-05-2050,01-06-2050
+`
+
+	rows, err := Parse(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 5 {
+		t.Fatalf("expected 5 rows, got %d", len(rows))
+	}
+
+	if !rows[0].Valid() {
+		t.Errorf("expected line %d to be valid, got errors %v", rows[0].Line, rows[0].Errors)
+	}
+
+	if rows[0].Line != 2 {
+		t.Errorf("expected first row to be on line 2, got %d", rows[0].Line)
+	}
+
+	if rows[0].Reservation.RoomID != 1 || rows[0].Reservation.EndDate.Day() != 3 {
+		t.Error("reservation was not built from the row")
+	}
+
+	for _, row := range rows[1:] {
+		if row.Valid() {
+			t.Errorf("expected line %d to be invalid, but it passed", row.Line)
+		}
+	}
+}
+
+func TestParse_Malformed(t *testing.T) {
+	data := `first_name,last_name,email,phone,start_date,end_date,room_id
+Joseph,Clyde,jclyde@bookings.loc,123123123,01-01-2050,01-03-2050,1
+Jo"seph,Clyde,jclyde@bookings.loc,123123123,01-05-2050,01-07-2050,1
+Joseph,Clyde,jclyde@bookings.loc,123123123,01-05-2050,01-07-2050
+Joseph,Clyde,jclyde@bookings.loc,123123123,01-09-2050,01-11-2050,1
+`
+
+	rows, err := Parse(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		line   int
+		errors string
+	}{
+		{2, ""},
+		{3, `Malformed row: bare " in non-quoted-field`},
+		{4, "Wrong number of fields"},
+		{5, ""},
+	}
+
+	if len(rows) != len(tests) {
+		t.Fatalf("expected %d rows, got %d", len(tests), len(rows))
+	}
+
+	for i, e := range tests {
+		if rows[i].Line != e.line || strings.Join(rows[i].Errors, "; ") != e.errors {
+			t.Errorf("row %d: expected line %d with errors %q, got line %d with %q", i, e.line, e.errors, rows[i].Line, rows[i].Errors)
+		}
+	}
+}
+
+func TestParse_MissingColumn(t *testing.T) {
+	data := `first_name,last_name,email,phone,start_date,end_date
+Joseph,Clyde,jclyde@bookings.loc,123123123,01-01-2050,01-03-2050
+`
+
+	_, err := Parse(strings.NewReader(data))
+	if err == nil {
+		t.Error("expected an error for a file without the room_id column")
+	}
+
+	_, err = Parse(strings.NewReader(""))
+	if err == nil {
+		t.Error("expected an error for an empty file")
+	}
+}
+
+func TestReport_Counts(t *testing.T) {
+	report := Report{
+		Rows: []Row{
+			{Line: 2},
+			{Line: 3, Errors: []string{"email: Invalid email address"}},
+			{Line: 4, Conflict: "Overlaps the booking on line 2"},
+			{Line: 5, Imported: true},
+		},
+	}
+
+	if report.ValidCount() != 2 {
+		t.Errorf("expected 2 valid rows, got %d", report.ValidCount())
+	}
+
+	if report.ErrorCount() != 1 {
+		t.Errorf("expected 1 row with errors, got %d", report.ErrorCount())
+	}
+
+	if report.ConflictCount() != 1 {
+		t.Errorf("expected 1 conflict, got %d", report.ConflictCount())
+	}
+
+	if report.ImportedCount() != 1 {
+		t.Errorf("expected 1 imported row, got %d", report.ImportedCount())
+	}
+}
+
+func TestDryRun_StayRules(t *testing.T) {
+	repo := dbrepo.NewMemoryRepo(&config.AppConfig{})
+	err := repo.InsertBlockForRoom(2, time.Date(2050, 1, 20, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rules := []models.StayRule{{Name: "Minimum", MinNights: 2, BufferNights: 1}}
+
+	data := `first_name,last_name,email,phone,start_date,end_date,room_id
+Joseph,Clyde,jclyde@bookings.loc,123123123,01-01-2050,01-03-2050,1
+Joseph,Clyde,jclyde@bookings.loc,123123123,01-05-2050,01-06-2050,1
+Joseph,Clyde,jclyde@bookings.loc,123123123,01-03-2050,01-05-2050,1
+Joseph,Clyde,jclyde@bookings.loc,123123123,01-04-2050,01-06-2050,1
+Joseph,Clyde,jclyde@bookings.loc,123123123,01-17-2050,01-20-2050,2
+`
+
+	report, err := DryRun(repo, rules, strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		line     int
+		errors   string
+		conflict string
+	}{
+		{2, "", ""},
+		{3, "start_date: The minimum stay for these dates is 2 nights", ""},
+		{4, "", "Overlaps the booking on line 2"},
+		{5, "", ""},
+		{6, "", "This room needs 1 night free between stays"},
+	}
+
+	for i, e := range tests {
+		row := report.Rows[i]
+		if strings.Join(row.Errors, "; ") != e.errors || row.Conflict != e.conflict {
+			t.Errorf("line %d: expected errors %q and conflict %q, got %q and %q", e.line, e.errors, e.conflict, row.Errors, row.Conflict)
+		}
+	}
+}
+
+//staleRepo reports every room as free, as if a stay was booked after the import was checked
+type staleRepo struct {
+	*dbrepo.MemoryRepo
+}
+
+func (staleRepo) CheckAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error) {
+	return true, nil
+}
+
+func TestCommit(t *testing.T) {
+	repo := dbrepo.NewMemoryRepo(&config.AppConfig{})
+	err := repo.InsertBlockForRoom(2, time.Date(2050, 1, 5, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := `first_name,last_name,email,phone,start_date,end_date,room_id
+Joseph,Clyde,jclyde@bookings.loc,123123123,01-01-2050,01-03-2050,1
+Joseph,Clyde,jclyde@bookings.loc,123123123,01-04-2050,01-06-2050,2
+J,Clyde,jclyde@bookings.loc,123123123,01-07-2050,01-09-2050,1
+`
+
+	report, err := Commit(staleRepo{repo}, nil, strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !report.Committed || report.ImportedCount() != 1 || !report.Rows[0].Imported {
+		t.Fatalf("expected only line 2 to be imported, got %+v", report.Rows)
+	}
+
+	if report.Rows[1].Imported || report.Rows[1].Conflict == "" {
+		t.Errorf("expected the stay booked since the check to conflict, got %+v", report.Rows[1])
+	}
+
+	restrictions, err := repo.GetRestrictionsForRoomByDate(1, time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restrictions) != 1 || restrictions[0].ReservationID != report.Rows[0].Reservation.ID {
+		t.Errorf("expected the imported stay to restrict its room, got %+v", restrictions)
+	}
+
+	if _, total, _ := repo.SearchReservations(models.ReservationFilter{Page: 1, PageSize: 10}); total != 1 {
+		t.Errorf("expected 1 reservation, got %d", total)
+	}
+}
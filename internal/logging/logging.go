@@ -0,0 +1,118 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+)
+
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
+)
+
+//RequestIDHeader is read from incoming requests, so IDs from a proxy are kept, and echoed on every response
+const RequestIDHeader = "X-Request-Id"
+
+//New returns a logger writing to w at the given level, as JSON or in a human-readable console format
+func New(w io.Writer, format, level string) (zerolog.Logger, error) {
+	lvl, err := zerolog.ParseLevel(level)
+	if err != nil {
+		return zerolog.Nop(), fmt.Errorf("logging: unknown level %q", level)
+	}
+	if lvl == zerolog.NoLevel {
+		lvl = zerolog.InfoLevel
+	}
+
+	switch format {
+	case FormatJSON:
+	case FormatConsole:
+		w = zerolog.ConsoleWriter{Out: w, TimeFormat: "2006-01-02 15:04:05"}
+	default:
+		return zerolog.Nop(), fmt.Errorf("logging: unknown format %q", format)
+	}
+
+	return zerolog.New(w).Level(lvl).With().Timestamp().Logger(), nil
+}
+
+//Middleware gives every request an ID and a logger carrying it, and logs the request once it is served
+func Middleware(logger zerolog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			id := r.Header.Get(RequestIDHeader)
+			if id == "" || len(id) > 64 {
+				id = newRequestID()
+			}
+			rw.Header().Set(RequestIDHeader, id)
+
+			l := logger.With().Str("request_id", id).Logger()
+			r = r.WithContext(l.WithContext(r.Context()))
+
+			ww := middleware.NewWrapResponseWriter(rw, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			event := zerolog.Ctx(r.Context()).Info()
+			if status >= 500 {
+				event = zerolog.Ctx(r.Context()).Error()
+			}
+
+			event.
+				Str("method", r.Method).
+				Str("path", r.URL.Path).
+				Str("route", routePattern(r)).
+				Int("status", status).
+				Int("bytes", ww.BytesWritten()).
+				Dur("duration", time.Since(start)).
+				Msg("request")
+		})
+	}
+}
+
+//FromRequest returns the logger of the request, with its route, so handlers log with the request ID and user ID
+func FromRequest(r *http.Request) *zerolog.Logger {
+	l := zerolog.Ctx(r.Context()).With().Str("route", routePattern(r)).Logger()
+	return &l
+}
+
+//AddFields adds fields to the logger of the request, including the log line written once it is served
+func AddFields(r *http.Request, fields map[string]interface{}) {
+	l := zerolog.Ctx(r.Context())
+	//outside Middleware this is the shared default logger, which must not collect per-request fields
+	if l == zerolog.DefaultContextLogger {
+		return
+	}
+
+	l.UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Fields(fields)
+	})
+}
+
+func routePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		return rctx.RoutePattern()
+	}
+	return ""
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,95 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+
+	l, err := New(&buf, FormatJSON, "warn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Info().Msg("hidden")
+	l.Warn().Str("room", "generals").Msg("shown")
+
+	var entry map[string]interface{}
+	err = json.Unmarshal(buf.Bytes(), &entry)
+	if err != nil {
+		t.Fatalf("json logger wrote %q: %s", buf.String(), err)
+	}
+	if entry["message"] != "shown" || entry["level"] != "warn" || entry["room"] != "generals" {
+		t.Errorf("unexpected entry %v", entry)
+	}
+
+	buf.Reset()
+	l, _ = New(&buf, FormatConsole, "info")
+	l.Info().Msg("hello")
+	if strings.HasPrefix(buf.String(), "{") || !strings.Contains(buf.String(), "hello") {
+		t.Errorf("console logger wrote %q", buf.String())
+	}
+
+	if _, err = New(&buf, "xml", "info"); err == nil {
+		t.Error("unknown format did not return an error")
+	}
+	if _, err = New(&buf, FormatJSON, "loud"); err == nil {
+		t.Error("unknown level did not return an error")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	l, _ := New(&buf, FormatJSON, "debug")
+
+	mux := chi.NewRouter()
+	mux.Use(Middleware(l))
+	mux.Get("/admin/reservations/{src}/{id}/show", func(rw http.ResponseWriter, r *http.Request) {
+		AddFields(r, map[string]interface{}{"user_id": 1, "reservation_id": 7})
+		FromRequest(r).Error().Msg("cannot load reservation")
+		rw.WriteHeader(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest("GET", "/admin/reservations/all/7/show", nil)
+	req.Header.Set(RequestIDHeader, "abc123")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if rr.Header().Get(RequestIDHeader) != "abc123" {
+		t.Errorf("response request id is %q", rr.Header().Get(RequestIDHeader))
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 log lines, got %q", buf.String())
+	}
+
+	for i, line := range lines {
+		var entry map[string]interface{}
+		err := json.Unmarshal([]byte(line), &entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry["request_id"] != "abc123" || entry["route"] != "/admin/reservations/{src}/{id}/show" ||
+			entry["user_id"] != float64(1) || entry["reservation_id"] != float64(7) {
+			t.Errorf("line %d is missing request fields: %s", i, line)
+		}
+		if i == 1 && (entry["message"] != "request" || entry["status"] != float64(500) || entry["level"] != "error") {
+			t.Errorf("unexpected request line %s", line)
+		}
+	}
+
+	buf.Reset()
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/missing", nil))
+	if id := rr.Header().Get(RequestIDHeader); len(id) != 16 {
+		t.Errorf("generated request id is %q", id)
+	}
+}
@@ -0,0 +1,93 @@
+package mailer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/Rha02/bookings/internal/models"
+)
+
+var fileCounter uint64
+
+//uniqueName returns a file name that will not clash with other messages written by this process
+func uniqueName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	n := atomic.AddUint64(&fileCounter, 1)
+	return fmt.Sprintf("%d.%d_%d.%s", time.Now().Unix(), os.Getpid(), n, host)
+}
+
+//FileMailer writes every message to its own .eml file, for use in development
+type FileMailer struct {
+	dir string
+}
+
+//NewFileMailer returns a Mailer that writes messages into dir, creating it if needed
+func NewFileMailer(dir string) (*FileMailer, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("mailer: file transport needs a directory")
+	}
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileMailer{dir: dir}, nil
+}
+
+//Send writes m to a new file in the directory
+func (f *FileMailer) Send(m models.MailData) error {
+	email, err := newMessage(m)
+	if err != nil {
+		return err
+	}
+
+	name := filepath.Join(f.dir, uniqueName()+".eml")
+	return ioutil.WriteFile(name, []byte(email.GetMessage()), 0644)
+}
+
+//MaildirMailer delivers messages into a maildir, so they can be read with any mail client
+type MaildirMailer struct {
+	dir string
+}
+
+//NewMaildirMailer returns a Mailer that delivers into the maildir at dir, creating it if needed
+func NewMaildirMailer(dir string) (*MaildirMailer, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("mailer: maildir transport needs a directory")
+	}
+
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		err := os.MkdirAll(filepath.Join(dir, sub), 0700)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &MaildirMailer{dir: dir}, nil
+}
+
+//Send writes m into tmp and then moves it into new, as the maildir format requires
+func (md *MaildirMailer) Send(m models.MailData) error {
+	email, err := newMessage(m)
+	if err != nil {
+		return err
+	}
+
+	name := uniqueName()
+	tmp := filepath.Join(md.dir, "tmp", name)
+
+	err = ioutil.WriteFile(tmp, []byte(email.GetMessage()), 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(md.dir, "new", name))
+}
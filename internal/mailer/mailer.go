@@ -0,0 +1,80 @@
+package mailer
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Rha02/bookings/internal/models"
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+//Transport names accepted in Config.Transport
+const (
+	TransportSMTP     = "smtp"
+	TransportSendmail = "sendmail"
+	TransportFile     = "file"
+	TransportMaildir  = "maildir"
+)
+
+//Mailer delivers a single email message
+type Mailer interface {
+	Send(m models.MailData) error
+}
+
+//Config holds the settings used to choose and set up a Mailer
+type Config struct {
+	Transport string
+
+	//SMTP settings
+	Host     string
+	Port     int
+	Username string
+	Password string
+	StartTLS bool
+	Timeout  time.Duration
+
+	//Sendmail settings
+	SendmailPath string
+
+	//File and maildir settings
+	Dir string
+}
+
+//New returns the Mailer selected by cfg.Transport
+func New(cfg Config) (Mailer, error) {
+	switch strings.ToLower(cfg.Transport) {
+	case "", TransportSMTP:
+		if cfg.Host == "" || cfg.Port == 0 {
+			return nil, fmt.Errorf("mailer: smtp transport needs a host and port")
+		}
+		return NewSMTPMailer(cfg), nil
+	case TransportSendmail:
+		return NewSendmailMailer(cfg.SendmailPath), nil
+	case TransportFile:
+		return NewFileMailer(cfg.Dir)
+	case TransportMaildir:
+		return NewMaildirMailer(cfg.Dir)
+	default:
+		return nil, fmt.Errorf("mailer: unknown transport %q", cfg.Transport)
+	}
+}
+
+//newMessage builds the email for m, returning an error if an address is invalid.
+//Messages with a plain-text body are sent as multipart/alternative.
+func newMessage(m models.MailData) (*mail.Email, error) {
+	email := mail.NewMSG()
+	email.SetFrom(m.From).AddTo(m.To).SetSubject(m.Subject)
+	if m.TextContent != "" {
+		email.SetBody(mail.TextPlain, m.TextContent)
+		email.AddAlternative(mail.TextHTML, m.Content)
+	} else {
+		email.SetBody(mail.TextHTML, m.Content)
+	}
+
+	if email.Error != nil {
+		return nil, email.Error
+	}
+
+	return email, nil
+}
@@ -0,0 +1,170 @@
+package mailer
+
+import (
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Rha02/bookings/internal/models"
+)
+
+var testMsg = models.MailData{
+	To:      "john@smith.com",
+	From:    "me@here.com",
+	Subject: "Reservation Confirmation",
+	Content: "<strong>Reservation Confirmation</strong>",
+}
+
+func TestNewMessage_Alternative(t *testing.T) {
+	m := testMsg
+	m.TextContent = "Reservation Confirmation"
+
+	email, err := newMessage(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := email.GetMessage()
+	if !strings.Contains(msg, "multipart/alternative") {
+		t.Error("message with a plain-text body is not multipart/alternative")
+	}
+
+	plain := strings.Index(msg, "text/plain")
+	html := strings.Index(msg, "text/html")
+	if plain < 0 || html < 0 || plain > html {
+		t.Error("expected the plain-text part before the HTML part")
+	}
+
+	_, err = newMessage(models.MailData{To: "not an address", From: "me@here.com"})
+	if err == nil {
+		t.Error("expected an error for an invalid address")
+	}
+}
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+
+	var tests = []struct {
+		name    string
+		cfg     Config
+		isValid bool
+	}{
+		{"smtp", Config{Transport: "smtp", Host: "localhost", Port: 1025}, true},
+		{"smtp-default", Config{Host: "localhost", Port: 1025}, true},
+		{"smtp-missing-host", Config{Transport: "smtp"}, false},
+		{"sendmail", Config{Transport: "sendmail"}, true},
+		{"file", Config{Transport: "file", Dir: filepath.Join(dir, "files")}, true},
+		{"file-missing-dir", Config{Transport: "file"}, false},
+		{"maildir", Config{Transport: "maildir", Dir: filepath.Join(dir, "maildir")}, true},
+		{"unknown", Config{Transport: "pigeon"}, false},
+	}
+
+	for _, e := range tests {
+		_, err := New(e.cfg)
+		if e.isValid && err != nil {
+			t.Errorf("%s: unexpected error: %s", e.name, err)
+		}
+		if !e.isValid && err == nil {
+			t.Errorf("%s: expected an error but did not get one", e.name)
+		}
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+
+	m, err := NewFileMailer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Send(testMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("expected 1 message file, got %d", len(files))
+	}
+
+	data, _ := ioutil.ReadFile(files[0])
+	if !strings.Contains(string(data), "Subject: Reservation Confirmation") {
+		t.Errorf("message file does not contain the subject: %s", data)
+	}
+}
+
+func TestMaildirMailer(t *testing.T) {
+	dir := t.TempDir()
+
+	m, err := NewMaildirMailer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		err = m.Send(testMsg)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	delivered, _ := ioutil.ReadDir(filepath.Join(dir, "new"))
+	if len(delivered) != 2 {
+		t.Errorf("expected 2 messages in new, got %d", len(delivered))
+	}
+
+	pending, _ := ioutil.ReadDir(filepath.Join(dir, "tmp"))
+	if len(pending) != 0 {
+		t.Errorf("expected tmp to be empty, got %d files", len(pending))
+	}
+}
+
+func TestSendmailMailer(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out.eml")
+	script := filepath.Join(dir, "sendmail")
+
+	err := ioutil.WriteFile(script, []byte("#!/bin/sh\ncat > "+out+"\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = NewSendmailMailer(script).Send(testMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := ioutil.ReadFile(out)
+	if !strings.Contains(string(data), "john@smith.com") {
+		t.Errorf("sendmail did not receive the message: %s", data)
+	}
+
+	err = NewSendmailMailer(filepath.Join(dir, "missing")).Send(testMsg)
+	if err == nil {
+		t.Error("expected an error for a missing sendmail binary")
+	}
+}
+
+func TestSMTPMailer_ConnectFailure(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	m := NewSMTPMailer(Config{Host: "127.0.0.1", Port: port, Timeout: time.Second})
+
+	err = m.Send(testMsg)
+	if err == nil {
+		t.Fatal("expected an error when the SMTP server is not listening")
+	}
+
+	if !strings.Contains(err.Error(), "cannot connect") {
+		t.Errorf("expected a connection error, got %s", err)
+	}
+}
@@ -0,0 +1,172 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Rha02/bookings/internal/metrics"
+	"github.com/Rha02/bookings/internal/models"
+	"github.com/rs/zerolog"
+)
+
+//OutboxStore is the storage the outbox worker claims queued messages from and records delivery in.
+//A claimed message is not claimed again until its lease runs out, so workers on several servers can
+//share one outbox without sending a message twice.
+type OutboxStore interface {
+	ClaimOutboxMessages(now time.Time, lease time.Duration, limit int) ([]models.OutboxMessage, error)
+	UpdateOutboxMessage(msg models.OutboxMessage) error
+}
+
+//Worker delivers queued outbox messages, retrying failures with exponential backoff
+//until MaxAttempts is reached, when the message is marked dead. Messages are claimed for Lease, which must
+//be longer than sending a batch takes; the messages of a worker that stops mid-batch are retried after it.
+type Worker struct {
+	Store       OutboxStore
+	Mailer      Mailer
+	Interval    time.Duration
+	BatchSize   int
+	Lease       time.Duration
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Logger      zerolog.Logger
+
+	now func() time.Time
+
+	mu      sync.Mutex
+	lastRun time.Time
+	lastErr error
+}
+
+//NewWorker returns a Worker with the default polling interval and retry policy
+func NewWorker(store OutboxStore, m Mailer, logger zerolog.Logger) *Worker {
+	return &Worker{
+		Store:       store,
+		Mailer:      m,
+		Interval:    5 * time.Second,
+		BatchSize:   20,
+		Lease:       10 * time.Minute,
+		MaxAttempts: 8,
+		BaseDelay:   30 * time.Second,
+		MaxDelay:    6 * time.Hour,
+		Logger:      logger,
+		now:         time.Now,
+	}
+}
+
+//Run delivers due messages every Interval until ctx is cancelled
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		_, err := w.ProcessDue(ctx)
+		if err != nil {
+			w.Logger.Error().Err(err).Msg("cannot read the outbox")
+		}
+		w.record(err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Worker) record(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.lastRun = w.now()
+	w.lastErr = err
+}
+
+//Ready returns an error unless Run has polled the outbox within the last three intervals without failing
+func (w *Worker) Ready() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	switch {
+	case w.lastRun.IsZero():
+		return errors.New("mail worker has not run yet")
+	case w.lastErr != nil:
+		return fmt.Errorf("mail worker cannot read the outbox: %w", w.lastErr)
+	case w.now().Sub(w.lastRun) > 3*w.Interval:
+		return fmt.Errorf("mail worker has not run since %s", w.lastRun.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+//ProcessDue claims and attempts delivery of the messages that are due and returns the number sent.
+//It stops between messages once ctx is cancelled; the rest stay claimed until their lease runs out.
+func (w *Worker) ProcessDue(ctx context.Context) (int, error) {
+	messages, err := w.Store.ClaimOutboxMessages(w.now(), w.Lease, w.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, msg := range messages {
+		if ctx.Err() != nil {
+			break
+		}
+		if w.deliver(msg) {
+			sent++
+		}
+	}
+
+	return sent, nil
+}
+
+//deliver sends one message and records the outcome, returning true if it was sent
+func (w *Worker) deliver(msg models.OutboxMessage) bool {
+	msg.Attempts++
+
+	err := w.Mailer.Send(msg.Mail)
+	if err == nil {
+		msg.Status = models.OutboxSent
+		msg.SentAt = w.now()
+		msg.LastError = ""
+		w.save(msg)
+		metrics.MailSent()
+		w.Logger.Info().Int("outbox_id", msg.ID).Str("to", msg.Mail.To).Msg("email sent")
+		return true
+	}
+
+	msg.LastError = err.Error()
+	if msg.Attempts >= w.MaxAttempts {
+		msg.Status = models.OutboxDead
+		w.Logger.Error().Err(err).Int("outbox_id", msg.ID).Str("to", msg.Mail.To).Int("attempts", msg.Attempts).Msg("email failed, giving up")
+	} else {
+		msg.NextAttemptAt = w.now().Add(w.Backoff(msg.Attempts))
+		w.Logger.Warn().Err(err).Int("outbox_id", msg.ID).Str("to", msg.Mail.To).Time("next_attempt_at", msg.NextAttemptAt).Msg("email failed, will retry")
+	}
+	w.save(msg)
+	metrics.MailFailed(msg.Status == models.OutboxDead)
+
+	return false
+}
+
+func (w *Worker) save(msg models.OutboxMessage) {
+	err := w.Store.UpdateOutboxMessage(msg)
+	if err != nil {
+		w.Logger.Error().Err(err).Int("outbox_id", msg.ID).Msg("cannot update outbox message")
+	}
+}
+
+//Backoff returns how long to wait before retrying a message that has failed attempts times
+func (w *Worker) Backoff(attempts int) time.Duration {
+	delay := w.BaseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= w.MaxDelay {
+			return w.MaxDelay
+		}
+	}
+	return delay
+}
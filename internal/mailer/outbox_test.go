@@ -0,0 +1,236 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Rha02/bookings/internal/models"
+	"github.com/rs/zerolog"
+)
+
+type memoryStore struct {
+	messages []models.OutboxMessage
+}
+
+func (s *memoryStore) ClaimOutboxMessages(now time.Time, lease time.Duration, limit int) ([]models.OutboxMessage, error) {
+	var due []models.OutboxMessage
+	for i, msg := range s.messages {
+		if msg.Status == models.OutboxPending && !msg.NextAttemptAt.After(now) && len(due) < limit {
+			s.messages[i].NextAttemptAt = now.Add(lease)
+			due = append(due, s.messages[i])
+		}
+	}
+	return due, nil
+}
+
+func (s *memoryStore) UpdateOutboxMessage(msg models.OutboxMessage) error {
+	for i := range s.messages {
+		if s.messages[i].ID == msg.ID {
+			s.messages[i] = msg
+		}
+	}
+	return nil
+}
+
+type failingMailer struct {
+	failures int
+	sent     []models.MailData
+}
+
+func (f *failingMailer) Send(m models.MailData) error {
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("connection refused")
+	}
+	f.sent = append(f.sent, m)
+	return nil
+}
+
+func newTestWorker(store OutboxStore, m Mailer, now *time.Time) *Worker {
+	w := NewWorker(store, m, zerolog.Nop())
+	w.MaxAttempts = 3
+	w.now = func() time.Time { return *now }
+	return w
+}
+
+func TestWorker_RetriesWithBackoff(t *testing.T) {
+	now := time.Date(2050, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := &memoryStore{messages: []models.OutboxMessage{
+		{ID: 1, Mail: testMsg, Status: models.OutboxPending, NextAttemptAt: now},
+	}}
+	m := &failingMailer{failures: 1}
+	w := newTestWorker(store, m, &now)
+
+	sent, _ := w.ProcessDue(context.Background())
+	if sent != 0 {
+		t.Fatalf("expected no messages sent, got %d", sent)
+	}
+
+	msg := store.messages[0]
+	if msg.Status != models.OutboxPending || msg.Attempts != 1 || msg.LastError == "" {
+		t.Errorf("expected a pending message with one failed attempt, got %+v", msg)
+	}
+	if !msg.NextAttemptAt.Equal(now.Add(w.BaseDelay)) {
+		t.Errorf("expected next attempt at %s, got %s", now.Add(w.BaseDelay), msg.NextAttemptAt)
+	}
+
+	sent, _ = w.ProcessDue(context.Background())
+	if sent != 0 {
+		t.Error("message was retried before its backoff expired")
+	}
+
+	now = now.Add(w.BaseDelay)
+	sent, _ = w.ProcessDue(context.Background())
+	if sent != 1 || len(m.sent) != 1 {
+		t.Fatalf("expected the message to be sent on retry, got %d", sent)
+	}
+
+	msg = store.messages[0]
+	if msg.Status != models.OutboxSent || !msg.SentAt.Equal(now) || msg.LastError != "" {
+		t.Errorf("expected a sent message, got %+v", msg)
+	}
+}
+
+func TestWorker_DeadLetter(t *testing.T) {
+	now := time.Date(2050, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := &memoryStore{messages: []models.OutboxMessage{
+		{ID: 1, Mail: testMsg, Status: models.OutboxPending, NextAttemptAt: now},
+	}}
+	w := newTestWorker(store, &failingMailer{failures: 10}, &now)
+
+	for i := 0; i < w.MaxAttempts; i++ {
+		w.ProcessDue(context.Background())
+		now = now.Add(w.MaxDelay)
+	}
+
+	msg := store.messages[0]
+	if msg.Status != models.OutboxDead || msg.Attempts != w.MaxAttempts {
+		t.Errorf("expected a dead message after %d attempts, got %+v", w.MaxAttempts, msg)
+	}
+
+	w.ProcessDue(context.Background())
+	if store.messages[0].Attempts != w.MaxAttempts {
+		t.Error("a dead message was retried")
+	}
+}
+
+//reentrantMailer runs another worker while it sends, as a worker on another server would
+type reentrantMailer struct {
+	failingMailer
+	other *Worker
+}
+
+func (r *reentrantMailer) Send(m models.MailData) error {
+	if r.other != nil {
+		other := r.other
+		r.other = nil
+		other.ProcessDue(context.Background())
+	}
+	return r.failingMailer.Send(m)
+}
+
+func TestWorker_SharedOutbox(t *testing.T) {
+	now := time.Date(2050, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := &memoryStore{messages: []models.OutboxMessage{
+		{ID: 1, Mail: testMsg, Status: models.OutboxPending, NextAttemptAt: now},
+		{ID: 2, Mail: testMsg, Status: models.OutboxPending, NextAttemptAt: now},
+	}}
+
+	m := &reentrantMailer{}
+	m.other = newTestWorker(store, m, &now)
+	w := newTestWorker(store, m, &now)
+
+	sent, _ := w.ProcessDue(context.Background())
+	if sent != 2 || len(m.sent) != 2 {
+		t.Errorf("expected each message to be sent once, got %d sends", len(m.sent))
+	}
+
+	//messages left claimed by a worker that stopped are sent once the lease runs out
+	store.messages = append(store.messages, models.OutboxMessage{ID: 3, Mail: testMsg, Status: models.OutboxPending, NextAttemptAt: now})
+	store.ClaimOutboxMessages(now, w.Lease, 10)
+
+	if sent, _ = w.ProcessDue(context.Background()); sent != 0 {
+		t.Error("a claimed message was sent before its lease ran out")
+	}
+
+	now = now.Add(w.Lease)
+	if sent, _ = w.ProcessDue(context.Background()); sent != 1 {
+		t.Errorf("expected the message to be sent after its lease, got %d", sent)
+	}
+}
+
+func TestWorker_Backoff(t *testing.T) {
+	w := NewWorker(nil, nil, zerolog.Nop())
+
+	var tests = []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{20, 6 * time.Hour},
+	}
+
+	for _, e := range tests {
+		if d := w.Backoff(e.attempts); d != e.expected {
+			t.Errorf("backoff after %d attempts: expected %s, got %s", e.attempts, e.expected, d)
+		}
+	}
+}
+
+func TestWorker_StopsWhenCancelled(t *testing.T) {
+	now := time.Date(2050, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := &memoryStore{messages: []models.OutboxMessage{
+		{ID: 1, Mail: testMsg, Status: models.OutboxPending, NextAttemptAt: now},
+		{ID: 2, Mail: testMsg, Status: models.OutboxPending, NextAttemptAt: now},
+	}}
+	m := &failingMailer{}
+	w := newTestWorker(store, m, &now)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	sent, _ := w.ProcessDue(ctx)
+	if sent != 0 || store.messages[0].Status != models.OutboxPending {
+		t.Error("worker sent messages after being cancelled")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Run did not return after its context was cancelled")
+	}
+}
+
+func TestWorker_Ready(t *testing.T) {
+	now := time.Date(2050, 1, 1, 12, 0, 0, 0, time.UTC)
+	w := newTestWorker(&memoryStore{}, &failingMailer{}, &now)
+
+	if w.Ready() == nil {
+		t.Error("worker that has not run is ready")
+	}
+
+	w.record(nil)
+	if err := w.Ready(); err != nil {
+		t.Errorf("worker that just ran is not ready: %s", err)
+	}
+
+	now = now.Add(4 * w.Interval)
+	if w.Ready() == nil {
+		t.Error("worker that stopped running is ready")
+	}
+
+	w.record(errors.New("connection refused"))
+	if w.Ready() == nil {
+		t.Error("worker that cannot read the outbox is ready")
+	}
+}
@@ -0,0 +1,46 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/Rha02/bookings/internal/models"
+)
+
+const defaultSendmailPath = "/usr/sbin/sendmail"
+
+//SendmailMailer pipes mail to a local sendmail binary
+type SendmailMailer struct {
+	path string
+}
+
+//NewSendmailMailer returns a Mailer that runs the sendmail binary at path
+func NewSendmailMailer(path string) *SendmailMailer {
+	if path == "" {
+		path = defaultSendmailPath
+	}
+	return &SendmailMailer{path: path}
+}
+
+//Send writes m to the standard input of sendmail, which reads the recipients from the headers
+func (s *SendmailMailer) Send(m models.MailData) error {
+	email, err := newMessage(m)
+	if err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+
+	cmd := exec.Command(s.path, "-t", "-i")
+	cmd.Stdin = strings.NewReader(email.GetMessage())
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("mailer: %s failed: %w: %s", s.path, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package mailer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Rha02/bookings/internal/models"
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+const defaultSMTPTimeout = 10 * time.Second
+
+//SMTPMailer sends mail through an SMTP server
+type SMTPMailer struct {
+	server *mail.SMTPServer
+}
+
+//NewSMTPMailer returns a Mailer that connects to the SMTP server in cfg for every message
+func NewSMTPMailer(cfg Config) *SMTPMailer {
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = defaultSMTPTimeout
+	}
+
+	server := mail.NewSMTPClient()
+	server.Host = cfg.Host
+	server.Port = cfg.Port
+	server.Username = cfg.Username
+	server.Password = cfg.Password
+	server.KeepAlive = false
+	server.ConnectTimeout = timeout
+	server.SendTimeout = timeout
+
+	if cfg.StartTLS {
+		server.Encryption = mail.EncryptionSTARTTLS
+	}
+
+	return &SMTPMailer{server: server}
+}
+
+//Send connects to the server and delivers m
+func (s *SMTPMailer) Send(m models.MailData) error {
+	email, err := newMessage(m)
+	if err != nil {
+		return err
+	}
+
+	client, err := s.server.Connect()
+	if err != nil {
+		return fmt.Errorf("mailer: cannot connect to %s:%d: %w", s.server.Host, s.server.Port, err)
+	}
+	defer client.Close()
+
+	err = email.Send(client)
+	if err != nil {
+		return fmt.Errorf("mailer: cannot send to %s: %w", m.To, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Rha02/bookings/internal/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "bookings"
+
+//Registry holds every metric exposed on /metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, chi route pattern and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and chi route pattern.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	mailSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mail_sent_total",
+		Help:      "Emails delivered by the outbox worker.",
+	})
+
+	mailFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mail_send_failures_total",
+		Help:      "Failed email delivery attempts.",
+	})
+
+	mailDead = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mail_dead_total",
+		Help:      "Emails given up on after too many failed attempts.",
+	})
+
+	reservationsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reservations_created_total",
+		Help:      "Reservations made through the website.",
+	})
+
+	reservationsCancelled = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reservations_cancelled_total",
+		Help:      "Reservations cancelled by an administrator.",
+	})
+
+	availabilityCache = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "availability_cache_lookups_total",
+		Help:      "Availability lookups by whether they were served from the cache (hit) or the database (miss).",
+	}, []string{"result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		mailSent,
+		mailFailures,
+		mailDead,
+		reservationsCreated,
+		reservationsCancelled,
+		availabilityCache,
+	)
+}
+
+//Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+//ObserveRequest records one HTTP request
+func ObserveRequest(method, route string, status int, elapsed time.Duration) {
+	httpRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	httpDuration.WithLabelValues(method, route).Observe(elapsed.Seconds())
+}
+
+//MailSent records a delivered email
+func MailSent() {
+	mailSent.Inc()
+}
+
+//MailFailed records a failed delivery attempt, and whether the message was given up on
+func MailFailed(dead bool) {
+	mailFailures.Inc()
+	if dead {
+		mailDead.Inc()
+	}
+}
+
+//ReservationCreated records a new reservation
+func ReservationCreated() {
+	reservationsCreated.Inc()
+}
+
+//ReservationCancelled records a cancelled reservation
+func ReservationCancelled() {
+	reservationsCancelled.Inc()
+}
+
+//AvailabilityCacheLookup records an availability lookup, and whether it was served from the cache
+func AvailabilityCacheLookup(hit bool) {
+	if hit {
+		availabilityCache.WithLabelValues("hit").Inc()
+	} else {
+		availabilityCache.WithLabelValues("miss").Inc()
+	}
+}
+
+//RegisterDB exposes the connection pool statistics of db
+func RegisterDB(db *sql.DB, name string) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+//OutboxCounter is the storage the mail queue depth is read from
+type OutboxCounter interface {
+	SearchOutboxMessages(status string, limit, offset int) ([]models.OutboxMessage, int, error)
+}
+
+//RegisterMailQueue exposes the number of pending and dead messages in the outbox, read on every scrape
+func RegisterMailQueue(store OutboxCounter) error {
+	return Registry.Register(&mailQueueCollector{store: store})
+}
+
+var mailQueueDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "mail", "queue_depth"),
+	"Messages in the email outbox by status.",
+	[]string{"status"}, nil,
+)
+
+type mailQueueCollector struct {
+	store OutboxCounter
+}
+
+func (c *mailQueueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- mailQueueDesc
+}
+
+func (c *mailQueueCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, status := range []string{models.OutboxPending, models.OutboxDead} {
+		_, total, err := c.store.SearchOutboxMessages(status, 0, 0)
+		if err != nil {
+			ch <- prometheus.NewInvalidMetric(mailQueueDesc, err)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(mailQueueDesc, prometheus.GaugeValue, float64(total), status)
+	}
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Rha02/bookings/internal/models"
+)
+
+type outboxCounter struct {
+	err error
+}
+
+func (o outboxCounter) SearchOutboxMessages(status string, limit, offset int) ([]models.OutboxMessage, int, error) {
+	if status == models.OutboxDead {
+		return nil, 1, o.err
+	}
+	return nil, 4, o.err
+}
+
+func scrape() string {
+	rr := httptest.NewRecorder()
+	Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	return rr.Body.String()
+}
+
+func TestHandler(t *testing.T) {
+	ObserveRequest("GET", "/admin/reservations/{src}/{id}/show", 200, 20*time.Millisecond)
+	ReservationCreated()
+	MailFailed(true)
+
+	err := RegisterMailQueue(outboxCounter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Registry.Unregister(&mailQueueCollector{})
+
+	body := scrape()
+	for _, want := range []string{
+		`bookings_http_requests_total{method="GET",route="/admin/reservations/{src}/{id}/show",status="200"} 1`,
+		`bookings_http_request_duration_seconds_count{method="GET",route="/admin/reservations/{src}/{id}/show"} 1`,
+		`bookings_reservations_created_total 1`,
+		`bookings_mail_send_failures_total 1`,
+		`bookings_mail_dead_total 1`,
+		`bookings_mail_queue_depth{status="pending"} 4`,
+		`bookings_mail_queue_depth{status="dead"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics do not contain %s", want)
+		}
+	}
+}
+
+func TestMailQueue_Error(t *testing.T) {
+	c := &mailQueueCollector{store: outboxCounter{err: errors.New("connection refused")}}
+
+	err := Registry.Register(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Registry.Unregister(c)
+
+	rr := httptest.NewRecorder()
+	Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != 500 {
+		t.Errorf("scrape with a failing collector returned %d", rr.Code)
+	}
+}
@@ -0,0 +1,273 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+//Table records the applied versions. It has the layout soda uses, so databases it migrated are picked up as they are.
+const Table = "schema_migration"
+
+//Migration is one pair of up and down scripts
+type Migration struct {
+	Version string
+	Name    string
+	Up      string
+	Down    string
+}
+
+//Status is a migration and whether it has been applied
+type Status struct {
+	Migration
+	Applied bool
+}
+
+var fileName = regexp.MustCompile(`^(\d{14})_(\w+?)(?:\.(\w+))?\.(up|down)\.sql$`)
+
+//canonicalDialect returns the name migration files use for dialect
+func canonicalDialect(dialect string) string {
+	switch dialect {
+	case "postgresql":
+		return "postgres"
+	case "sqlite":
+		return "sqlite3"
+	}
+	return dialect
+}
+
+//Load reads the migrations for dialect from fsys, sorted by version
+func Load(fsys fs.FS, dialect string) ([]Migration, error) {
+	dialect = canonicalDialect(dialect)
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[string]*Migration{}
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil || entry.IsDir() {
+			continue
+		}
+
+		version, name, fileDialect, direction := match[1], match[2], match[3], match[4]
+		if fileDialect != "" && fileDialect != dialect {
+			continue
+		}
+
+		b, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migrate: version %s is used by both %s and %s", version, m.Name, name)
+		}
+
+		if direction == "up" {
+			m.Up = string(b)
+		} else {
+			m.Down = string(b)
+		}
+	}
+
+	var migrations []Migration
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+//Migrator applies and rolls back migrations on a database
+type Migrator struct {
+	DB         *sql.DB
+	Migrations []Migration
+}
+
+//New returns a Migrator for the migrations of dialect in fsys
+func New(db *sql.DB, fsys fs.FS, dialect string) (*Migrator, error) {
+	migrations, err := Load(fsys, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{DB: db, Migrations: migrations}, nil
+}
+
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	_, err := m.DB.ExecContext(ctx, `create table if not exists `+Table+` (version varchar(14) not null)`)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.DB.ExecContext(ctx, `create unique index if not exists `+Table+`_version_idx on `+Table+` (version)`)
+	return err
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[string]bool, error) {
+	err := m.ensureTable(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := m.DB.QueryContext(ctx, `select version from `+Table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[string]bool{}
+	for rows.Next() {
+		var version string
+		if err = rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+
+	return applied, rows.Err()
+}
+
+//Status lists every migration and whether it has been applied
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []Status
+	for _, mig := range m.Migrations {
+		statuses = append(statuses, Status{Migration: mig, Applied: applied[mig.Version]})
+	}
+
+	return statuses, nil
+}
+
+//Up applies every pending migration in version order and returns the ones it applied.
+//Each migration runs in its own transaction together with the record of its version.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, mig := range m.Migrations {
+		if applied[mig.Version] {
+			continue
+		}
+
+		err = m.run(ctx, mig.Up, `insert into `+Table+` (version) values ($1)`, mig.Version)
+		if err != nil {
+			return done, fmt.Errorf("migrate: %s_%s up: %w", mig.Version, mig.Name, err)
+		}
+		done = append(done, mig)
+	}
+
+	return done, nil
+}
+
+//Down rolls back the last steps applied migrations, newest first, and returns the ones it rolled back
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(m.Migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		mig := m.Migrations[i]
+		if !applied[mig.Version] {
+			continue
+		}
+
+		err = m.run(ctx, mig.Down, `delete from `+Table+` where version = $1`, mig.Version)
+		if err != nil {
+			return done, fmt.Errorf("migrate: %s_%s down: %w", mig.Version, mig.Name, err)
+		}
+		done = append(done, mig)
+	}
+
+	return done, nil
+}
+
+func (m *Migrator) run(ctx context.Context, script, record, version string) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if !isEmpty(script) {
+		if _, err = tx.ExecContext(ctx, script); err != nil {
+			return err
+		}
+	}
+
+	if _, err = tx.ExecContext(ctx, record, version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+//isEmpty returns true if script has nothing but blank lines and comments
+func isEmpty(script string) bool {
+	for _, line := range strings.Split(script, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
+
+var invalidName = regexp.MustCompile(`[^a-z0-9]+`)
+
+//Create writes an empty pair of migration files for dialect into dir and returns their paths
+func Create(dir, name, dialect string, now time.Time) ([]string, error) {
+	name = strings.Trim(invalidName.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return nil, errors.New("migrate: a migration needs a name")
+	}
+
+	base := now.UTC().Format("20060102150405") + "_" + name
+	if dialect != "" {
+		base += "." + canonicalDialect(dialect)
+	}
+
+	var paths []string
+	for _, direction := range []string{"up", "down"} {
+		path := filepath.Join(dir, base+"."+direction+".sql")
+		if _, err := os.Stat(path); err == nil {
+			return nil, fmt.Errorf("migrate: %s already exists", path)
+		}
+
+		err := ioutil.WriteFile(path, []byte(""), 0644)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
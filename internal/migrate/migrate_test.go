@@ -0,0 +1,149 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/Rha02/bookings/migrations"
+	_ "github.com/jackc/pgx/v4/stdlib"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"20210101000002_add_widgets.postgres.up.sql":   {Data: []byte("create table widgets ();")},
+		"20210101000002_add_widgets.postgres.down.sql": {Data: []byte("drop table widgets;")},
+		"20210101000002_add_widgets.sqlite3.up.sql":    {Data: []byte("create table widgets (id integer);")},
+		"20210101000001_seed.up.sql":                   {Data: []byte("insert into rooms values (1);")},
+		"20210101000001_seed.down.sql":                 {Data: []byte("delete from rooms;")},
+		"README.md":                                    {Data: []byte("not a migration")},
+	}
+
+	migs, err := Load(fsys, "postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migs) != 2 || migs[0].Name != "seed" || migs[1].Name != "add_widgets" {
+		t.Fatalf("unexpected migrations %+v", migs)
+	}
+	if migs[1].Up != "create table widgets ();" || migs[1].Down != "drop table widgets;" {
+		t.Errorf("postgres migration has the wrong scripts: %+v", migs[1])
+	}
+
+	fsys["20210101000002_other.up.sql"] = &fstest.MapFile{Data: []byte("")}
+	if _, err = Load(fsys, "postgres"); err == nil {
+		t.Error("two names for one version did not return an error")
+	}
+}
+
+func TestLoad_Embedded(t *testing.T) {
+	migs, err := Load(migrations.FS, "postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migs) == 0 {
+		t.Fatal("no migrations are embedded")
+	}
+	for _, m := range migs {
+		if isEmpty(m.Up) {
+			t.Errorf("%s_%s has no up script", m.Version, m.Name)
+		}
+		if m.Down == "" {
+			t.Errorf("%s_%s has no down script", m.Version, m.Name)
+		}
+	}
+}
+
+func TestIsEmpty(t *testing.T) {
+	if !isEmpty("\n-- nothing to undo\n  \n") {
+		t.Error("comment only script is not empty")
+	}
+	if isEmpty("-- drop it\ndrop table widgets;") {
+		t.Error("script with a statement is empty")
+	}
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 10, 19, 21, 30, 0, 0, time.UTC)
+
+	paths, err := Create(dir, "Add Room Prices!", "postgres", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		filepath.Join(dir, "20261019213000_add_room_prices.postgres.up.sql"),
+		filepath.Join(dir, "20261019213000_add_room_prices.postgres.down.sql"),
+	}
+	for i, path := range want {
+		if paths[i] != path {
+			t.Errorf("created %s, expected %s", paths[i], path)
+		}
+		if _, err = os.Stat(path); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err = Create(dir, "add room prices", "postgres", now); err == nil {
+		t.Error("creating an existing migration did not return an error")
+	}
+	if _, err = Create(dir, "!!", "postgres", now); err == nil {
+		t.Error("creating a migration without a name did not return an error")
+	}
+}
+
+//TestMigrator runs against the database in TEST_DATABASE_URL and is skipped when it is not set
+func TestMigrator(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	m := &Migrator{DB: db, Migrations: []Migration{
+		{Version: "99990101000001", Name: "create_widgets", Up: "create table migrate_test_widgets (id integer);", Down: "drop table migrate_test_widgets;"},
+		{Version: "99990101000002", Name: "seed_widgets", Up: "insert into migrate_test_widgets values (1); insert into migrate_test_widgets values (2);", Down: "delete from migrate_test_widgets;"},
+	}}
+	ctx := context.Background()
+	defer m.Down(ctx, 2)
+
+	done, err := m.Up(ctx)
+	if err != nil || len(done) != 2 {
+		t.Fatalf("Up applied %d migrations (err %v)", len(done), err)
+	}
+
+	var count int
+	db.QueryRow(`select count(*) from migrate_test_widgets`).Scan(&count)
+	if count != 2 {
+		t.Errorf("expected 2 widgets, got %d", count)
+	}
+
+	if done, _ = m.Up(ctx); len(done) != 0 {
+		t.Error("Up applied migrations twice")
+	}
+
+	done, err = m.Down(ctx, 1)
+	if err != nil || len(done) != 1 || done[0].Version != "99990101000002" {
+		t.Fatalf("Down rolled back %+v (err %v)", done, err)
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !statuses[0].Applied || statuses[1].Applied {
+		t.Errorf("unexpected status %+v", statuses)
+	}
+}
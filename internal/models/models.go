@@ -1,6 +1,9 @@
 package models
 
 import (
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
 	"time"
 )
 
@@ -31,18 +34,51 @@ type Restriction struct {
 }
 
 type Reservation struct {
-	ID        int
-	FirstName string
-	LastName  string
-	Email     string
-	Phone     string
-	StartDate time.Time
-	EndDate   time.Time
-	Processed int
-	RoomID    int
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	Room      Room
+	ID          int
+	FirstName   string
+	LastName    string
+	Email       string
+	Phone       string
+	StartDate   time.Time
+	EndDate     time.Time
+	Processed   int
+	RoomID      int
+	GuestID     int
+	Notes       string
+	Locale      string
+	CancelledAt time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Room        Room
+}
+
+//Cancelled returns true if the reservation has been cancelled
+func (r Reservation) Cancelled() bool {
+	return !r.CancelledAt.IsZero()
+}
+
+//Nights returns the number of nights between arrival and departure
+func (r Reservation) Nights() int {
+	return int(r.EndDate.Sub(r.StartDate).Hours() / 24)
+}
+
+//Guest is a person who has made one or more reservations, identified by normalized email
+type Guest struct {
+	ID          int
+	Email       string
+	FirstName   string
+	LastName    string
+	Phone       string
+	Notes       string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	StayCount   int
+	LastArrival time.Time
+}
+
+//NormalizeEmail returns the form of an email address used to match guests
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
 
 type RoomRestriction struct {
@@ -59,11 +95,97 @@ type RoomRestriction struct {
 	Restriction   Restriction
 }
 
-//MailData holds an email message
+//MailData holds an email message. Content is the HTML body and TextContent its plain-text alternative.
 type MailData struct {
-	To       string
-	From     string
-	Subject  string
-	Content  string
-	Template string
+	To          string
+	From        string
+	Subject     string
+	Content     string
+	TextContent string
+	Template    string
+}
+
+//MailTemplate is a named email template, with an HTML version and a plain-text version
+type MailTemplate struct {
+	HTML *htmltemplate.Template
+	Text *texttemplate.Template
+}
+
+//Property holds the details of the bed and breakfast shown in emails
+type Property struct {
+	Name    string
+	Email   string
+	Phone   string
+	Address string
+}
+
+//ReservationMail is the data passed to email templates about a reservation, with the locale
+//its dates and numbers are formatted in
+type ReservationMail struct {
+	Reservation Reservation
+	Property    Property
+	Locale      string
+}
+
+//Outbox message states
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxDead    = "dead"
+)
+
+//OutboxMessage is an email waiting in, or delivered from, the outbox table
+type OutboxMessage struct {
+	ID            int
+	Mail          MailData
+	Status        string
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	SentAt        time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+//Email schedule anchors, the reservation date a scheduled email is counted from
+const (
+	AnchorArrival   = "arrival"
+	AnchorDeparture = "departure"
+)
+
+//EmailSchedule describes an email sent automatically a number of days before or after a stay
+type EmailSchedule struct {
+	ID         int
+	Name       string
+	Template   string
+	Anchor     string
+	OffsetDays int
+	Enabled    bool
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+//DueDate returns the day the email is due for a reservation
+func (s EmailSchedule) DueDate(r Reservation) time.Time {
+	anchor := r.StartDate
+	if s.Anchor == AnchorDeparture {
+		anchor = r.EndDate
+	}
+	return anchor.AddDate(0, 0, s.OffsetDays)
+}
+
+//When returns when the email is sent relative to the stay, e.g. "before-arrival"
+func (s EmailSchedule) When() string {
+	if s.OffsetDays < 0 {
+		return "before-" + s.Anchor
+	}
+	return "after-" + s.Anchor
+}
+
+//Days returns the number of days between the email and its anchor date
+func (s EmailSchedule) Days() int {
+	if s.OffsetDays < 0 {
+		return -s.OffsetDays
+	}
+	return s.OffsetDays
 }
@@ -0,0 +1,150 @@
+package models
+
+import (
+	"html/template"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+//DefaultPageSize is the number of rows shown per page when none is requested
+const DefaultPageSize = 25
+
+//MaxPageSize is the largest page size a list can be asked for
+const MaxPageSize = 100
+
+//ReservationFilter holds the paging, sorting and filtering options for reservation lists
+type ReservationFilter struct {
+	Page     int
+	PageSize int
+	Sort     string
+	Desc     bool
+	RoomID   int
+	From     time.Time
+	To       time.Time
+	Status   string
+	Query    string
+}
+
+//Offset returns the number of rows to skip for the current page
+func (f ReservationFilter) Offset() int {
+	return (f.Page - 1) * f.PageSize
+}
+
+//Pagination describes a page of results and builds the links to other pages
+type Pagination struct {
+	Page     int
+	PageSize int
+	Total    int
+	Sort     string
+	Desc     bool
+	Query    url.Values
+}
+
+//TotalPages returns the number of pages needed to show every row
+func (p Pagination) TotalPages() int {
+	if p.PageSize <= 0 || p.Total == 0 {
+		return 1
+	}
+	return (p.Total + p.PageSize - 1) / p.PageSize
+}
+
+//HasPrev returns true if there is a page before the current one
+func (p Pagination) HasPrev() bool {
+	return p.Page > 1
+}
+
+//HasNext returns true if there is a page after the current one
+func (p Pagination) HasNext() bool {
+	return p.Page < p.TotalPages()
+}
+
+//First returns the position of the first row on the current page
+func (p Pagination) First() int {
+	if p.Total == 0 {
+		return 0
+	}
+	return (p.Page-1)*p.PageSize + 1
+}
+
+//Last returns the position of the last row on the current page
+func (p Pagination) Last() int {
+	last := p.Page * p.PageSize
+	if last > p.Total {
+		return p.Total
+	}
+	return last
+}
+
+//Pages returns the page numbers to link to around the current page
+func (p Pagination) Pages() []int {
+	start := p.Page - 2
+	if start < 1 {
+		start = 1
+	}
+
+	end := start + 4
+	if end > p.TotalPages() {
+		end = p.TotalPages()
+		if end-4 >= 1 {
+			start = end - 4
+		}
+	}
+
+	var pages []int
+	for i := start; i <= end; i++ {
+		pages = append(pages, i)
+	}
+
+	return pages
+}
+
+//PageURL returns a link to the given page that keeps the current sorting and filters
+func (p Pagination) PageURL(page int) template.URL {
+	q := p.values()
+	q.Set("page", strconv.Itoa(page))
+	return template.URL("?" + q.Encode())
+}
+
+//SortURL returns a link that sorts by column, flipping the direction if it is already sorted by it
+func (p Pagination) SortURL(column string) template.URL {
+	q := p.values()
+	q.Set("sort", column)
+	if column == p.Sort && !p.Desc {
+		q.Set("dir", "desc")
+	} else {
+		q.Set("dir", "asc")
+	}
+	q.Del("page")
+	return template.URL("?" + q.Encode())
+}
+
+//SortIndicator returns an arrow if the list is sorted by column
+func (p Pagination) SortIndicator(column string) string {
+	if column != p.Sort {
+		return ""
+	}
+	if p.Desc {
+		return "▼"
+	}
+	return "▲"
+}
+
+func (p Pagination) values() url.Values {
+	q := url.Values{}
+	for k, v := range p.Query {
+		q[k] = v
+	}
+	if p.Sort != "" {
+		q.Set("sort", p.Sort)
+		if p.Desc {
+			q.Set("dir", "desc")
+		} else {
+			q.Set("dir", "asc")
+		}
+	}
+	if p.PageSize != DefaultPageSize {
+		q.Set("size", strconv.Itoa(p.PageSize))
+	}
+	return q
+}
@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+//MonthDay is a day of every year written as month*100+day, such as 1231 for December 31st
+type MonthDay int
+
+//MonthDayOf returns the day of the year t falls on
+func MonthDayOf(t time.Time) MonthDay {
+	return MonthDay(int(t.Month())*100 + t.Day())
+}
+
+//StayRule limits the stays that can be booked in some rooms. A rule applies to stays arriving in its
+//season in one of its rooms; zero values leave the matching limit off.
+type StayRule struct {
+	Name string
+	//RoomIDs are the rooms the rule applies to, every room when empty
+	RoomIDs []int
+	//SeasonStart and SeasonEnd are the first and last arrival days the rule applies to, every day when both
+	//are zero. A season whose end comes before its start wraps around the new year.
+	SeasonStart MonthDay
+	SeasonEnd   MonthDay
+
+	MinNights         int
+	MaxNights         int
+	ClosedToArrival   []time.Weekday
+	ClosedToDeparture []time.Weekday
+	//MaxDaysAhead is how many days from today a stay can arrive at the latest
+	MaxDaysAhead int
+	//BufferNights is how many nights must stay free between the stay and any other stay or block of its room
+	BufferNights int
+}
+
+//Applies returns true if the rule covers a stay in the room arriving on arrival
+func (r StayRule) Applies(roomID int, arrival time.Time) bool {
+	if len(r.RoomIDs) > 0 {
+		found := false
+		for _, id := range r.RoomIDs {
+			if id == roomID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if r.SeasonStart == 0 && r.SeasonEnd == 0 {
+		return true
+	}
+
+	day := MonthDayOf(arrival)
+	if r.SeasonStart <= r.SeasonEnd {
+		return day >= r.SeasonStart && day <= r.SeasonEnd
+	}
+	return day >= r.SeasonStart || day <= r.SeasonEnd
+}
@@ -0,0 +1,160 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/Rha02/bookings/internal/models"
+)
+
+var pathToMailTemplates = "./email-templates"
+
+//mailTemplates returns the cached email templates, or parses them again when the cache is off
+func mailTemplates() (map[string]*models.MailTemplate, error) {
+	if app.UseCache {
+		return app.MailTemplateCache, nil
+	}
+	return CreateMailTemplateCache()
+}
+
+//Mail renders the named email template with data, returning a message with the subject and both bodies set.
+//The subject comes from the "subject" block of the plain-text template.
+func Mail(name string, data interface{}) (models.MailData, error) {
+	tc, err := mailTemplates()
+	if err != nil {
+		return models.MailData{}, err
+	}
+
+	t, ok := tc[name]
+	if !ok {
+		return models.MailData{}, fmt.Errorf("can't get email template %s from cache", name)
+	}
+
+	var subject, text, html bytes.Buffer
+
+	err = t.Text.ExecuteTemplate(&subject, "subject", data)
+	if err != nil {
+		return models.MailData{}, err
+	}
+
+	err = t.Text.Execute(&text, data)
+	if err != nil {
+		return models.MailData{}, err
+	}
+
+	err = t.HTML.Execute(&html, data)
+	if err != nil {
+		return models.MailData{}, err
+	}
+
+	return models.MailData{
+		Subject:     strings.TrimSpace(subject.String()),
+		Content:     html.String(),
+		TextContent: strings.TrimSpace(text.String()) + "\n",
+		Template:    name,
+	}, nil
+}
+
+//LocalizedMail renders the translation of the named email template into the locale, name.<locale>, or the
+//template itself when it has no translation into the locale. The message is still named after the template.
+func LocalizedMail(name, locale string, data interface{}) (models.MailData, error) {
+	tc, err := mailTemplates()
+	if err != nil {
+		return models.MailData{}, err
+	}
+
+	if _, ok := tc[name+"."+locale]; !ok || locale == "" {
+		return Mail(name, data)
+	}
+
+	msg, err := Mail(name+"."+locale, data)
+	msg.Template = name
+	return msg, err
+}
+
+//MailTemplateNames returns the names of the available email templates, sorted, leaving out their translations
+func MailTemplateNames() ([]string, error) {
+	tc, err := mailTemplates()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name := range tc {
+		if strings.Contains(name, ".") {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+//CreateMailTemplateCache creates a cache of email templates as a map.
+//Every name.mail.html needs a matching name.mail.txt, and each is parsed with the layouts of its type.
+//Translations of a template into a locale are named name.<locale>, such as reservation-confirmation.es.
+func CreateMailTemplateCache() (map[string]*models.MailTemplate, error) {
+	myCache := map[string]*models.MailTemplate{}
+
+	pages, err := filepath.Glob(fmt.Sprintf("%s/*.mail.html", pathToMailTemplates))
+	if err != nil {
+		return myCache, err
+	}
+
+	for _, page := range pages {
+		name := strings.TrimSuffix(filepath.Base(page), ".mail.html")
+		textPage := fmt.Sprintf("%s/%s.mail.txt", pathToMailTemplates, name)
+
+		if _, err := os.Stat(textPage); err != nil {
+			return myCache, fmt.Errorf("email template %s has no plain-text version: %w", name, err)
+		}
+
+		ht, err := htmltemplate.New(filepath.Base(page)).Funcs(functions).ParseFiles(page)
+		if err != nil {
+			return myCache, err
+		}
+
+		tt, err := texttemplate.New(filepath.Base(textPage)).Funcs(texttemplate.FuncMap(functions)).ParseFiles(textPage)
+		if err != nil {
+			return myCache, err
+		}
+
+		matches, err := filepath.Glob(fmt.Sprintf("%s/*.layout.html", pathToMailTemplates))
+		if err != nil {
+			return myCache, err
+		}
+
+		if len(matches) > 0 {
+			ht, err = ht.ParseGlob(fmt.Sprintf("%s/*.layout.html", pathToMailTemplates))
+			if err != nil {
+				return myCache, err
+			}
+		}
+
+		matches, err = filepath.Glob(fmt.Sprintf("%s/*.layout.txt", pathToMailTemplates))
+		if err != nil {
+			return myCache, err
+		}
+
+		if len(matches) > 0 {
+			tt, err = tt.ParseGlob(fmt.Sprintf("%s/*.layout.txt", pathToMailTemplates))
+			if err != nil {
+				return myCache, err
+			}
+		}
+
+		myCache[name] = &models.MailTemplate{
+			HTML: ht,
+			Text: tt,
+		}
+	}
+
+	return myCache, nil
+}
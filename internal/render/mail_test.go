@@ -0,0 +1,109 @@
+package render
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Rha02/bookings/internal/models"
+)
+
+func TestMail(t *testing.T) {
+	pathToMailTemplates = "./../../email-templates"
+
+	tc, err := CreateMailTemplateCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.MailTemplateCache = tc
+	app.UseCache = true
+
+	data := models.ReservationMail{
+		Reservation: models.Reservation{
+			FirstName: "<b>John</b>",
+			StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+			Room:      models.Room{RoomName: "General's Quarters"},
+		},
+		Property: models.Property{Name: "Fort Dagon Bed and Breakfast"},
+	}
+
+	msg, err := Mail("reservation-confirmation", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Subject != "Reservation Confirmation" {
+		t.Errorf("expected subject Reservation Confirmation, got %q", msg.Subject)
+	}
+
+	if !strings.Contains(msg.Content, "&lt;b&gt;John&lt;/b&gt;") {
+		t.Error("guest name was not escaped in the HTML body")
+	}
+
+	if !strings.Contains(msg.TextContent, "Dear <b>John</b>,") || !strings.Contains(msg.TextContent, "from January 1, 2050 to January 3, 2050") {
+		t.Errorf("unexpected plain-text body: %s", msg.TextContent)
+	}
+
+	if strings.Contains(msg.TextContent, "<html") {
+		t.Error("plain-text body contains the HTML layout")
+	}
+
+	_, err = Mail("non-existent", data)
+	if err == nil {
+		t.Error("rendered email template that does not exist")
+	}
+}
+
+func TestLocalizedMail(t *testing.T) {
+	pathToMailTemplates = "./../../email-templates"
+
+	tc, err := CreateMailTemplateCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.MailTemplateCache = tc
+	app.UseCache = true
+
+	data := models.ReservationMail{
+		Reservation: models.Reservation{
+			FirstName: "Juan",
+			StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+		},
+		Property: models.Property{Name: "Fort Dagon Bed and Breakfast"},
+		Locale:   "es",
+	}
+
+	msg, err := LocalizedMail("reservation-confirmation", "es", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Subject != "Confirmación de reserva" || msg.Template != "reservation-confirmation" {
+		t.Errorf("expected the Spanish confirmation, got subject %q from %s", msg.Subject, msg.Template)
+	}
+	if !strings.Contains(msg.TextContent, "del 1 de enero de 2050 al 3 de enero de 2050") {
+		t.Errorf("unexpected plain-text body: %s", msg.TextContent)
+	}
+
+	//templates without a translation into the locale are sent as they are
+	msg, err = LocalizedMail("reservation-notification", "es", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Subject != "Reservation Notification" {
+		t.Errorf("expected the untranslated notification, got subject %q", msg.Subject)
+	}
+
+	names, err := MailTemplateNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if strings.Contains(name, ".") {
+			t.Errorf("expected translations to be left out of the template names, got %v", names)
+		}
+	}
+}
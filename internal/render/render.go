@@ -10,6 +10,8 @@ import (
 	"time"
 
 	"github.com/Rha02/bookings/internal/config"
+	"github.com/Rha02/bookings/internal/i18n"
+	"github.com/Rha02/bookings/internal/logging"
 	"github.com/Rha02/bookings/internal/models"
 	"github.com/justinas/nosurf"
 )
@@ -19,6 +21,10 @@ var functions = template.FuncMap{
 	"formatDate": FormatDate,
 	"iterate":    Iterate,
 	"add":        Add,
+	"t":          i18n.T,
+	"date":       i18n.FormatDate,
+	"number":     i18n.FormatNumber,
+	"locales":    i18n.Locales,
 }
 
 var app *config.AppConfig
@@ -32,7 +38,8 @@ func NewRenderer(a *config.AppConfig) {
 	app = a
 }
 
-//HumanDate formats time to a user friendly format (MM-DD-YYYY)
+//HumanDate formats time in the format dates are entered in (MM-DD-YYYY), for form values and links.
+//Dates shown to people are formatted in their locale by the date function of templates.
 func HumanDate(t time.Time) string {
 	return t.Format("01-02-2006")
 }
@@ -56,6 +63,7 @@ func AddDefaultData(td *models.TemplateData, r *http.Request) *models.TemplateDa
 	td.Warning = app.Session.PopString(r.Context(), "warning")
 	td.Error = app.Session.PopString(r.Context(), "error")
 	td.CSRFToken = nosurf.Token(r)
+	td.Locale = i18n.FromContext(r.Context())
 	if app.Session.Exists(r.Context(), "user_id") {
 		td.IsAuthenticated = 1
 	}
@@ -84,7 +92,7 @@ func Template(rw http.ResponseWriter, r *http.Request, tmpl string, td *models.T
 
 	_, err := buf.WriteTo(rw)
 	if err != nil {
-		fmt.Println("Error writing template to browser", err)
+		logging.FromRequest(r).Error().Err(err).Msg("cannot write template to browser")
 		return err
 	}
 
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"testing"
 
+	"github.com/Rha02/bookings/internal/i18n"
 	"github.com/Rha02/bookings/internal/models"
 )
 
@@ -24,6 +25,22 @@ func TestAddDefaultData(t *testing.T) {
 	}
 }
 
+func TestAddDefaultData_Locale(t *testing.T) {
+	r, err := getSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if td := AddDefaultData(&models.TemplateData{}, r); td.Locale != "en" {
+		t.Errorf("expected the default locale, got %q", td.Locale)
+	}
+
+	r = r.WithContext(i18n.WithLocale(r.Context(), "es"))
+	if td := AddDefaultData(&models.TemplateData{}, r); td.Locale != "es" {
+		t.Errorf("expected es, got %q", td.Locale)
+	}
+}
+
 func TestTemplate(t *testing.T) {
 	pathToTemplates = "./../../templates"
 
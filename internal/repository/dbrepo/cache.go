@@ -0,0 +1,334 @@
+package dbrepo
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Rha02/bookings/internal/metrics"
+	"github.com/Rha02/bookings/internal/models"
+	"github.com/Rha02/bookings/internal/repository"
+)
+
+//maxCacheEntries is the number of availability results, and of restriction dates, kept before expired ones are dropped
+const maxCacheEntries = 10000
+
+//cache entry kinds, one per cached lookup
+const (
+	cacheCheck = iota
+	cacheSearch
+	cacheRestrictions
+)
+
+//cacheKey identifies a lookup by kind, room and dates. Dates are kept as instants so equal times
+//in different zones share an entry. Searches over every room have room 0.
+type cacheKey struct {
+	kind   int
+	roomID int
+	start  int64
+	end    int64
+}
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+//cacheSpan is the room and dates of a restriction returned by a cached lookup, kept while that lookup is
+type cacheSpan struct {
+	restriction models.RoomRestriction
+	expires     time.Time
+}
+
+//cachedRepo keeps the results of availability lookups in memory. Writes that can change availability
+//remove the entries whose dates overlap the dates written, and no entry is read or stored while such a
+//write is in progress. Entries expire after ttl, so changes made by other processes are picked up then;
+//the cache is only safe to use with a ttl above 0 when this process is the only one writing bookings.
+type cachedRepo struct {
+	repository.DatabaseRepo
+
+	ttl time.Duration
+	now func() time.Time
+
+	mu         sync.Mutex
+	entries    map[cacheKey]cacheEntry
+	spans      map[int]cacheSpan
+	generation uint64
+	writes     int
+}
+
+//NewCachedRepo returns repo with availability lookups cached for up to ttl
+func NewCachedRepo(repo repository.DatabaseRepo, ttl time.Duration) repository.DatabaseRepo {
+	return &cachedRepo{
+		DatabaseRepo: repo,
+		ttl:          ttl,
+		now:          time.Now,
+		entries:      make(map[cacheKey]cacheEntry),
+		spans:        make(map[int]cacheSpan),
+	}
+}
+
+func newCacheKey(kind, roomID int, start, end time.Time) cacheKey {
+	return cacheKey{kind: kind, roomID: roomID, start: start.UnixNano(), end: end.UnixNano()}
+}
+
+//get returns the cached value for key, or the generation to store the value read from the database with
+func (c *cachedRepo) get(key cacheKey) (interface{}, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.writes > 0 {
+		metrics.AvailabilityCacheLookup(false)
+		return nil, c.generation, false
+	}
+
+	e, ok := c.entries[key]
+	if !ok || !c.now().Before(e.expires) {
+		metrics.AvailabilityCacheLookup(false)
+		return nil, c.generation, false
+	}
+
+	metrics.AvailabilityCacheLookup(true)
+	return e.value, 0, true
+}
+
+//put stores a value read from the database, unless a write started since the read
+func (c *cachedRepo) put(key cacheKey, value interface{}, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.writes > 0 || c.generation != generation {
+		return
+	}
+
+	now := c.now()
+
+	if len(c.entries) >= maxCacheEntries {
+		c.prune(now)
+	}
+
+	c.entries[key] = cacheEntry{value: value, expires: now.Add(c.ttl)}
+}
+
+//prune drops the expired entries and restriction dates, and everything if that does not make room.
+//It must be called with mu held.
+func (c *cachedRepo) prune(now time.Time) {
+	for k, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	if len(c.entries) >= maxCacheEntries {
+		c.entries = make(map[cacheKey]cacheEntry)
+	}
+
+	for id, span := range c.spans {
+		if !now.Before(span.expires) {
+			delete(c.spans, id)
+		}
+	}
+	if len(c.spans) >= maxCacheEntries {
+		c.spans = make(map[int]cacheSpan)
+	}
+}
+
+//beginWrite stops the cache from being used until the matching endWrite
+func (c *cachedRepo) beginWrite() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.writes++
+	c.generation++
+}
+
+//endWrite removes the entries whose dates overlap the nights from start to end of the room,
+//and every search over all rooms that overlaps them
+func (c *cachedRepo) endWrite(roomID int, start, end time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.writes--
+	c.generation++
+
+	s, e := start.UnixNano(), end.UnixNano()
+
+	for k := range c.entries {
+		if k.roomID != roomID && k.kind != cacheSearch {
+			continue
+		}
+		//restriction lookups include restrictions starting on their last day, so their end is inclusive
+		if k.start < e && (k.end > s || k.kind == cacheRestrictions && k.end == s) {
+			delete(c.entries, k)
+		}
+	}
+}
+
+//endWriteAll removes every entry, for writes whose room or dates are not known
+func (c *cachedRepo) endWriteAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.writes--
+	c.generation++
+
+	c.entries = make(map[cacheKey]cacheEntry)
+}
+
+//CheckAvailabilityByDatesByRoomID returns true if the room is free from start to end
+func (c *cachedRepo) CheckAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error) {
+	key := newCacheKey(cacheCheck, roomID, start, end)
+
+	v, generation, ok := c.get(key)
+	if ok {
+		return v.(bool), nil
+	}
+
+	available, err := c.DatabaseRepo.CheckAvailabilityByDatesByRoomID(start, end, roomID)
+	if err != nil {
+		return available, err
+	}
+
+	c.put(key, available, generation)
+
+	return available, nil
+}
+
+//SearchAvailabilityForAllRooms returns the rooms that are free from start to end
+func (c *cachedRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
+	key := newCacheKey(cacheSearch, 0, start, end)
+
+	v, generation, ok := c.get(key)
+	if ok {
+		return append([]models.Room(nil), v.([]models.Room)...), nil
+	}
+
+	rooms, err := c.DatabaseRepo.SearchAvailabilityForAllRooms(start, end)
+	if err != nil {
+		return rooms, err
+	}
+
+	c.put(key, append([]models.Room(nil), rooms...), generation)
+
+	return rooms, nil
+}
+
+//GetRestrictionsForRoomByDate returns the restrictions of the room between start and end.
+//The dates of the restrictions are remembered as long as the lookup is cached, so deleting one of
+//them only invalidates its dates.
+func (c *cachedRepo) GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
+	key := newCacheKey(cacheRestrictions, roomID, start, end)
+
+	v, generation, ok := c.get(key)
+	if ok {
+		return append([]models.RoomRestriction(nil), v.([]models.RoomRestriction)...), nil
+	}
+
+	restrictions, err := c.DatabaseRepo.GetRestrictionsForRoomByDate(roomID, start, end)
+	if err != nil {
+		return restrictions, err
+	}
+
+	c.mu.Lock()
+	now := c.now()
+	if len(c.spans)+len(restrictions) >= maxCacheEntries {
+		c.prune(now)
+	}
+	for _, r := range restrictions {
+		c.spans[r.ID] = cacheSpan{
+			restriction: models.RoomRestriction{RoomID: r.RoomID, StartDate: r.StartDate, EndDate: r.EndDate},
+			expires:     now.Add(c.ttl),
+		}
+	}
+	c.mu.Unlock()
+
+	c.put(key, append([]models.RoomRestriction(nil), restrictions...), generation)
+
+	return restrictions, nil
+}
+
+func (c *cachedRepo) InsertRoomRestriction(r models.RoomRestriction) error {
+	c.beginWrite()
+	defer c.endWrite(r.RoomID, r.StartDate, r.EndDate)
+
+	return c.DatabaseRepo.InsertRoomRestriction(r)
+}
+
+func (c *cachedRepo) InsertBlockForRoom(id int, startDate time.Time) error {
+	c.beginWrite()
+	defer c.endWrite(id, startDate, startDate.AddDate(0, 0, 1))
+
+	return c.DatabaseRepo.InsertBlockForRoom(id, startDate)
+}
+
+//DeleteBlockByID deletes a block, invalidating its dates if it was returned by a restriction lookup
+//and the whole cache otherwise
+func (c *cachedRepo) DeleteBlockByID(id int) error {
+	c.mu.Lock()
+	span, ok := c.spans[id]
+	delete(c.spans, id)
+	c.mu.Unlock()
+
+	c.beginWrite()
+	if ok {
+		defer c.endWrite(span.restriction.RoomID, span.restriction.StartDate, span.restriction.EndDate)
+	} else {
+		defer c.endWriteAll()
+	}
+
+	return c.DatabaseRepo.DeleteBlockByID(id)
+}
+
+func (c *cachedRepo) BookReservation(res models.Reservation, bufferNights int, mail []models.MailData) (int, error) {
+	c.beginWrite()
+	defer c.endWrite(res.RoomID, res.StartDate, res.EndDate)
+
+	return c.DatabaseRepo.BookReservation(res, bufferNights, mail)
+}
+
+//writeReservation runs a write to the reservation with the given id, invalidating its room and dates
+func (c *cachedRepo) writeReservation(id int, write func() error) error {
+	c.beginWrite()
+
+	res, err := c.DatabaseRepo.GetReservationByID(id)
+	if err != nil {
+		defer c.endWriteAll()
+	} else {
+		defer c.endWrite(res.RoomID, res.StartDate, res.EndDate)
+	}
+
+	return write()
+}
+
+func (c *cachedRepo) UpdateReservation(r models.Reservation) error {
+	return c.writeReservation(r.ID, func() error {
+		return c.DatabaseRepo.UpdateReservation(r)
+	})
+}
+
+func (c *cachedRepo) CancelReservation(id int) error {
+	return c.writeReservation(id, func() error {
+		return c.DatabaseRepo.CancelReservation(id)
+	})
+}
+
+func (c *cachedRepo) DeleteReservation(id int) error {
+	return c.writeReservation(id, func() error {
+		return c.DatabaseRepo.DeleteReservation(id)
+	})
+}
+
+//Transaction runs fn without the cache, as its writes cannot be seen until they are committed,
+//and empties the cache afterwards
+func (c *cachedRepo) Transaction(fn func(repo repository.DatabaseRepo) error) error {
+	c.beginWrite()
+	defer c.endWriteAll()
+
+	return c.DatabaseRepo.Transaction(fn)
+}
+
+//InsertRoom inserts a room, which is free on every date any cached search covers
+func (c *cachedRepo) InsertRoom(r models.Room) (int, error) {
+	c.beginWrite()
+	defer c.endWriteAll()
+
+	return c.DatabaseRepo.InsertRoom(r)
+}
@@ -0,0 +1,225 @@
+package dbrepo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Rha02/bookings/internal/config"
+	"github.com/Rha02/bookings/internal/models"
+	"github.com/Rha02/bookings/internal/repository"
+	"github.com/Rha02/bookings/internal/repository/repotest"
+)
+
+//countingRepo counts the availability lookups that reach the repository it wraps
+type countingRepo struct {
+	repository.DatabaseRepo
+	lookups int
+}
+
+func (c *countingRepo) CheckAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error) {
+	c.lookups++
+	return c.DatabaseRepo.CheckAvailabilityByDatesByRoomID(start, end, roomID)
+}
+
+func (c *countingRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
+	c.lookups++
+	return c.DatabaseRepo.SearchAvailabilityForAllRooms(start, end)
+}
+
+func (c *countingRepo) GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
+	c.lookups++
+	return c.DatabaseRepo.GetRestrictionsForRoomByDate(roomID, start, end)
+}
+
+//newCountingCache returns a cache over a memory repository with room 1 booked from the 10th to the 15th
+func newCountingCache(t *testing.T) (*cachedRepo, *countingRepo) {
+	mem := NewMemoryRepo(&config.AppConfig{})
+
+	_, err := mem.BookReservation(models.Reservation{
+		FirstName: "John", LastName: "Smith", Email: "john@here.com",
+		StartDate: repotest.Date(10), EndDate: repotest.Date(15), RoomID: 1,
+	}, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counter := &countingRepo{DatabaseRepo: mem}
+
+	return NewCachedRepo(counter, time.Minute).(*cachedRepo), counter
+}
+
+func TestCachedRepo_Conformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repository.DatabaseRepo {
+		return NewCachedRepo(NewMemoryRepo(&config.AppConfig{}), time.Minute)
+	})
+}
+
+func TestCachedRepo_Hits(t *testing.T) {
+	cache, counter := newCountingCache(t)
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := cache.CheckAvailabilityByDatesByRoomID(repotest.Date(12), repotest.Date(13), 1); ok {
+			t.Error("room 1 is available during its reservation")
+		}
+		if rooms, _ := cache.SearchAvailabilityForAllRooms(repotest.Date(12), repotest.Date(13)); len(rooms) != 1 {
+			t.Errorf("expected 1 free room, got %+v", rooms)
+		}
+		if restrictions, _ := cache.GetRestrictionsForRoomByDate(1, repotest.Date(1), repotest.Date(31)); len(restrictions) != 1 {
+			t.Errorf("expected 1 restriction, got %+v", restrictions)
+		}
+	}
+
+	if counter.lookups != 3 {
+		t.Errorf("expected 3 lookups to reach the database, got %d", counter.lookups)
+	}
+
+	//the same instants in another zone share the entries
+	local := time.FixedZone("UTC+5", 5*3600)
+	cache.CheckAvailabilityByDatesByRoomID(repotest.Date(12).In(local), repotest.Date(13).In(local), 1)
+	if counter.lookups != 3 {
+		t.Errorf("a lookup in another zone reached the database")
+	}
+
+	cache.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	cache.CheckAvailabilityByDatesByRoomID(repotest.Date(12), repotest.Date(13), 1)
+	if counter.lookups != 4 {
+		t.Errorf("an expired entry was served")
+	}
+}
+
+func TestCachedRepo_Invalidation(t *testing.T) {
+	var tests = []struct {
+		name string
+		//write changes the repository; the lookups of room 1 and of every room on the 20th are cached before it
+		write func(c *cachedRepo) error
+		//kept is true if the cached lookups do not overlap the write
+		kept bool
+	}{
+		{"block on the night", func(c *cachedRepo) error { return c.InsertBlockForRoom(1, repotest.Date(20)) }, false},
+		{"block on the departure day", func(c *cachedRepo) error { return c.InsertBlockForRoom(1, repotest.Date(21)) }, true},
+		{"block the night before", func(c *cachedRepo) error { return c.InsertBlockForRoom(1, repotest.Date(19)) }, true},
+		{"block on another room", func(c *cachedRepo) error { return c.InsertBlockForRoom(2, repotest.Date(20)) }, false},
+		{"restriction on the night", func(c *cachedRepo) error {
+			return c.InsertRoomRestriction(models.RoomRestriction{StartDate: repotest.Date(18), EndDate: repotest.Date(22), RoomID: 1, RestrictionID: 2})
+		}, false},
+		{"booking on the night", func(c *cachedRepo) error {
+			_, err := c.BookReservation(models.Reservation{Email: "a@b.c", StartDate: repotest.Date(20), EndDate: repotest.Date(21), RoomID: 1}, 0, nil)
+			return err
+		}, false},
+		{"booking elsewhere", func(c *cachedRepo) error {
+			_, err := c.BookReservation(models.Reservation{Email: "a@b.c", StartDate: repotest.Date(2), EndDate: repotest.Date(4), RoomID: 1}, 0, nil)
+			return err
+		}, true},
+		{"cancelling another stay", func(c *cachedRepo) error { return c.CancelReservation(1) }, true},
+		{"new room", func(c *cachedRepo) error {
+			_, err := c.InsertRoom(models.Room{RoomName: "Admiral's Cabin"})
+			return err
+		}, false},
+	}
+
+	for _, e := range tests {
+		cache, counter := newCountingCache(t)
+		night := func() {
+			cache.CheckAvailabilityByDatesByRoomID(repotest.Date(20), repotest.Date(21), 1)
+			cache.SearchAvailabilityForAllRooms(repotest.Date(20), repotest.Date(21))
+		}
+
+		night()
+		if err := e.write(cache); err != nil {
+			t.Fatalf("%s: %s", e.name, err)
+		}
+
+		before := counter.lookups
+		night()
+
+		if kept := counter.lookups == before; kept != e.kept {
+			t.Errorf("%s: expected cached lookups to be kept %t, got %t", e.name, e.kept, kept)
+		}
+	}
+}
+
+func TestCachedRepo_DeleteBlock(t *testing.T) {
+	cache, counter := newCountingCache(t)
+
+	cache.InsertBlockForRoom(2, repotest.Date(20))
+	cache.InsertBlockForRoom(2, repotest.Date(25))
+
+	restrictions, _ := cache.GetRestrictionsForRoomByDate(2, repotest.Date(1), repotest.Date(31))
+	if len(restrictions) != 2 {
+		t.Fatalf("expected 2 blocks, got %+v", restrictions)
+	}
+
+	cache.CheckAvailabilityByDatesByRoomID(repotest.Date(25), repotest.Date(26), 2)
+	cache.CheckAvailabilityByDatesByRoomID(repotest.Date(12), repotest.Date(13), 1)
+
+	var block models.RoomRestriction
+	for _, r := range restrictions {
+		if r.StartDate.Equal(repotest.Date(25)) {
+			block = r
+		}
+	}
+
+	if err := cache.DeleteBlockByID(block.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	before := counter.lookups
+
+	if ok, _ := cache.CheckAvailabilityByDatesByRoomID(repotest.Date(25), repotest.Date(26), 2); !ok {
+		t.Error("room 2 is still blocked after the block was deleted")
+	}
+	if restrictions, _ = cache.GetRestrictionsForRoomByDate(2, repotest.Date(1), repotest.Date(31)); len(restrictions) != 1 {
+		t.Errorf("expected 1 block after deleting one, got %+v", restrictions)
+	}
+	cache.CheckAvailabilityByDatesByRoomID(repotest.Date(12), repotest.Date(13), 1)
+
+	if counter.lookups != before+2 {
+		t.Errorf("expected only the lookups overlapping the block to reach the database, got %d", counter.lookups-before)
+	}
+
+	//a block the cache has not seen could be anywhere
+	cache.DeleteBlockByID(99)
+	cache.CheckAvailabilityByDatesByRoomID(repotest.Date(12), repotest.Date(13), 1)
+
+	if counter.lookups != before+3 {
+		t.Error("deleting an unknown block did not empty the cache")
+	}
+}
+
+func TestCachedRepo_WriteInProgress(t *testing.T) {
+	cache, counter := newCountingCache(t)
+
+	cache.beginWrite()
+	cache.CheckAvailabilityByDatesByRoomID(repotest.Date(20), repotest.Date(21), 1)
+	cache.CheckAvailabilityByDatesByRoomID(repotest.Date(20), repotest.Date(21), 1)
+	cache.endWrite(2, repotest.Date(1), repotest.Date(2))
+
+	if counter.lookups != 2 {
+		t.Errorf("the cache was used during a write")
+	}
+
+	if len(cache.entries) != 0 {
+		t.Errorf("a lookup made during a write was stored")
+	}
+}
+
+func TestCachedRepo_PrunesSpans(t *testing.T) {
+	cache, _ := newCountingCache(t)
+
+	expired := time.Now().Add(-time.Second)
+	for id := 1000; id < 1000+maxCacheEntries; id++ {
+		cache.spans[id] = cacheSpan{restriction: models.RoomRestriction{RoomID: 2}, expires: expired}
+	}
+
+	restrictions, _ := cache.GetRestrictionsForRoomByDate(1, repotest.Date(1), repotest.Date(31))
+	if len(restrictions) != 1 {
+		t.Fatalf("expected 1 restriction, got %+v", restrictions)
+	}
+
+	if len(cache.spans) != 1 {
+		t.Errorf("expected the expired restriction dates to be dropped, %d are kept", len(cache.spans))
+	}
+	if _, ok := cache.spans[restrictions[0].ID]; !ok {
+		t.Error("the dates of the restriction just read were not kept")
+	}
+}
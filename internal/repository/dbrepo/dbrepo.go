@@ -1,20 +1,24 @@
 package dbrepo
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/Rha02/bookings/internal/config"
+	"github.com/Rha02/bookings/internal/driver"
 	"github.com/Rha02/bookings/internal/repository"
+	"github.com/mattn/go-sqlite3"
 )
 
 type postgresDBRepo struct {
 	App *config.AppConfig
 	DB  *sql.DB
-}
 
-type testDBRepo struct {
-	App *config.AppConfig
-	DB  *sql.DB
+	//tx is the transaction every statement runs in, for repositories passed to a Transaction function
+	tx *sql.Tx
 }
 
 func NewPostgresRepo(conn *sql.DB, a *config.AppConfig) repository.DatabaseRepo {
@@ -24,8 +28,137 @@ func NewPostgresRepo(conn *sql.DB, a *config.AppConfig) repository.DatabaseRepo
 	}
 }
 
-func NewTestingRepo(a *config.AppConfig) repository.DatabaseRepo {
-	return &testDBRepo{
-		App: a,
+//New returns the repository for the dialect of db
+func New(db *driver.DB, a *config.AppConfig) repository.DatabaseRepo {
+	if db.Dialect == driver.DialectSQLite {
+		return NewSQLiteRepo(db.SQL, a)
+	}
+	return NewPostgresRepo(db.SQL, a)
+}
+
+//conn is satisfied by both *sql.DB and *sql.Tx, so statements can be shared between them
+type conn interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+//txConn is a transaction, or a savepoint inside the transaction of the repository
+type txConn interface {
+	conn
+	Commit() error
+	Rollback() error
+}
+
+//conn returns what the repository's statements run on
+func (m *postgresDBRepo) conn() conn {
+	if m.tx != nil {
+		return m.tx
+	}
+	return m.DB
+}
+
+//begin starts a transaction, or a savepoint when the repository already runs in one,
+//so methods writing several rows stay atomic either way
+func (m *postgresDBRepo) begin(ctx context.Context) (txConn, error) {
+	if m.tx == nil {
+		return m.DB.BeginTx(ctx, nil)
+	}
+
+	_, err := m.tx.ExecContext(ctx, `savepoint nested`)
+	if err != nil {
+		return nil, err
+	}
+
+	return &savepoint{Tx: m.tx, ctx: ctx}, nil
+}
+
+//savepoint is a txConn nested in a transaction. Like a transaction, it can be rolled back after being committed,
+//which does nothing.
+type savepoint struct {
+	*sql.Tx
+	ctx  context.Context
+	done bool
+}
+
+func (s *savepoint) Commit() error {
+	if s.done {
+		return sql.ErrTxDone
+	}
+	s.done = true
+	_, err := s.Tx.ExecContext(s.ctx, `release savepoint nested`)
+	return err
+}
+
+func (s *savepoint) Rollback() error {
+	if s.done {
+		return sql.ErrTxDone
+	}
+	s.done = true
+	_, err := s.Tx.ExecContext(s.ctx, `rollback to savepoint nested`)
+	if err != nil {
+		return err
+	}
+	_, err = s.Tx.ExecContext(s.ctx, `release savepoint nested`)
+	return err
+}
+
+//Transaction runs fn with a repository whose statements all run in one transaction, committed if fn returns nil
+//and rolled back otherwise. Within a transaction, fn runs in the same one.
+func (m *postgresDBRepo) Transaction(fn func(repo repository.DatabaseRepo) error) error {
+	return m.transaction(fn, func(tx postgresDBRepo) repository.DatabaseRepo { return &tx })
+}
+
+//transaction runs fn with the repository returned by wrap for a copy of m bound to a new transaction
+func (m *postgresDBRepo) transaction(fn func(repo repository.DatabaseRepo) error, wrap func(tx postgresDBRepo) repository.DatabaseRepo) error {
+	if m.tx != nil {
+		return fn(wrap(*m))
+	}
+
+	tx, err := m.DB.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(wrap(postgresDBRepo{App: m.App, DB: m.DB, tx: tx}))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+//nullTime scans a nullable or computed timestamp, leaving the zero time for NULL.
+//SQLite returns computed timestamps as text, so those are parsed.
+type nullTime struct {
+	t *time.Time
+}
+
+func (n nullTime) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*n.t = time.Time{}
+		return nil
+	case time.Time:
+		*n.t = v
+		return nil
+	case []byte:
+		return n.parse(string(v))
+	case string:
+		return n.parse(v)
+	}
+	return fmt.Errorf("cannot scan %T into a time", value)
+}
+
+func (n nullTime) parse(s string) error {
+	s = strings.TrimSuffix(s, "Z")
+	for _, layout := range sqlite3.SQLiteTimestampFormats {
+		t, err := time.ParseInLocation(layout, s, time.UTC)
+		if err == nil {
+			*n.t = t
+			return nil
+		}
 	}
+	return fmt.Errorf("cannot parse %q as a time", s)
 }
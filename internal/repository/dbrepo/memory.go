@@ -0,0 +1,1430 @@
+package dbrepo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Rha02/bookings/internal/config"
+	"github.com/Rha02/bookings/internal/models"
+	"github.com/Rha02/bookings/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+//MemoryRepo is a DatabaseRepo that keeps its data in memory. It follows the Postgres repository, down to
+//returning sql.ErrNoRows for missing rows and rejecting rows that point at missing rooms, so tests can run
+//whole booking flows against it. Fail injects errors into chosen methods to test error paths.
+type MemoryRepo struct {
+	App *config.AppConfig
+
+	mu           sync.Mutex
+	faults       map[string]error
+	ids          map[string]int
+	users        map[int]models.User
+	rooms        map[int]models.Room
+	reservations map[int]models.Reservation
+	restrictions map[int]models.RoomRestriction
+	guests       map[int]models.Guest
+	aliases      map[string]int
+	outbox       map[int]models.OutboxMessage
+	schedules    map[int]models.EmailSchedule
+	sentEmails   map[[2]int]bool
+	uploads      map[string]string
+}
+
+//errForeignKey is returned for rows that refer to a missing row, as the database would refuse them
+var errForeignKey = errors.New("violates foreign key constraint")
+
+//adminPasswordHash is the password of the admin user added by the migrations
+const adminPasswordHash = "$2a$12$DkLLLLs14RFOnQIcnupWguVE7w2JLTKYinGqzsSoBl8xT8VC1hD1S"
+
+//NewMemoryRepo returns an in-memory repository holding the rooms, admin user and email schedules
+//that the migrations add to a new database
+func NewMemoryRepo(a *config.AppConfig) *MemoryRepo {
+	m := &MemoryRepo{App: a}
+	m.Reset()
+	return m
+}
+
+//Reset removes every fault and restores the data of a freshly migrated database
+func (m *MemoryRepo) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.faults = make(map[string]error)
+	m.ids = make(map[string]int)
+	m.users = make(map[int]models.User)
+	m.rooms = make(map[int]models.Room)
+	m.reservations = make(map[int]models.Reservation)
+	m.restrictions = make(map[int]models.RoomRestriction)
+	m.guests = make(map[int]models.Guest)
+	m.aliases = make(map[string]int)
+	m.outbox = make(map[int]models.OutboxMessage)
+	m.schedules = make(map[int]models.EmailSchedule)
+	m.sentEmails = make(map[[2]int]bool)
+	m.uploads = make(map[string]string)
+
+	created := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, name := range []string{"General's Quarters", "Colonel's Suite"} {
+		id := m.nextID("rooms")
+		m.rooms[id] = models.Room{ID: id, RoomName: name, CreatedAt: created, UpdatedAt: created}
+	}
+
+	id := m.nextID("users")
+	m.users[id] = models.User{
+		ID: id, FirstName: "Admin", LastName: "Adminovsky", Email: "admin@bookings.loc", Password: adminPasswordHash,
+		AccessLevel: 3, CreatedAt: created, UpdatedAt: created,
+	}
+
+	for _, s := range []models.EmailSchedule{
+		{Name: "Pre-arrival reminder", Template: "pre-arrival-reminder", Anchor: models.AnchorArrival, OffsetDays: -3, Enabled: true},
+		{Name: "Post-stay thank you", Template: "post-stay-thanks", Anchor: models.AnchorDeparture, OffsetDays: 1, Enabled: true},
+	} {
+		s.ID = m.nextID("email_schedules")
+		s.CreatedAt = created
+		s.UpdatedAt = created
+		m.schedules[s.ID] = s
+	}
+}
+
+//Fail makes every later call to method, named as in repository.DatabaseRepo, return err.
+//A nil err removes the fault.
+func (m *MemoryRepo) Fail(method string, err error) {
+	if _, ok := reflect.TypeOf((*repository.DatabaseRepo)(nil)).Elem().MethodByName(method); !ok {
+		panic(fmt.Sprintf("dbrepo: DatabaseRepo has no method %s", method))
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err == nil {
+		delete(m.faults, method)
+		return
+	}
+	m.faults[method] = err
+}
+
+//Transaction runs fn with the repository itself and restores the data it held before if fn fails.
+//Other writes made while fn runs are lost with it, so concurrent transactions are not isolated.
+func (m *MemoryRepo) Transaction(fn func(repo repository.DatabaseRepo) error) error {
+	m.mu.Lock()
+	if err := m.faults["Transaction"]; err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	saved := m.snapshot()
+	m.mu.Unlock()
+
+	err := fn(m)
+	if err != nil {
+		m.mu.Lock()
+		m.restore(saved)
+		m.mu.Unlock()
+	}
+
+	return err
+}
+
+//memoryData is a copy of the tables of a MemoryRepo
+type memoryData struct {
+	ids          map[string]int
+	users        map[int]models.User
+	rooms        map[int]models.Room
+	reservations map[int]models.Reservation
+	restrictions map[int]models.RoomRestriction
+	guests       map[int]models.Guest
+	aliases      map[string]int
+	outbox       map[int]models.OutboxMessage
+	schedules    map[int]models.EmailSchedule
+	sentEmails   map[[2]int]bool
+	uploads      map[string]string
+}
+
+func (m *MemoryRepo) snapshot() memoryData {
+	return memoryData{
+		ids:          copyMap(m.ids).(map[string]int),
+		users:        copyMap(m.users).(map[int]models.User),
+		rooms:        copyMap(m.rooms).(map[int]models.Room),
+		reservations: copyMap(m.reservations).(map[int]models.Reservation),
+		restrictions: copyMap(m.restrictions).(map[int]models.RoomRestriction),
+		guests:       copyMap(m.guests).(map[int]models.Guest),
+		aliases:      copyMap(m.aliases).(map[string]int),
+		outbox:       copyMap(m.outbox).(map[int]models.OutboxMessage),
+		schedules:    copyMap(m.schedules).(map[int]models.EmailSchedule),
+		sentEmails:   copyMap(m.sentEmails).(map[[2]int]bool),
+		uploads:      copyMap(m.uploads).(map[string]string),
+	}
+}
+
+func (m *MemoryRepo) restore(d memoryData) {
+	m.ids = d.ids
+	m.users = d.users
+	m.rooms = d.rooms
+	m.reservations = d.reservations
+	m.restrictions = d.restrictions
+	m.guests = d.guests
+	m.aliases = d.aliases
+	m.outbox = d.outbox
+	m.schedules = d.schedules
+	m.sentEmails = d.sentEmails
+	m.uploads = d.uploads
+}
+
+//copyMap returns a shallow copy of a map, whose values are all plain structs here
+func copyMap(src interface{}) interface{} {
+	v := reflect.ValueOf(src)
+	dst := reflect.MakeMapWithSize(v.Type(), v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		dst.SetMapIndex(iter.Key(), iter.Value())
+	}
+	return dst.Interface()
+}
+
+func (m *MemoryRepo) nextID(table string) int {
+	m.ids[table]++
+	return m.ids[table]
+}
+
+func (m *MemoryRepo) AllUsers() bool {
+	return true
+}
+
+//GetUserByID returns a user by id
+func (m *MemoryRepo) GetUserByID(id int) (models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.faults["GetUserByID"]; err != nil {
+		return models.User{}, err
+	}
+
+	u, ok := m.users[id]
+	if !ok {
+		return models.User{}, sql.ErrNoRows
+	}
+	u.Password = ""
+
+	return u, nil
+}
+
+//UpdateUser updates a user
+func (m *MemoryRepo) UpdateUser(u models.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.faults["UpdateUser"]; err != nil {
+		return err
+	}
+
+	old, ok := m.users[u.ID]
+	if !ok {
+		return nil
+	}
+
+	old.FirstName = u.FirstName
+	old.LastName = u.LastName
+	old.Email = u.Email
+	old.AccessLevel = u.AccessLevel
+	old.UpdatedAt = time.Now()
+	m.users[u.ID] = old
+
+	return nil
+}
+
+//UpsertUser inserts a user with the given password, or updates the user and password if the email is taken.
+//Passwords are hashed at the lowest cost, which keeps tests fast without changing behaviour.
+func (m *MemoryRepo) UpsertUser(u models.User, password string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.faults["UpsertUser"]; err != nil {
+		return 0, err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		return 0, err
+	}
+
+	u.Password = string(hashedPassword)
+	u.UpdatedAt = time.Now()
+	u.ID = 0
+
+	for id, existing := range m.users {
+		if existing.Email == u.Email {
+			u.ID = id
+			u.CreatedAt = existing.CreatedAt
+		}
+	}
+
+	if u.ID == 0 {
+		u.ID = m.nextID("users")
+		u.CreatedAt = u.UpdatedAt
+	}
+
+	m.users[u.ID] = u
+
+	return u.ID, nil
+}
+
+//Authenticate authenticates a user
+func (m *MemoryRepo) Authenticate(email, testPassword string) (int, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.faults["Authenticate"]; err != nil {
+		return 0, "", err
+	}
+
+	for _, u := range m.users {
+		if u.Email != email {
+			continue
+		}
+
+		err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(testPassword))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return 0, "", errors.New("incorrect password")
+		} else if err != nil {
+			return 0, "", err
+		}
+
+		return u.ID, u.Password, nil
+	}
+
+	return 0, "", sql.ErrNoRows
+}
+
+//InsertReservation inserts a reservation and links it to the guest profile for its email address
+func (m *MemoryRepo) InsertReservation(res models.Reservation) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.faults["InsertReservation"]; err != nil {
+		return 0, err
+	}
+
+	return m.insertReservation(res)
+}
+
+//BookReservation inserts a reservation, the room restriction blocking its dates and the emails about it,
+//or returns repository.ErrUnavailable if the room is taken on any of its nights or of the buffer nights around them
+func (m *MemoryRepo) BookReservation(res models.Reservation, bufferNights int, mail []models.MailData) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.faults["BookReservation"]; err != nil {
+		return 0, err
+	}
+
+	if !m.available(res.RoomID, res.StartDate.AddDate(0, 0, -bufferNights), res.EndDate.AddDate(0, 0, bufferNights)) {
+		return 0, repository.ErrUnavailable
+	}
+
+	newID, err := m.insertReservation(res)
+	if err != nil {
+		return 0, err
+	}
+
+	m.insertRoomRestriction(models.RoomRestriction{
+		StartDate:     res.StartDate,
+		EndDate:       res.EndDate,
+		RoomID:        res.RoomID,
+		ReservationID: newID,
+		RestrictionID: 1,
+	})
+
+	for _, msg := range mail {
+		m.insertOutboxMessage(msg)
+	}
+
+	return newID, nil
+}
+
+func (m *MemoryRepo) insertReservation(res models.Reservation) (int, error) {
+	if _, ok := m.rooms[res.RoomID]; !ok {
+		return 0, errForeignKey
+	}
+
+	now := time.Now()
+
+	res.ID = m.nextID("reservations")
+	res.GuestID = m.upsertGuest(res)
+	res.Processed = 0
+	res.CancelledAt = time.Time{}
+	res.CreatedAt = now
+	res.UpdatedAt = now
+	res.Room = models.Room{}
+
+	m.reservations[res.ID] = res
+
+	return res.ID, nil
+}
+
+//upsertGuest returns the id of the guest owning the reservation's email address, creating the guest if needed
+func (m *MemoryRepo) upsertGuest(res models.Reservation) int {
+	email := models.NormalizeEmail(res.Email)
+
+	if id, ok := m.aliases[email]; ok {
+		return id
+	}
+
+	now := time.Now()
+
+	for id, g := range m.guests {
+		if g.Email == email {
+			g.FirstName = res.FirstName
+			g.LastName = res.LastName
+			if res.Phone != "" {
+				g.Phone = res.Phone
+			}
+			g.UpdatedAt = now
+			m.guests[id] = g
+			return id
+		}
+	}
+
+	g := models.Guest{
+		ID:        m.nextID("guests"),
+		Email:     email,
+		FirstName: res.FirstName,
+		LastName:  res.LastName,
+		Phone:     res.Phone,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	m.guests[g.ID] = g
+
+	return g.ID
+}
+
+//withRoom returns the reservation with its room filled in
+func (m *MemoryRepo) withRoom(res models.Reservation) models.Reservation {
+	room := m.rooms[res.RoomID]
+	res.Room = models.Room{ID: room.ID, RoomName: room.RoomName}
+	return res
+}
+
+//reservationSortKeys compares reservations by the sort keys accepted by SearchReservations
+var reservationSortKeys = map[string]func(a, b models.Reservation) int{
+	"id":         func(a, b models.Reservation) int { return a.ID - b.ID },
+	"first_name": func(a, b models.Reservation) int { return strings.Compare(a.FirstName, b.FirstName) },
+	"last_name":  func(a, b models.Reservation) int { return strings.Compare(a.LastName, b.LastName) },
+	"email":      func(a, b models.Reservation) int { return strings.Compare(a.Email, b.Email) },
+	"room":       func(a, b models.Reservation) int { return strings.Compare(a.Room.RoomName, b.Room.RoomName) },
+	"start_date": func(a, b models.Reservation) int { return compareTimes(a.StartDate, b.StartDate) },
+	"end_date":   func(a, b models.Reservation) int { return compareTimes(a.EndDate, b.EndDate) },
+	"created_at": func(a, b models.Reservation) int { return compareTimes(a.CreatedAt, b.CreatedAt) },
+}
+
+func compareTimes(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+//matchesFilter reports whether a reservation passes the filters of f
+func matchesFilter(r models.Reservation, f models.ReservationFilter) bool {
+	if f.RoomID > 0 && r.RoomID != f.RoomID {
+		return false
+	}
+
+	if !f.From.IsZero() && !r.EndDate.After(f.From) {
+		return false
+	}
+
+	if !f.To.IsZero() && r.StartDate.After(f.To) {
+		return false
+	}
+
+	switch f.Status {
+	case "new":
+		if r.Processed != 0 || r.Cancelled() {
+			return false
+		}
+	case "processed":
+		if r.Processed != 1 || r.Cancelled() {
+			return false
+		}
+	case "cancelled":
+		if !r.Cancelled() {
+			return false
+		}
+	}
+
+	if f.Query != "" {
+		q := strings.ToLower(f.Query)
+		if !strings.Contains(strings.ToLower(r.FirstName), q) && !strings.Contains(strings.ToLower(r.LastName), q) &&
+			!strings.Contains(strings.ToLower(r.Email), q) && !strings.Contains(r.Phone, f.Query) {
+			return false
+		}
+	}
+
+	return true
+}
+
+//page returns the bounds of the rows on a page of n rows
+func page(n, limit, offset int) (int, int) {
+	if offset > n {
+		offset = n
+	}
+	if offset+limit > n || limit < 0 {
+		return offset, n
+	}
+	return offset, offset + limit
+}
+
+//SearchReservations returns one page of reservations matching the filter, along with the total number of matches
+func (m *MemoryRepo) SearchReservations(f models.ReservationFilter) ([]models.Reservation, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var reservations []models.Reservation
+
+	if err := m.faults["SearchReservations"]; err != nil {
+		return reservations, 0, err
+	}
+
+	var matches []models.Reservation
+	for _, r := range m.reservations {
+		if matchesFilter(r, f) {
+			matches = append(matches, m.withRoom(r))
+		}
+	}
+
+	compare, ok := reservationSortKeys[f.Sort]
+	if !ok {
+		compare = reservationSortKeys["start_date"]
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		c := compare(matches[i], matches[j])
+		if c == 0 {
+			c = matches[i].ID - matches[j].ID
+		}
+		if f.Desc {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	lo, hi := page(len(matches), f.PageSize, f.Offset())
+	reservations = append(reservations, matches[lo:hi]...)
+
+	return reservations, len(matches), nil
+}
+
+//FullTextSearchReservations returns the reservations whose guest details or notes contain words of the search text,
+//ranked by the number of words matched, with matches on the whole name or email first
+func (m *MemoryRepo) FullTextSearchReservations(text string, limit int) ([]models.Reservation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var reservations []models.Reservation
+
+	if err := m.faults["FullTextSearchReservations"]; err != nil {
+		return reservations, err
+	}
+
+	term := strings.ToLower(strings.TrimSpace(text))
+	if term == "" {
+		return reservations, nil
+	}
+
+	words := strings.Fields(term)
+	if len(words) > maxSearchTerms {
+		words = words[:maxSearchTerms]
+	}
+
+	digits := onlyDigits(text)
+	if len(digits) < 3 {
+		digits = ""
+	}
+
+	rank := make(map[int]int)
+
+	for _, r := range m.reservations {
+		document := strings.ToLower(r.FirstName + " " + r.LastName + " " + r.Email + " " + r.Phone + " " + r.Notes)
+		name := strings.ToLower(r.FirstName + " " + r.LastName)
+
+		matched := 0
+		for _, w := range words {
+			if strings.Contains(document, w) {
+				matched++
+			}
+		}
+
+		nameMatch := strings.Contains(name, term)
+		if matched == 0 && !nameMatch && (digits == "" || !strings.Contains(onlyDigits(r.Phone), digits)) {
+			continue
+		}
+
+		if nameMatch {
+			matched++
+		}
+		if strings.Contains(strings.ToLower(r.Email), term) {
+			matched++
+		}
+
+		rank[r.ID] = matched
+		reservations = append(reservations, m.withRoom(r))
+	}
+
+	sort.Slice(reservations, func(i, j int) bool {
+		a, b := reservations[i], reservations[j]
+		if rank[a.ID] != rank[b.ID] {
+			return rank[a.ID] > rank[b.ID]
+		}
+		return a.StartDate.After(b.StartDate)
+	})
+
+	if len(reservations) > limit {
+		reservations = reservations[:limit]
+	}
+
+	return reservations, nil
+}
+
+func onlyDigits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+//GetReservationByID returns a single reservation by id
+func (m *MemoryRepo) GetReservationByID(id int) (models.Reservation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.faults["GetReservationByID"]; err != nil {
+		return models.Reservation{}, err
+	}
+
+	res, ok := m.reservations[id]
+	if !ok {
+		return models.Reservation{}, sql.ErrNoRows
+	}
+
+	return m.withRoom(res), nil
+}
+
+//UpdateReservation updates the guest details and notes of a reservation. When the email changes, the
+//reservation is moved to the guest profile of the new address, which is created if needed.
+func (m *MemoryRepo) UpdateReservation(r models.Reservation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.faults["UpdateReservation"]; err != nil {
+		return err
+	}
+
+	res, ok := m.reservations[r.ID]
+	if !ok {
+		return nil
+	}
+
+	relink := models.NormalizeEmail(res.Email) != models.NormalizeEmail(r.Email)
+
+	res.FirstName = r.FirstName
+	res.LastName = r.LastName
+	res.Email = r.Email
+	res.Phone = r.Phone
+	res.Notes = r.Notes
+	res.UpdatedAt = time.Now()
+	if relink {
+		res.GuestID = m.upsertGuest(res)
+	}
+	m.reservations[r.ID] = res
+
+	return nil
+}
+
+//DeleteReservation deletes a reservation along with its room restrictions and sent email records
+func (m *MemoryRepo) DeleteReservation(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.faults["DeleteReservation"]; err != nil {
+		return err
+	}
+
+	delete(m.reservations, id)
+	m.deleteRestrictionsFor(id)
+
+	for key := range m.sentEmails {
+		if key[0] == id {
+			delete(m.sentEmails, key)
+		}
+	}
+
+	return nil
+}
+
+func (m *MemoryRepo) deleteRestrictionsFor(reservationID int) {
+	for rid, r := range m.restrictions {
+		if r.ReservationID == reservationID {
+			delete(m.restrictions, rid)
+		}
+	}
+}
+
+//CancelReservation marks a reservation as cancelled and frees its room for the booked dates
+func (m *MemoryRepo) CancelReservation(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.faults["CancelReservation"]; err != nil {
+		return err
+	}
+
+	if res, ok := m.reservations[id]; ok && !res.Cancelled() {
+		res.CancelledAt = time.Now()
+		res.UpdatedAt = res.CancelledAt
+		m.reservations[id] = res
+	}
+
+	m.deleteRestrictionsFor(id)
+
+	return nil
+}
+
+func (m *MemoryRepo) UpdateProcessedForReservation(id, processed int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.faults["UpdateProcessedForReservation"]; err != nil {
+		return err
+	}
+
+	if res, ok := m.reservations[id]; ok {
+		res.Processed = processed
+		m.reservations[id] = res
+	}
+
+	return nil
+}
+
+//sortedGuests returns the guests matching keep, ordered by last name, first name and id
+func (m *MemoryRepo) sortedGuests(keep func(g models.Guest) bool) []models.Guest {
+	var guests []models.Guest
+	for _, g := range m.guests {
+		if keep(g) {
+			guests = append(guests, g)
+		}
+	}
+
+	sort.Slice(guests, func(i, j int) bool {
+		a, b := guests[i], guests[j]
+		if a.LastName != b.LastName {
+			return a.LastName < b.LastName
+		}
+		if a.FirstName != b.FirstName {
+			return a.FirstName < b.FirstName
+		}
+		return a.ID < b.ID
+	})
+
+	return guests
+}
+
+//SearchGuests returns one page of guests whose name, email or phone contains the search text,
+//along with the total number of matches. Cancelled stays are left out of the stay count and last arrival.
+func (m *MemoryRepo) SearchGuests(text string, limit, offset int) ([]models.Guest, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var guests []models.Guest
+
+	if err := m.faults["SearchGuests"]; err != nil {
+		return guests, 0, err
+	}
+
+	pattern := strings.ToLower(strings.TrimSpace(text))
+
+	matches := m.sortedGuests(func(g models.Guest) bool {
+		return strings.Contains(g.Email, pattern) || strings.Contains(strings.ToLower(g.FirstName+" "+g.LastName), pattern) ||
+			strings.Contains(g.Phone, pattern)
+	})
+
+	lo, hi := page(len(matches), limit, offset)
+	for _, g := range matches[lo:hi] {
+		for _, r := range m.reservations {
+			if r.GuestID == g.ID && !r.Cancelled() {
+				g.StayCount++
+				if r.StartDate.After(g.LastArrival) {
+					g.LastArrival = r.StartDate
+				}
+			}
+		}
+		guests = append(guests, g)
+	}
+
+	return guests, len(matches), nil
+}
+
+//GetGuestByID returns a guest by id
+func (m *MemoryRepo) GetGuestByID(id int) (models.Guest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.faults["GetGuestByID"]; err != nil {
+		return models.Guest{}, err
+	}
+
+	g, ok := m.guests[id]
+	if !ok {
+		return models.Guest{}, sql.ErrNoRows
+	}
+
+	return g, nil
+}
+
+//UpdateGuest updates a guest's contact details and notes
+func (m *MemoryRepo) UpdateGuest(g models.Guest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.faults["UpdateGuest"]; err != nil {
+		return err
+	}
+
+	old, ok := m.guests[g.ID]
+	if !ok {
+		return nil
+	}
+
+	old.FirstName = g.FirstName
+	old.LastName = g.LastName
+	old.Phone = g.Phone
+	old.Notes = g.Notes
+	old.UpdatedAt = time.Now()
+	m.guests[g.ID] = old
+
+	return nil
+}
+
+//GetReservationsForGuest returns every reservation linked to a guest, cancelled ones included, latest arrival first
+func (m *MemoryRepo) GetReservationsForGuest(guestID int) ([]models.Reservation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var reservations []models.Reservation
+
+	if err := m.faults["GetReservationsForGuest"]; err != nil {
+		return reservations, err
+	}
+
+	for _, r := range m.reservations {
+		if r.GuestID == guestID {
+			reservations = append(reservations, m.withRoom(r))
+		}
+	}
+
+	sort.Slice(reservations, func(i, j int) bool {
+		return reservations[i].StartDate.After(reservations[j].StartDate)
+	})
+
+	return reservations, nil
+}
+
+//FindDuplicateGuests returns other guests that share a name or phone number with the given guest
+func (m *MemoryRepo) FindDuplicateGuests(g models.Guest) ([]models.Guest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var guests []models.Guest
+
+	if err := m.faults["FindDuplicateGuests"]; err != nil {
+		return guests, err
+	}
+
+	for _, d := range m.guests {
+		if d.ID == g.ID {
+			continue
+		}
+		sameName := strings.EqualFold(d.FirstName, g.FirstName) && strings.EqualFold(d.LastName, g.LastName)
+		if sameName || (g.Phone != "" && d.Phone == g.Phone) {
+			guests = append(guests, d)
+		}
+	}
+
+	sort.Slice(guests, func(i, j int) bool { return guests[i].ID < guests[j].ID })
+
+	return guests, nil
+}
+
+//MergeGuests moves every reservation of the source guest to the target guest, keeps the source's email
+//as an alias of the target and deletes the source guest
+func (m *MemoryRepo) MergeGuests(targetID, sourceID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.faults["MergeGuests"]; err != nil {
+		return err
+	}
+
+	if targetID == sourceID {
+		return errors.New("cannot merge a guest into itself")
+	}
+
+	source, ok := m.guests[sourceID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	target, ok := m.guests[targetID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	if _, ok := m.aliases[source.Email]; ok {
+		return fmt.Errorf("guest alias %s already exists", source.Email)
+	}
+
+	for id, r := range m.reservations {
+		if r.GuestID == sourceID {
+			r.GuestID = targetID
+			m.reservations[id] = r
+		}
+	}
+
+	for email, id := range m.aliases {
+		if id == sourceID {
+			m.aliases[email] = targetID
+		}
+	}
+	m.aliases[source.Email] = targetID
+
+	if target.Phone == "" {
+		target.Phone = source.Phone
+	}
+	if source.Notes != "" {
+		target.Notes = strings.TrimSpace(target.Notes + "\n" + source.Notes)
+	}
+	target.UpdatedAt = time.Now()
+	m.guests[targetID] = target
+
+	delete(m.guests, sourceID)
+
+	return nil
+}
+
+//AllRooms returns every room, ordered by name
+func (m *MemoryRepo) AllRooms() ([]models.Room, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var rooms []models.Room
+
+	if err := m.faults["AllRooms"]; err != nil {
+		return rooms, err
+	}
+
+	for _, r := range m.rooms {
+		rooms = append(rooms, r)
+	}
+
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].RoomName < rooms[j].RoomName })
+
+	return rooms, nil
+}
+
+//InsertRoom inserts a room and returns its id
+func (m *MemoryRepo) InsertRoom(r models.Room) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.faults["InsertRoom"]; err != nil {
+		return 0, err
+	}
+
+	r.ID = m.nextID("rooms")
+	r.CreatedAt = time.Now()
+	r.UpdatedAt = r.CreatedAt
+	m.rooms[r.ID] = r
+
+	return r.ID, nil
+}
+
+//sortedRestrictions returns the room restrictions matching keep, ordered by id
+func (m *MemoryRepo) sortedRestrictions(keep func(r models.RoomRestriction) bool) []models.RoomRestriction {
+	var restrictions []models.RoomRestriction
+	for _, r := range m.restrictions {
+		if keep(r) {
+			restrictions = append(restrictions, r)
+		}
+	}
+
+	sort.Slice(restrictions, func(i, j int) bool { return restrictions[i].ID < restrictions[j].ID })
+
+	return restrictions
+}
+
+//GetRestrictionsForRoomByDate returns the restrictions of a room that end after start and begin on or before end
+func (m *MemoryRepo) GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.faults["GetRestrictionsForRoomByDate"]; err != nil {
+		return nil, err
+	}
+
+	restrictions := m.sortedRestrictions(func(r models.RoomRestriction) bool {
+		return r.RoomID == roomID && start.Before(r.EndDate) && !end.Before(r.StartDate)
+	})
+
+	return restrictions, nil
+}
+
+//InsertBlockForRoom blocks a room for the night starting on startDate
+func (m *MemoryRepo) InsertBlockForRoom(id int, startDate time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.faults["InsertBlockForRoom"]; err != nil {
+		return err
+	}
+
+	if _, ok := m.rooms[id]; !ok {
+		return errForeignKey
+	}
+
+	m.insertRoomRestriction(models.RoomRestriction{
+		StartDate:     startDate,
+		EndDate:       startDate.AddDate(0, 0, 1),
+		RoomID:        id,
+		RestrictionID: 2,
+	})
+
+	return nil
+}
+
+func (m *MemoryRepo) DeleteBlockByID(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.faults["DeleteBlockByID"]; err != nil {
+		return err
+	}
+
+	delete(m.restrictions, id)
+
+	return nil
+}
+
+func (m *MemoryRepo) InsertRoomRestriction(r models.RoomRestriction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.faults["InsertRoomRestriction"]; err != nil {
+		return err
+	}
+
+	if _, ok := m.rooms[r.RoomID]; !ok {
+		return errForeignKey
+	}
+
+	if _, ok := m.reservations[r.ReservationID]; r.ReservationID != 0 && !ok {
+		return errForeignKey
+	}
+
+	if r.RestrictionID != 1 && r.RestrictionID != 2 {
+		return errForeignKey
+	}
+
+	m.insertRoomRestriction(r)
+
+	return nil
+}
+
+func (m *MemoryRepo) insertRoomRestriction(r models.RoomRestriction) {
+	r.ID = m.nextID("room_restrictions")
+	r.CreatedAt = time.Now()
+	r.UpdatedAt = r.CreatedAt
+	r.Room = models.Room{}
+	r.Reservation = models.Reservation{}
+	m.restrictions[r.ID] = r
+}
+
+//overlaps reports whether a restriction covers any night from start to end
+func overlaps(r models.RoomRestriction, start, end time.Time) bool {
+	return start.Before(r.EndDate) && end.After(r.StartDate)
+}
+
+//CheckAvailabilityByDatesByRoomID returns true if no restriction of the room covers a night from start to end
+func (m *MemoryRepo) CheckAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.faults["CheckAvailabilityByDatesByRoomID"]; err != nil {
+		return false, err
+	}
+
+	return m.available(roomID, start, end), nil
+}
+
+func (m *MemoryRepo) available(roomID int, start, end time.Time) bool {
+	for _, r := range m.restrictions {
+		if r.RoomID == roomID && overlaps(r, start, end) {
+			return false
+		}
+	}
+	return true
+}
+
+//SearchAvailabilityForAllRooms returns the rooms that are free from start to end
+func (m *MemoryRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var rooms []models.Room
+
+	if err := m.faults["SearchAvailabilityForAllRooms"]; err != nil {
+		return rooms, err
+	}
+
+	taken := make(map[int]bool)
+	for _, r := range m.restrictions {
+		if overlaps(r, start, end) {
+			taken[r.RoomID] = true
+		}
+	}
+
+	for id, r := range m.rooms {
+		if !taken[id] {
+			rooms = append(rooms, models.Room{ID: r.ID, RoomName: r.RoomName})
+		}
+	}
+
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].ID < rooms[j].ID })
+
+	return rooms, nil
+}
+
+func (m *MemoryRepo) GetRoomByID(id int) (models.Room, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.faults["GetRoomByID"]; err != nil {
+		return models.Room{}, err
+	}
+
+	room, ok := m.rooms[id]
+	if !ok {
+		return models.Room{}, sql.ErrNoRows
+	}
+
+	return room, nil
+}
+
+func (m *MemoryRepo) insertOutboxMessage(msg models.MailData) {
+	now := time.Now()
+
+	id := m.nextID("outbox")
+	m.outbox[id] = models.OutboxMessage{
+		ID:            id,
+		Mail:          models.MailData{To: msg.To, From: msg.From, Subject: msg.Subject, Content: msg.Content, TextContent: msg.TextContent, Template: msg.Template},
+		Status:        models.OutboxPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+}
+
+//sortedOutbox returns the outbox messages matching keep, ordered by less
+func (m *MemoryRepo) sortedOutbox(keep func(msg models.OutboxMessage) bool, less func(a, b models.OutboxMessage) bool) []models.OutboxMessage {
+	var messages []models.OutboxMessage
+	for _, msg := range m.outbox {
+		if keep(msg) {
+			messages = append(messages, msg)
+		}
+	}
+
+	sort.Slice(messages, func(i, j int) bool { return less(messages[i], messages[j]) })
+
+	return messages
+}
+
+//ClaimOutboxMessages returns up to limit pending messages whose next attempt is at or before now, in the
+//order they were queued, and moves their next attempt to now plus lease so they are not claimed again meanwhile
+func (m *MemoryRepo) ClaimOutboxMessages(now time.Time, lease time.Duration, limit int) ([]models.OutboxMessage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var messages []models.OutboxMessage
+
+	if err := m.faults["ClaimOutboxMessages"]; err != nil {
+		return messages, err
+	}
+
+	due := m.sortedOutbox(func(msg models.OutboxMessage) bool {
+		return msg.Status == models.OutboxPending && !msg.NextAttemptAt.After(now)
+	}, func(a, b models.OutboxMessage) bool {
+		if !a.NextAttemptAt.Equal(b.NextAttemptAt) {
+			return a.NextAttemptAt.Before(b.NextAttemptAt)
+		}
+		return a.ID < b.ID
+	})
+
+	lo, hi := page(len(due), limit, 0)
+	for _, msg := range due[lo:hi] {
+		msg.NextAttemptAt = now.Add(lease)
+		msg.UpdatedAt = now
+		m.outbox[msg.ID] = msg
+		messages = append(messages, msg)
+	}
+
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID < messages[j].ID })
+
+	return messages, nil
+}
+
+//SearchOutboxMessages returns a page of outbox messages, newest first, optionally limited to one status,
+//along with the total number of matching messages
+func (m *MemoryRepo) SearchOutboxMessages(status string, limit, offset int) ([]models.OutboxMessage, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var messages []models.OutboxMessage
+
+	if err := m.faults["SearchOutboxMessages"]; err != nil {
+		return messages, 0, err
+	}
+
+	matches := m.sortedOutbox(func(msg models.OutboxMessage) bool {
+		return status == "" || msg.Status == status
+	}, func(a, b models.OutboxMessage) bool {
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID > b.ID
+	})
+
+	lo, hi := page(len(matches), limit, offset)
+	messages = append(messages, matches[lo:hi]...)
+
+	return messages, len(matches), nil
+}
+
+//GetOutboxMessageByID returns an outbox message by id
+func (m *MemoryRepo) GetOutboxMessageByID(id int) (models.OutboxMessage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.faults["GetOutboxMessageByID"]; err != nil {
+		return models.OutboxMessage{}, err
+	}
+
+	msg, ok := m.outbox[id]
+	if !ok {
+		return models.OutboxMessage{}, sql.ErrNoRows
+	}
+
+	return msg, nil
+}
+
+//UpdateOutboxMessage saves the delivery state of an outbox message
+func (m *MemoryRepo) UpdateOutboxMessage(msg models.OutboxMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.faults["UpdateOutboxMessage"]; err != nil {
+		return err
+	}
+
+	old, ok := m.outbox[msg.ID]
+	if !ok {
+		return nil
+	}
+
+	old.Status = msg.Status
+	old.Attempts = msg.Attempts
+	old.NextAttemptAt = msg.NextAttemptAt
+	old.LastError = msg.LastError
+	old.SentAt = msg.SentAt
+	old.UpdatedAt = time.Now()
+	m.outbox[msg.ID] = old
+
+	return nil
+}
+
+//AllEmailSchedules returns every scheduled email, arrival reminders first
+func (m *MemoryRepo) AllEmailSchedules() ([]models.EmailSchedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var schedules []models.EmailSchedule
+
+	if err := m.faults["AllEmailSchedules"]; err != nil {
+		return schedules, err
+	}
+
+	for _, s := range m.schedules {
+		schedules = append(schedules, s)
+	}
+
+	sort.Slice(schedules, func(i, j int) bool {
+		a, b := schedules[i], schedules[j]
+		if a.Anchor != b.Anchor {
+			return a.Anchor < b.Anchor
+		}
+		if a.OffsetDays != b.OffsetDays {
+			return a.OffsetDays < b.OffsetDays
+		}
+		return a.ID < b.ID
+	})
+
+	return schedules, nil
+}
+
+//GetEmailScheduleByID returns a scheduled email by id
+func (m *MemoryRepo) GetEmailScheduleByID(id int) (models.EmailSchedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.faults["GetEmailScheduleByID"]; err != nil {
+		return models.EmailSchedule{}, err
+	}
+
+	s, ok := m.schedules[id]
+	if !ok {
+		return models.EmailSchedule{}, sql.ErrNoRows
+	}
+
+	return s, nil
+}
+
+//UpdateEmailSchedule saves the template, timing and state of a scheduled email
+func (m *MemoryRepo) UpdateEmailSchedule(s models.EmailSchedule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.faults["UpdateEmailSchedule"]; err != nil {
+		return err
+	}
+
+	old, ok := m.schedules[s.ID]
+	if !ok {
+		return nil
+	}
+
+	s.CreatedAt = old.CreatedAt
+	s.UpdatedAt = time.Now()
+	m.schedules[s.ID] = s
+
+	return nil
+}
+
+//ReservationsDueForEmail returns the reservations that are not cancelled, whose email from schedule s
+//is due on or before today and was due at most graceDays ago, and that have not been sent it yet.
+//Reminders counted from arrival are never sent once the guest has arrived.
+func (m *MemoryRepo) ReservationsDueForEmail(s models.EmailSchedule, today time.Time, graceDays int) ([]models.Reservation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var reservations []models.Reservation
+
+	if err := m.faults["ReservationsDueForEmail"]; err != nil {
+		return reservations, err
+	}
+
+	latest := today.AddDate(0, 0, -s.OffsetDays)
+	earliest := latest.AddDate(0, 0, -graceDays)
+	//emails before arrival are not sent once the guest has arrived, while emails after it are sent as usual
+	if s.Anchor == models.AnchorArrival && s.OffsetDays <= 0 && earliest.Before(today) {
+		earliest = today
+	}
+
+	for _, r := range m.reservations {
+		anchor := r.StartDate
+		if s.Anchor == models.AnchorDeparture {
+			anchor = r.EndDate
+		}
+
+		if anchor.After(latest) || anchor.Before(earliest) || r.Cancelled() || m.sentEmails[[2]int{r.ID, s.ID}] {
+			continue
+		}
+
+		reservations = append(reservations, m.withRoom(r))
+	}
+
+	sort.Slice(reservations, func(i, j int) bool { return reservations[i].ID < reservations[j].ID })
+
+	return reservations, nil
+}
+
+//QueueScheduledEmail records that the email from a schedule was sent for a reservation and queues it in the outbox.
+//It returns false without queueing anything if the email was already recorded.
+func (m *MemoryRepo) QueueScheduledEmail(reservationID, scheduleID int, msg models.MailData) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.faults["QueueScheduledEmail"]; err != nil {
+		return false, err
+	}
+
+	_, okReservation := m.reservations[reservationID]
+	_, okSchedule := m.schedules[scheduleID]
+	if !okReservation || !okSchedule {
+		return false, errForeignKey
+	}
+
+	key := [2]int{reservationID, scheduleID}
+	if m.sentEmails[key] {
+		return false, nil
+	}
+
+	m.sentEmails[key] = true
+	m.insertOutboxMessage(msg)
+
+	return true, nil
+}
+
+//SaveImportUpload stores an uploaded import file under token until it is taken
+func (m *MemoryRepo) SaveImportUpload(token, content string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.faults["SaveImportUpload"]; err != nil {
+		return err
+	}
+
+	if _, ok := m.uploads[token]; ok {
+		return errors.New("duplicate key value violates unique constraint")
+	}
+
+	m.uploads[token] = content
+
+	return nil
+}
+
+//TakeImportUpload removes and returns the import file stored under token, or sql.ErrNoRows if there is none
+func (m *MemoryRepo) TakeImportUpload(token string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.faults["TakeImportUpload"]; err != nil {
+		return "", err
+	}
+
+	content, ok := m.uploads[token]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	delete(m.uploads, token)
+
+	return content, nil
+}
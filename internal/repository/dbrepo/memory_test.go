@@ -0,0 +1,45 @@
+package dbrepo
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Rha02/bookings/internal/config"
+	"github.com/Rha02/bookings/internal/models"
+	"github.com/Rha02/bookings/internal/repository"
+	"github.com/Rha02/bookings/internal/repository/repotest"
+)
+
+func TestMemory_Conformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repository.DatabaseRepo {
+		return NewMemoryRepo(&config.AppConfig{})
+	})
+}
+
+func TestMemory_Fail(t *testing.T) {
+	repo := NewMemoryRepo(&config.AppConfig{})
+	fault := errors.New("connection refused")
+
+	repo.Fail("GetRoomByID", fault)
+	if _, err := repo.GetRoomByID(1); err != fault {
+		t.Errorf("expected the injected error, got %v", err)
+	}
+
+	repo.Fail("GetRoomByID", nil)
+	if _, err := repo.GetRoomByID(1); err != nil {
+		t.Errorf("expected the fault to be removed, got %v", err)
+	}
+
+	repo.Fail("BookReservation", fault)
+	repo.Reset()
+	if _, err := repo.BookReservation(models.Reservation{RoomID: 1, StartDate: repotest.Date(1), EndDate: repotest.Date(2)}, 0, nil); err != nil {
+		t.Errorf("expected Reset to remove faults, got %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("a fault on an unknown method did not panic")
+		}
+	}()
+	repo.Fail("GetRoom", fault)
+}
@@ -2,10 +2,15 @@ package dbrepo
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/Rha02/bookings/internal/models"
+	"github.com/Rha02/bookings/internal/repository"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -13,17 +18,104 @@ func (m *postgresDBRepo) AllUsers() bool {
 	return true
 }
 
+//InsertReservation inserts a reservation and links it to the guest profile for its email address
 func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	newID, err := insertReservation(ctx, tx, res)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+//BookReservation inserts a reservation, the room restriction blocking its dates and the emails about it
+//in one transaction, so the emails are queued if and only if the booking is stored. The room's row is
+//locked while its availability is checked again, widened by the buffer nights the stay needs free on either
+//side, so concurrent bookings of the same or neighbouring nights cannot both succeed, and
+//repository.ErrUnavailable is returned for the one that finds the room taken.
+func (m *postgresDBRepo) BookReservation(res models.Reservation, bufferNights int, mail []models.MailData) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	//a no-op update takes the row lock in Postgres and the write lock in SQLite
+	_, err = tx.ExecContext(ctx, `update rooms set updated_at = updated_at where id = $1`, res.RoomID)
+	if err != nil {
+		return 0, err
+	}
+
+	var taken int
+	err = tx.QueryRowContext(ctx, `select count(id) from room_restrictions
+		where room_id = $1 and $2 < end_date and $3 > start_date`,
+		res.RoomID, res.StartDate.AddDate(0, 0, -bufferNights), res.EndDate.AddDate(0, 0, bufferNights)).Scan(&taken)
+	if err != nil {
+		return 0, err
+	}
+	if taken > 0 {
+		return 0, repository.ErrUnavailable
+	}
+
+	newID, err := insertReservation(ctx, tx, res)
+	if err != nil {
+		return 0, err
+	}
+
+	err = insertRoomRestriction(ctx, tx, models.RoomRestriction{
+		StartDate:     res.StartDate,
+		EndDate:       res.EndDate,
+		RoomID:        res.RoomID,
+		ReservationID: newID,
+		RestrictionID: 1,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, msg := range mail {
+		err = insertOutboxMessage(ctx, tx, msg)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+func insertReservation(ctx context.Context, tx conn, res models.Reservation) (int, error) {
+	guestID, err := upsertGuest(ctx, tx, res)
+	if err != nil {
+		return 0, err
+	}
+
 	var newID int
 
 	stmt := `insert into reservations 
-		(first_name, last_name, email, phone, start_date, end_date, room_id, created_at, updated_at)
-		values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
+		(first_name, last_name, email, phone, start_date, end_date, room_id, guest_id, notes, locale, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) returning id`
 
-	err := m.DB.QueryRowContext(ctx, stmt,
+	err = tx.QueryRowContext(ctx, stmt,
 		res.FirstName,
 		res.LastName,
 		res.Email,
@@ -31,6 +123,9 @@ func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error)
 		res.StartDate,
 		res.EndDate,
 		res.RoomID,
+		guestID,
+		res.Notes,
+		res.Locale,
 		time.Now(),
 		time.Now(),
 	).Scan(&newID)
@@ -42,15 +137,57 @@ func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error)
 	return newID, nil
 }
 
+//upsertGuest returns the id of the guest owning the reservation's email address, creating the guest if needed.
+//The guest's contact details are refreshed from the reservation.
+func upsertGuest(ctx context.Context, tx conn, res models.Reservation) (int, error) {
+	var guestID int
+
+	email := models.NormalizeEmail(res.Email)
+
+	err := tx.QueryRowContext(ctx, `select guest_id from guest_aliases where email = $1`, email).Scan(&guestID)
+	if err == nil {
+		return guestID, nil
+	} else if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	stmt := `insert into guests (email, first_name, last_name, phone, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6)
+		on conflict (email) do update set
+			first_name = excluded.first_name,
+			last_name = excluded.last_name,
+			phone = case when excluded.phone <> '' then excluded.phone else guests.phone end,
+			updated_at = excluded.updated_at
+		returning id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		email,
+		res.FirstName,
+		res.LastName,
+		res.Phone,
+		time.Now(),
+		time.Now(),
+	).Scan(&guestID)
+	if err != nil {
+		return 0, err
+	}
+
+	return guestID, nil
+}
+
 func (m *postgresDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	return insertRoomRestriction(ctx, m.conn(), r)
+}
+
+func insertRoomRestriction(ctx context.Context, db conn, r models.RoomRestriction) error {
 	stmt := `insert into room_restrictions
 		(start_date, end_date, room_id, reservation_id, restriction_id, created_at, updated_at)
 		values($1, $2, $3, $4, $5, $6, $7)`
 
-	_, err := m.DB.ExecContext(ctx, stmt,
+	_, err := db.ExecContext(ctx, stmt,
 		r.StartDate,
 		r.EndDate,
 		r.RoomID,
@@ -76,7 +213,7 @@ func (m *postgresDBRepo) CheckAvailabilityByDatesByRoomID(start, end time.Time,
 	query := `select count(id) from room_restrictions
 		where room_id = $1 and $2 < end_date and $3 > start_date`
 
-	row := m.DB.QueryRowContext(ctx, query, roomID, start, end)
+	row := m.conn().QueryRowContext(ctx, query, roomID, start, end)
 	err := row.Scan(&numRows)
 	if err != nil {
 		return false, err
@@ -96,7 +233,7 @@ func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]
 		where r.id not in
 		(select room_id from room_restrictions rr where $1 < rr.end_date and $2 > rr.start_date)`
 
-	rows, err := m.DB.QueryContext(ctx, query, start, end)
+	rows, err := m.conn().QueryContext(ctx, query, start, end)
 	if err != nil {
 		return rooms, err
 	}
@@ -127,7 +264,7 @@ func (m *postgresDBRepo) GetRoomByID(id int) (models.Room, error) {
 
 	query := `select id, room_name, created_at, updated_at from rooms where id = $1`
 
-	row := m.DB.QueryRowContext(ctx, query, id)
+	row := m.conn().QueryRowContext(ctx, query, id)
 	err := row.Scan(
 		&room.ID,
 		&room.RoomName,
@@ -150,7 +287,7 @@ func (m *postgresDBRepo) GetUserByID(id int) (models.User, error) {
 	query := `select id, first_name, last_name, email, access_level, created_at, updated_at
 		from users where id = $1`
 
-	row := m.DB.QueryRowContext(ctx, query, id)
+	row := m.conn().QueryRowContext(ctx, query, id)
 
 	var u models.User
 
@@ -178,7 +315,7 @@ func (m *postgresDBRepo) UpdateUser(u models.User) error {
 
 	query := `update users set first_name = $1, last_name = $2, email = $3, access_level = $4, updated_at = $5 where id = $6`
 
-	_, err := m.DB.ExecContext(ctx, query,
+	_, err := m.conn().ExecContext(ctx, query,
 		u.FirstName,
 		u.LastName,
 		u.Email,
@@ -194,6 +331,40 @@ func (m *postgresDBRepo) UpdateUser(u models.User) error {
 	return nil
 }
 
+//UpsertUser inserts a user with the given password, or updates the user and password if the email is taken
+func (m *postgresDBRepo) UpsertUser(u models.User, password string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int
+
+	stmt := `insert into users (first_name, last_name, email, password, access_level, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7)
+		on conflict (email) do update set first_name = excluded.first_name, last_name = excluded.last_name,
+			password = excluded.password, access_level = excluded.access_level, updated_at = excluded.updated_at
+		returning id`
+
+	err = m.conn().QueryRowContext(ctx, stmt,
+		u.FirstName,
+		u.LastName,
+		u.Email,
+		string(hashedPassword),
+		u.AccessLevel,
+		time.Now(),
+		time.Now(),
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
 //Authenticate authenticates a user
 func (m *postgresDBRepo) Authenticate(email, testPassword string) (int, string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -202,7 +373,7 @@ func (m *postgresDBRepo) Authenticate(email, testPassword string) (int, string,
 	var id int
 	var hashedPassword string
 
-	row := m.DB.QueryRowContext(ctx, "select id, password from users where email = $1", email)
+	row := m.conn().QueryRowContext(ctx, "select id, password from users where email = $1", email)
 
 	err := row.Scan(&id, &hashedPassword)
 	if err != nil {
@@ -219,22 +390,100 @@ func (m *postgresDBRepo) Authenticate(email, testPassword string) (int, string,
 	return id, hashedPassword, nil
 }
 
-//AllReservations returns a slice of all reservations
-func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
+//reservationSortColumns maps the sort keys accepted by SearchReservations to their columns
+var reservationSortColumns = map[string]string{
+	"id":         "r.id",
+	"first_name": "r.first_name",
+	"last_name":  "r.last_name",
+	"email":      "r.email",
+	"room":       "rm.room_name",
+	"start_date": "r.start_date",
+	"end_date":   "r.end_date",
+	"created_at": "r.created_at",
+}
+
+//reservationFilterWhere builds the where clause and arguments for a reservation filter
+func reservationFilterWhere(f models.ReservationFilter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if f.RoomID > 0 {
+		conditions = append(conditions, "r.room_id = "+arg(f.RoomID))
+	}
+
+	if !f.From.IsZero() {
+		conditions = append(conditions, "r.end_date > "+arg(f.From))
+	}
+
+	if !f.To.IsZero() {
+		conditions = append(conditions, "r.start_date <= "+arg(f.To))
+	}
+
+	switch f.Status {
+	case "new":
+		conditions = append(conditions, "r.processed = 0 and r.cancelled_at is null")
+	case "processed":
+		conditions = append(conditions, "r.processed = 1 and r.cancelled_at is null")
+	case "cancelled":
+		conditions = append(conditions, "r.cancelled_at is not null")
+	}
+
+	if f.Query != "" {
+		q := arg("%" + strings.ToLower(f.Query) + "%")
+		conditions = append(conditions, fmt.Sprintf(
+			"(lower(r.first_name) like %[1]s or lower(r.last_name) like %[1]s or lower(r.email) like %[1]s or r.phone like %[1]s)", q))
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+
+	return "where " + strings.Join(conditions, " and "), args
+}
+
+//SearchReservations returns one page of reservations matching the filter, along with the total number of matches
+func (m *postgresDBRepo) SearchReservations(f models.ReservationFilter) ([]models.Reservation, int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	var reservations []models.Reservation
+	var total int
+
+	where, args := reservationFilterWhere(f)
 
-	query := `select r.id, r.first_name, r.last_name, r.email, r.start_date, r.end_date, r.room_id, r.created_at, r.updated_at, r.processed,
-		rm.id, rm.room_name
+	query := `select count(r.id) from reservations r ` + where
+
+	err := m.conn().QueryRowContext(ctx, query, args...).Scan(&total)
+	if err != nil {
+		return reservations, 0, err
+	}
+
+	column, ok := reservationSortColumns[f.Sort]
+	if !ok {
+		column = "r.start_date"
+	}
+
+	direction := "asc"
+	if f.Desc {
+		direction = "desc"
+	}
+
+	query = fmt.Sprintf(`select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.created_at, r.updated_at, r.processed,
+		r.cancelled_at, rm.id, rm.room_name
 		from reservations r
 		left join rooms rm on (r.room_id = rm.id)
-		order by r.start_date asc`
+		%s
+		order by %s %s, r.id %s
+		limit %d offset %d`, where, column, direction, direction, f.PageSize, f.Offset())
 
-	rows, err := m.DB.QueryContext(ctx, query)
+	rows, err := m.conn().QueryContext(ctx, query, args...)
 	if err != nil {
-		return reservations, err
+		return reservations, 0, err
 	}
 	defer rows.Close()
 
@@ -245,45 +494,70 @@ func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
 			&i.FirstName,
 			&i.LastName,
 			&i.Email,
+			&i.Phone,
 			&i.StartDate,
 			&i.EndDate,
 			&i.RoomID,
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.Processed,
+			nullTime{&i.CancelledAt},
 			&i.Room.ID,
 			&i.Room.RoomName,
 		)
 
 		if err != nil {
-			return reservations, err
+			return reservations, 0, err
 		}
 
 		reservations = append(reservations, i)
 	}
 
 	if err = rows.Err(); err != nil {
-		return reservations, err
+		return reservations, 0, err
 	}
 
-	return reservations, nil
+	return reservations, total, nil
 }
 
-//AllNewReservations returns a slice of all reservations
-func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
+//FullTextSearchReservations returns the reservations whose guest details or notes best match the search text,
+//ranked by full-text relevance and name/email similarity
+func (m *postgresDBRepo) FullTextSearchReservations(text string, limit int) ([]models.Reservation, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	var reservations []models.Reservation
 
-	query := `select r.id, r.first_name, r.last_name, r.email, r.start_date, r.end_date, r.room_id, r.created_at, r.updated_at,
-		rm.id, rm.room_name
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, text)
+
+	if len(digits) < 3 {
+		digits = ""
+	}
+
+	query := `with q as (
+			select websearch_to_tsquery('simple', $1) as tsq, lower($1) as term
+		)
+		select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.notes, r.created_at, r.updated_at, r.processed,
+			rm.id, rm.room_name
 		from reservations r
 		left join rooms rm on (r.room_id = rm.id)
-		where processed = 0
-		order by r.start_date asc`
-
-	rows, err := m.DB.QueryContext(ctx, query)
+		cross join q
+		where to_tsvector('simple', r.first_name || ' ' || r.last_name || ' ' || r.email || ' ' || r.phone || ' ' || r.notes) @@ q.tsq
+			or lower(r.first_name || ' ' || r.last_name) % q.term
+			or lower(r.email) % q.term
+			or ($2 <> '' and regexp_replace(r.phone, '[^0-9]', '', 'g') like '%' || $2 || '%')
+		order by ts_rank(to_tsvector('simple', r.first_name || ' ' || r.last_name || ' ' || r.email || ' ' || r.phone || ' ' || r.notes), q.tsq)
+			+ similarity(lower(r.first_name || ' ' || r.last_name), q.term)
+			+ similarity(lower(r.email), q.term) desc,
+			r.start_date desc
+		limit $3`
+
+	rows, err := m.conn().QueryContext(ctx, query, text, digits, limit)
 	if err != nil {
 		return reservations, err
 	}
@@ -296,11 +570,14 @@ func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
 			&i.FirstName,
 			&i.LastName,
 			&i.Email,
+			&i.Phone,
 			&i.StartDate,
 			&i.EndDate,
 			&i.RoomID,
+			&i.Notes,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Processed,
 			&i.Room.ID,
 			&i.Room.RoomName,
 		)
@@ -326,13 +603,13 @@ func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error)
 
 	var res models.Reservation
 
-	query := `select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.created_at, r.updated_at, r.processed,
-		rm.id, rm.room_name
+	query := `select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, coalesce(r.guest_id, 0), r.notes, r.created_at, r.updated_at, r.processed,
+		r.cancelled_at, rm.id, rm.room_name
 		from reservations r
 		left join rooms rm on (r.room_id = rm.id)
 		where r.id = $1`
 
-	row := m.DB.QueryRowContext(ctx, query, id)
+	row := m.conn().QueryRowContext(ctx, query, id)
 
 	err := row.Scan(
 		&res.ID,
@@ -343,9 +620,12 @@ func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error)
 		&res.StartDate,
 		&res.EndDate,
 		&res.RoomID,
+		&res.GuestID,
+		&res.Notes,
 		&res.CreatedAt,
 		&res.UpdatedAt,
 		&res.Processed,
+		nullTime{&res.CancelledAt},
 		&res.Room.ID,
 		&res.Room.RoomName,
 	)
@@ -356,27 +636,55 @@ func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error)
 	return res, nil
 }
 
-//UpdateUser updates a user in the database
+//UpdateReservation updates the guest details and notes of a reservation. When the email changes, the
+//reservation is moved to the guest profile of the new address, which is created if needed.
 func (m *postgresDBRepo) UpdateReservation(r models.Reservation) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `update reservations set first_name = $1, last_name = $2, email = $3, phone = $4, updated_at = $5 where id = $6`
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var email string
+	err = tx.QueryRowContext(ctx, `select email from reservations where id = $1`, r.ID).Scan(&email)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
 
-	_, err := m.DB.ExecContext(ctx, query,
+	query := `update reservations set first_name = $1, last_name = $2, email = $3, phone = $4, notes = $5, updated_at = $6 where id = $7`
+
+	_, err = tx.ExecContext(ctx, query,
 		r.FirstName,
 		r.LastName,
 		r.Email,
 		r.Phone,
+		r.Notes,
 		time.Now(),
 		r.ID,
 	)
-
 	if err != nil {
 		return err
 	}
 
-	return nil
+	if models.NormalizeEmail(email) != models.NormalizeEmail(r.Email) {
+		guestID, err := upsertGuest(ctx, tx, r)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `update reservations set guest_id = $1 where id = $2`, guestID, r.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
 //DeleteReservation deletes reservation by id
@@ -386,7 +694,7 @@ func (m *postgresDBRepo) DeleteReservation(id int) error {
 
 	query := `delete from reservations where id = $1`
 
-	_, err := m.DB.ExecContext(ctx, query, id)
+	_, err := m.conn().ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
@@ -394,13 +702,38 @@ func (m *postgresDBRepo) DeleteReservation(id int) error {
 	return nil
 }
 
+//CancelReservation marks a reservation as cancelled and frees its room for the booked dates
+func (m *postgresDBRepo) CancelReservation(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `update reservations set cancelled_at = $1, updated_at = $1 where id = $2 and cancelled_at is null`,
+		time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from room_restrictions where reservation_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 func (m *postgresDBRepo) UpdateProcessedForReservation(id, processed int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	query := `update reservations set processed = $1 where id = $2`
 
-	_, err := m.DB.ExecContext(ctx, query, processed, id)
+	_, err := m.conn().ExecContext(ctx, query, processed, id)
 	if err != nil {
 		return err
 	}
@@ -408,6 +741,23 @@ func (m *postgresDBRepo) UpdateProcessedForReservation(id, processed int) error
 	return nil
 }
 
+//InsertRoom inserts a room and returns its id
+func (m *postgresDBRepo) InsertRoom(r models.Room) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int
+
+	stmt := `insert into rooms (room_name, created_at, updated_at) values ($1, $2, $3) returning id`
+
+	err := m.conn().QueryRowContext(ctx, stmt, r.RoomName, time.Now(), time.Now()).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
 func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -416,7 +766,7 @@ func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
 
 	query := `select id, room_name, created_at, updated_at from rooms order by room_name`
 
-	rows, err := m.DB.QueryContext(ctx, query)
+	rows, err := m.conn().QueryContext(ctx, query)
 	if err != nil {
 		return rooms, err
 	}
@@ -453,7 +803,7 @@ func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end tim
 		from room_restrictions where $1 < end_date and $2 >= start_date
 		and room_id = $3`
 
-	rows, err := m.DB.QueryContext(ctx, query, start, end, roomID)
+	rows, err := m.conn().QueryContext(ctx, query, start, end, roomID)
 	if err != nil {
 		return nil, err
 	}
@@ -492,7 +842,7 @@ func (m *postgresDBRepo) InsertBlockForRoom(id int, startDate time.Time) error {
 	query := `insert into room_restrictions (start_date, end_date, room_id, restriction_id, created_at, updated_at)
 			values ($1, $2, $3, $4, $5, $6)`
 
-	_, err := m.DB.ExecContext(ctx, query, startDate, startDate.AddDate(0, 0, 1), id, 2, time.Now(), time.Now())
+	_, err := m.conn().ExecContext(ctx, query, startDate, startDate.AddDate(0, 0, 1), id, 2, time.Now(), time.Now())
 	if err != nil {
 		return err
 	}
@@ -506,10 +856,677 @@ func (m *postgresDBRepo) DeleteBlockByID(id int) error {
 
 	query := `delete from room_restrictions where id = $1`
 
-	_, err := m.DB.ExecContext(ctx, query, id)
+	_, err := m.conn().ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+//SearchGuests returns one page of guests whose name, email or phone contains the search text,
+//along with the total number of matches. Cancelled stays are left out of the stay count and last arrival.
+func (m *postgresDBRepo) SearchGuests(text string, limit, offset int) ([]models.Guest, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var guests []models.Guest
+	var total int
+
+	pattern := "%" + strings.ToLower(strings.TrimSpace(text)) + "%"
+
+	where := `where g.email like $1 or lower(g.first_name || ' ' || g.last_name) like $1 or g.phone like $1`
+
+	err := m.conn().QueryRowContext(ctx, `select count(g.id) from guests g `+where, pattern).Scan(&total)
+	if err != nil {
+		return guests, 0, err
+	}
+
+	query := `select g.id, g.email, g.first_name, g.last_name, g.phone, g.notes, g.created_at, g.updated_at,
+			count(r.id), max(r.start_date)
+		from guests g
+		left join reservations r on (r.guest_id = g.id and r.cancelled_at is null)
+		` + where + `
+		group by g.id
+		order by g.last_name, g.first_name, g.id
+		limit $2 offset $3`
+
+	rows, err := m.conn().QueryContext(ctx, query, pattern, limit, offset)
+	if err != nil {
+		return guests, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var g models.Guest
+		err := rows.Scan(
+			&g.ID,
+			&g.Email,
+			&g.FirstName,
+			&g.LastName,
+			&g.Phone,
+			&g.Notes,
+			&g.CreatedAt,
+			&g.UpdatedAt,
+			&g.StayCount,
+			nullTime{&g.LastArrival},
+		)
+		if err != nil {
+			return guests, 0, err
+		}
+		guests = append(guests, g)
+	}
+
+	if err = rows.Err(); err != nil {
+		return guests, 0, err
+	}
+
+	return guests, total, nil
+}
+
+//GetGuestByID returns a guest by id
+func (m *postgresDBRepo) GetGuestByID(id int) (models.Guest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var g models.Guest
+
+	query := `select id, email, first_name, last_name, phone, notes, created_at, updated_at from guests where id = $1`
+
+	err := m.conn().QueryRowContext(ctx, query, id).Scan(
+		&g.ID,
+		&g.Email,
+		&g.FirstName,
+		&g.LastName,
+		&g.Phone,
+		&g.Notes,
+		&g.CreatedAt,
+		&g.UpdatedAt,
+	)
+	if err != nil {
+		return g, err
+	}
+
+	return g, nil
+}
+
+//UpdateGuest updates a guest's contact details and notes
+func (m *postgresDBRepo) UpdateGuest(g models.Guest) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `update guests set first_name = $1, last_name = $2, phone = $3, notes = $4, updated_at = $5 where id = $6`
+
+	_, err := m.conn().ExecContext(ctx, query,
+		g.FirstName,
+		g.LastName,
+		g.Phone,
+		g.Notes,
+		time.Now(),
+		g.ID,
+	)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+//GetReservationsForGuest returns every reservation linked to a guest, cancelled ones included, latest arrival first
+func (m *postgresDBRepo) GetReservationsForGuest(guestID int) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	query := `select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.guest_id, r.notes, r.created_at, r.updated_at, r.processed,
+		r.cancelled_at, rm.id, rm.room_name
+		from reservations r
+		left join rooms rm on (r.room_id = rm.id)
+		where r.guest_id = $1
+		order by r.start_date desc`
+
+	rows, err := m.conn().QueryContext(ctx, query, guestID)
+	if err != nil {
+		return reservations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i models.Reservation
+		err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Email,
+			&i.Phone,
+			&i.StartDate,
+			&i.EndDate,
+			&i.RoomID,
+			&i.GuestID,
+			&i.Notes,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Processed,
+			nullTime{&i.CancelledAt},
+			&i.Room.ID,
+			&i.Room.RoomName,
+		)
+		if err != nil {
+			return reservations, err
+		}
+		reservations = append(reservations, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
+
+//FindDuplicateGuests returns other guests that share a name or phone number with the given guest
+func (m *postgresDBRepo) FindDuplicateGuests(g models.Guest) ([]models.Guest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var guests []models.Guest
+
+	query := `select id, email, first_name, last_name, phone, notes, created_at, updated_at
+		from guests
+		where id <> $1
+		and ((lower(first_name) = lower($2) and lower(last_name) = lower($3)) or ($4 <> '' and phone = $4))
+		order by id`
+
+	rows, err := m.conn().QueryContext(ctx, query, g.ID, g.FirstName, g.LastName, g.Phone)
+	if err != nil {
+		return guests, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d models.Guest
+		err := rows.Scan(
+			&d.ID,
+			&d.Email,
+			&d.FirstName,
+			&d.LastName,
+			&d.Phone,
+			&d.Notes,
+			&d.CreatedAt,
+			&d.UpdatedAt,
+		)
+		if err != nil {
+			return guests, err
+		}
+		guests = append(guests, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return guests, err
+	}
+
+	return guests, nil
+}
+
+//MergeGuests moves every reservation of the source guest to the target guest, keeps the source's email
+//as an alias of the target and deletes the source guest
+func (m *postgresDBRepo) MergeGuests(targetID, sourceID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if targetID == sourceID {
+		return errors.New("cannot merge a guest into itself")
+	}
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var sourceEmail, sourcePhone, sourceNotes string
+	err = tx.QueryRowContext(ctx, `select email, phone, notes from guests where id = $1`, sourceID).Scan(&sourceEmail, &sourcePhone, &sourceNotes)
+	if err != nil {
+		return err
+	}
+
+	var targetPhone, targetNotes string
+	err = tx.QueryRowContext(ctx, `select phone, notes from guests where id = $1`, targetID).Scan(&targetPhone, &targetNotes)
+	if err != nil {
+		return err
+	}
+
+	if targetPhone == "" {
+		targetPhone = sourcePhone
+	}
+
+	if sourceNotes != "" {
+		targetNotes = strings.TrimSpace(targetNotes + "\n" + sourceNotes)
+	}
+
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`update reservations set guest_id = $1 where guest_id = $2`, []interface{}{targetID, sourceID}},
+		{`update guest_aliases set guest_id = $1 where guest_id = $2`, []interface{}{targetID, sourceID}},
+		{`insert into guest_aliases (email, guest_id, created_at) values ($1, $2, $3)`, []interface{}{sourceEmail, targetID, time.Now()}},
+		{`update guests set phone = $1, notes = $2, updated_at = $3 where id = $4`, []interface{}{targetPhone, targetNotes, time.Now(), targetID}},
+		{`delete from guests where id = $1`, []interface{}{sourceID}},
+	}
+
+	for _, stmt := range statements {
+		_, err = tx.ExecContext(ctx, stmt.query, stmt.args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func insertOutboxMessage(ctx context.Context, db conn, msg models.MailData) error {
+	stmt := `insert into outbox
+		(mail_to, mail_from, subject, content, text_content, template, status, attempts, next_attempt_at,
+		created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, 0, $8, $9, $10)`
+
+	now := time.Now()
+
+	_, err := db.ExecContext(ctx, stmt,
+		msg.To,
+		msg.From,
+		msg.Subject,
+		msg.Content,
+		msg.TextContent,
+		msg.Template,
+		models.OutboxPending,
+		now,
+		now,
+		now,
+	)
+
+	return err
+}
+
+const outboxColumns = `id, mail_to, mail_from, subject, content, text_content, template, status, attempts,
+	next_attempt_at, last_error, sent_at, created_at, updated_at`
+
+func scanOutboxMessage(row interface{ Scan(...interface{}) error }) (models.OutboxMessage, error) {
+	var msg models.OutboxMessage
+
+	err := row.Scan(
+		&msg.ID,
+		&msg.Mail.To,
+		&msg.Mail.From,
+		&msg.Mail.Subject,
+		&msg.Mail.Content,
+		&msg.Mail.TextContent,
+		&msg.Mail.Template,
+		&msg.Status,
+		&msg.Attempts,
+		&msg.NextAttemptAt,
+		&msg.LastError,
+		nullTime{&msg.SentAt},
+		&msg.CreatedAt,
+		&msg.UpdatedAt,
+	)
+
+	return msg, err
+}
+
+//ClaimOutboxMessages returns up to limit pending messages whose next attempt is at or before now, in the
+//order they were queued, and moves their next attempt to now plus lease in the same statement, so other
+//workers do not see them as due while they are being sent. Rows claimed by another transaction are skipped.
+func (m *postgresDBRepo) ClaimOutboxMessages(now time.Time, lease time.Duration, limit int) ([]models.OutboxMessage, error) {
+	return m.claimOutboxMessages(now, lease, limit, "for update skip locked")
+}
+
+//claimOutboxMessages claims due messages, locking the rows it selects with lock
+func (m *postgresDBRepo) claimOutboxMessages(now time.Time, lease time.Duration, limit int, lock string) ([]models.OutboxMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var messages []models.OutboxMessage
+
+	query := `update outbox set next_attempt_at = $3, updated_at = $2
+		where id in (
+			select id from outbox
+			where status = $1 and next_attempt_at <= $2
+			order by next_attempt_at, id
+			limit $4 ` + lock + `)
+		returning ` + outboxColumns
+
+	rows, err := m.conn().QueryContext(ctx, query, models.OutboxPending, now, now.Add(lease), limit)
+	if err != nil {
+		return messages, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		msg, err := scanOutboxMessage(rows)
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, msg)
+	}
+
+	if err = rows.Err(); err != nil {
+		return messages, err
+	}
+
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID < messages[j].ID })
+
+	return messages, nil
+}
+
+//SearchOutboxMessages returns a page of outbox messages, newest first, optionally limited to one status,
+//along with the total number of matching messages
+func (m *postgresDBRepo) SearchOutboxMessages(status string, limit, offset int) ([]models.OutboxMessage, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var messages []models.OutboxMessage
+	var total int
+
+	where := `where ($1 = '' or status = $1)`
+
+	err := m.conn().QueryRowContext(ctx, `select count(id) from outbox `+where, status).Scan(&total)
+	if err != nil {
+		return messages, 0, err
+	}
+
+	query := `select ` + outboxColumns + ` from outbox ` + where + `
+		order by created_at desc, id desc
+		limit $2 offset $3`
+
+	rows, err := m.conn().QueryContext(ctx, query, status, limit, offset)
+	if err != nil {
+		return messages, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		msg, err := scanOutboxMessage(rows)
+		if err != nil {
+			return messages, 0, err
+		}
+		messages = append(messages, msg)
+	}
+
+	if err = rows.Err(); err != nil {
+		return messages, 0, err
+	}
+
+	return messages, total, nil
+}
+
+//GetOutboxMessageByID returns an outbox message by id
+func (m *postgresDBRepo) GetOutboxMessageByID(id int) (models.OutboxMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row := m.conn().QueryRowContext(ctx, `select `+outboxColumns+` from outbox where id = $1`, id)
+
+	return scanOutboxMessage(row)
+}
+
+//UpdateOutboxMessage saves the delivery state of an outbox message
+func (m *postgresDBRepo) UpdateOutboxMessage(msg models.OutboxMessage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var sentAt interface{}
+	if !msg.SentAt.IsZero() {
+		sentAt = msg.SentAt
+	}
+
+	stmt := `update outbox set status = $1, attempts = $2, next_attempt_at = $3, last_error = $4,
+		sent_at = $5, updated_at = $6
+		where id = $7`
+
+	_, err := m.conn().ExecContext(ctx, stmt,
+		msg.Status,
+		msg.Attempts,
+		msg.NextAttemptAt,
+		msg.LastError,
+		sentAt,
+		time.Now(),
+		msg.ID,
+	)
+
+	return err
+}
+
+//AllEmailSchedules returns every scheduled email, arrival reminders first
+func (m *postgresDBRepo) AllEmailSchedules() ([]models.EmailSchedule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var schedules []models.EmailSchedule
+
+	query := `select id, name, template, anchor, offset_days, enabled, created_at, updated_at
+		from email_schedules
+		order by anchor, offset_days, id`
+
+	rows, err := m.conn().QueryContext(ctx, query)
+	if err != nil {
+		return schedules, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s models.EmailSchedule
+		err := rows.Scan(
+			&s.ID,
+			&s.Name,
+			&s.Template,
+			&s.Anchor,
+			&s.OffsetDays,
+			&s.Enabled,
+			&s.CreatedAt,
+			&s.UpdatedAt,
+		)
+		if err != nil {
+			return schedules, err
+		}
+		schedules = append(schedules, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return schedules, err
+	}
+
+	return schedules, nil
+}
+
+//GetEmailScheduleByID returns a scheduled email by id
+func (m *postgresDBRepo) GetEmailScheduleByID(id int) (models.EmailSchedule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var s models.EmailSchedule
+
+	query := `select id, name, template, anchor, offset_days, enabled, created_at, updated_at
+		from email_schedules where id = $1`
+
+	err := m.conn().QueryRowContext(ctx, query, id).Scan(
+		&s.ID,
+		&s.Name,
+		&s.Template,
+		&s.Anchor,
+		&s.OffsetDays,
+		&s.Enabled,
+		&s.CreatedAt,
+		&s.UpdatedAt,
+	)
+
+	return s, err
+}
+
+//UpdateEmailSchedule saves the template, timing and state of a scheduled email
+func (m *postgresDBRepo) UpdateEmailSchedule(s models.EmailSchedule) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `update email_schedules set name = $1, template = $2, anchor = $3, offset_days = $4, enabled = $5, updated_at = $6
+		where id = $7`
+
+	_, err := m.conn().ExecContext(ctx, stmt,
+		s.Name,
+		s.Template,
+		s.Anchor,
+		s.OffsetDays,
+		s.Enabled,
+		time.Now(),
+		s.ID,
+	)
+
+	return err
+}
+
+//ReservationsDueForEmail returns the reservations that are not cancelled, whose email from schedule s
+//is due on or before today and was due at most graceDays ago, and that have not been sent it yet.
+//Reminders counted from arrival are never sent once the guest has arrived.
+func (m *postgresDBRepo) ReservationsDueForEmail(s models.EmailSchedule, today time.Time, graceDays int) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	column := "r.start_date"
+	if s.Anchor == models.AnchorDeparture {
+		column = "r.end_date"
+	}
+
+	latest := today.AddDate(0, 0, -s.OffsetDays)
+	earliest := latest.AddDate(0, 0, -graceDays)
+	//emails before arrival are not sent once the guest has arrived, while emails after it are sent as usual
+	if s.Anchor == models.AnchorArrival && s.OffsetDays <= 0 && earliest.Before(today) {
+		earliest = today
+	}
+
+	query := `select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id,
+			coalesce(r.guest_id, 0), r.notes, r.locale, r.created_at, r.updated_at, r.processed, rm.id, rm.room_name
+		from reservations r
+		left join rooms rm on (r.room_id = rm.id)
+		where ` + column + ` <= $1 and ` + column + ` >= $2
+			and r.cancelled_at is null
+			and not exists (select 1 from reservation_emails re where re.reservation_id = r.id and re.schedule_id = $3)
+		order by r.id`
+
+	rows, err := m.conn().QueryContext(ctx, query, latest, earliest, s.ID)
+	if err != nil {
+		return reservations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i models.Reservation
+		err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Email,
+			&i.Phone,
+			&i.StartDate,
+			&i.EndDate,
+			&i.RoomID,
+			&i.GuestID,
+			&i.Notes,
+			&i.Locale,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Processed,
+			&i.Room.ID,
+			&i.Room.RoomName,
+		)
+		if err != nil {
+			return reservations, err
+		}
+		reservations = append(reservations, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
+
+//QueueScheduledEmail records that the email from a schedule was sent for a reservation and queues it in the outbox,
+//in one transaction. It returns false without queueing anything if the email was already recorded.
+func (m *postgresDBRepo) QueueScheduledEmail(reservationID, scheduleID int, msg models.MailData) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	stmt := `insert into reservation_emails (reservation_id, schedule_id, created_at)
+		values ($1, $2, $3)
+		on conflict do nothing`
+
+	result, err := tx.ExecContext(ctx, stmt, reservationID, scheduleID, time.Now())
+	if err != nil {
+		return false, err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	if inserted == 0 {
+		return false, nil
+	}
+
+	err = insertOutboxMessage(ctx, tx, msg)
+	if err != nil {
+		return false, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+//importUploadTTL is how long an uploaded import file is kept for its import to be confirmed
+const importUploadTTL = 24 * time.Hour
+
+//SaveImportUpload stores an uploaded import file under token until it is taken, and removes the uploads
+//that were never confirmed
+func (m *postgresDBRepo) SaveImportUpload(token, content string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.conn().ExecContext(ctx, `delete from import_uploads where created_at < $1`, time.Now().Add(-importUploadTTL))
+	if err != nil {
+		return err
+	}
+
+	_, err = m.conn().ExecContext(ctx, `insert into import_uploads (token, content, created_at) values ($1, $2, $3)`,
+		token, content, time.Now())
+
+	return err
+}
+
+//TakeImportUpload removes and returns the import file stored under token, or sql.ErrNoRows if there is none,
+//so a file can only be imported once
+func (m *postgresDBRepo) TakeImportUpload(token string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var content string
+
+	err := m.conn().QueryRowContext(ctx, `delete from import_uploads where token = $1 and created_at >= $2 returning content`,
+		token, time.Now().Add(-importUploadTTL)).Scan(&content)
+
+	return content, err
+}
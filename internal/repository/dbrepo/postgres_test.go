@@ -0,0 +1,114 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Rha02/bookings/internal/config"
+	"github.com/Rha02/bookings/internal/driver"
+	"github.com/Rha02/bookings/internal/migrate"
+	"github.com/Rha02/bookings/internal/repository"
+	"github.com/Rha02/bookings/internal/repository/repotest"
+	"github.com/Rha02/bookings/migrations"
+)
+
+//withSearchPath returns dsn with the search path set to schema, followed by public for the extensions installed there
+func withSearchPath(dsn, schema string) (string, error) {
+	path := schema + ",public"
+
+	if !strings.Contains(dsn, "://") {
+		return dsn + " search_path=" + path, nil
+	}
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", err
+	}
+
+	q := u.Query()
+	q.Set("search_path", path)
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+//newPostgresRepo returns a repository on a throwaway schema of the database in TEST_DATABASE_URL,
+//migrated from scratch and dropped when the test ends
+func newPostgresRepo(t *testing.T) repository.DatabaseRepo {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+
+	admin, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := fmt.Sprintf("bookings_test_%d", time.Now().UnixNano())
+
+	if _, err = admin.Exec(`create schema ` + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec(`drop schema ` + schema + ` cascade`); err != nil {
+			t.Errorf("dropping schema %s: %s", schema, err)
+		}
+	})
+
+	source, err := withSearchPath(dsn, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("pgx", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	m, err := migrate.New(db, migrations.FS, driver.DialectPostgres)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewPostgresRepo(db, &config.AppConfig{})
+}
+
+func TestWithSearchPath(t *testing.T) {
+	var tests = []struct {
+		dsn      string
+		expected string
+	}{
+		{"postgres://u:p@db/bookings", "postgres://u:p@db/bookings?search_path=s%2Cpublic"},
+		{"postgres://u:p@db/bookings?sslmode=disable", "postgres://u:p@db/bookings?search_path=s%2Cpublic&sslmode=disable"},
+		{"host=db dbname=bookings", "host=db dbname=bookings search_path=s,public"},
+	}
+
+	for _, e := range tests {
+		got, err := withSearchPath(e.dsn, "s")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != e.expected {
+			t.Errorf("expected %s, got %s", e.expected, got)
+		}
+	}
+}
+
+//TestPostgres_Conformance runs against the database in TEST_DATABASE_URL and is skipped when it is not set
+func TestPostgres_Conformance(t *testing.T) {
+	if os.Getenv("TEST_DATABASE_URL") == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	repotest.Run(t, newPostgresRepo)
+}
@@ -0,0 +1,130 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Rha02/bookings/internal/config"
+	"github.com/Rha02/bookings/internal/models"
+	"github.com/Rha02/bookings/internal/repository"
+)
+
+//sqliteDBRepo runs the Postgres queries against SQLite, through the driver that rewrites their placeholders,
+//and replaces the few that rely on Postgres extensions
+type sqliteDBRepo struct {
+	postgresDBRepo
+}
+
+func NewSQLiteRepo(conn *sql.DB, a *config.AppConfig) repository.DatabaseRepo {
+	return &sqliteDBRepo{postgresDBRepo{
+		App: a,
+		DB:  conn,
+	}}
+}
+
+//maxSearchTerms limits the number of words of the search text that are matched separately
+const maxSearchTerms = 8
+
+//sqliteSearchDocument is the text that search terms are matched against
+const sqliteSearchDocument = `lower(r.first_name || ' ' || r.last_name || ' ' || r.email || ' ' || r.phone || ' ' || r.notes)`
+
+//sqlitePhoneDigits strips the usual separators from phone numbers, as SQLite has no regexp_replace
+const sqlitePhoneDigits = `replace(replace(replace(replace(replace(replace(r.phone, ' ', ''), '-', ''), '(', ''), ')', ''), '+', ''), '.', '')`
+
+//FullTextSearchReservations returns the reservations whose guest details or notes contain words of the search text,
+//ranked by the number of words matched, with matches on the whole name or email first
+func (m *sqliteDBRepo) FullTextSearchReservations(text string, limit int) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, text)
+
+	if len(digits) < 3 {
+		digits = ""
+	}
+
+	term := strings.ToLower(strings.TrimSpace(text))
+	words := strings.Fields(term)
+	if len(words) > maxSearchTerms {
+		words = words[:maxSearchTerms]
+	}
+
+	args := []interface{}{term, digits, limit}
+
+	matches := []string{"0"}
+	for _, w := range words {
+		args = append(args, w)
+		matches = append(matches, fmt.Sprintf("(instr(%s, $%d) > 0)", sqliteSearchDocument, len(args)))
+	}
+	rank := strings.Join(matches, " + ")
+
+	query := fmt.Sprintf(`select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.notes, r.created_at, r.updated_at, r.processed,
+			rm.id, rm.room_name
+		from reservations r
+		left join rooms rm on (r.room_id = rm.id)
+		where $1 <> '' and (%[1]s > 0
+			or instr(lower(r.first_name || ' ' || r.last_name), $1) > 0
+			or ($2 <> '' and instr(%[2]s, $2) > 0))
+		order by (instr(lower(r.first_name || ' ' || r.last_name), $1) > 0) + (instr(lower(r.email), $1) > 0) + %[1]s desc,
+			r.start_date desc
+		limit $3`, rank, sqlitePhoneDigits)
+
+	rows, err := m.conn().QueryContext(ctx, query, args...)
+	if err != nil {
+		return reservations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i models.Reservation
+		err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Email,
+			&i.Phone,
+			&i.StartDate,
+			&i.EndDate,
+			&i.RoomID,
+			&i.Notes,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Processed,
+			&i.Room.ID,
+			&i.Room.RoomName,
+		)
+
+		if err != nil {
+			return reservations, err
+		}
+
+		reservations = append(reservations, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
+
+//ClaimOutboxMessages claims due messages like the Postgres repository. SQLite has no row locks, but it runs
+//one write at a time, so the select and update of the statement cannot interleave with another claim.
+func (m *sqliteDBRepo) ClaimOutboxMessages(now time.Time, lease time.Duration, limit int) ([]models.OutboxMessage, error) {
+	return m.claimOutboxMessages(now, lease, limit, "")
+}
+
+//Transaction runs fn in one transaction like the Postgres repository, with a repository that keeps the SQLite queries
+func (m *sqliteDBRepo) Transaction(fn func(repo repository.DatabaseRepo) error) error {
+	return m.transaction(fn, func(tx postgresDBRepo) repository.DatabaseRepo { return &sqliteDBRepo{tx} })
+}
@@ -0,0 +1,38 @@
+package dbrepo
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/Rha02/bookings/internal/config"
+	"github.com/Rha02/bookings/internal/driver"
+	"github.com/Rha02/bookings/internal/migrate"
+	"github.com/Rha02/bookings/internal/repository"
+	"github.com/Rha02/bookings/internal/repository/repotest"
+	"github.com/Rha02/bookings/migrations"
+)
+
+//newSQLiteRepo returns a repository on a freshly migrated SQLite file
+func newSQLiteRepo(t *testing.T) repository.DatabaseRepo {
+	db, err := driver.ConnectSQL("sqlite3://" + filepath.Join(t.TempDir(), "bookings.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.SQL.Close() })
+
+	m, err := migrate.New(db.SQL, migrations.FS, db.Dialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return New(db, &config.AppConfig{})
+}
+
+func TestSQLite_Conformance(t *testing.T) {
+	repotest.Run(t, newSQLiteRepo)
+}
@@ -1,28 +1,45 @@
 package repository
 
 import (
+	"errors"
 	"time"
 
 	"github.com/Rha02/bookings/internal/models"
 )
 
+//ErrUnavailable is returned when a booking overlaps a reservation or block of its room, or its buffer nights do
+var ErrUnavailable = errors.New("room is not available for these dates")
+
 type DatabaseRepo interface {
+	Transaction(fn func(repo DatabaseRepo) error) error
+
 	AllUsers() bool
 	GetUserByID(id int) (models.User, error)
 	UpdateUser(u models.User) error
+	UpsertUser(u models.User, password string) (int, error)
 
 	Authenticate(email, testPassword string) (int, string, error)
 
 	InsertReservation(res models.Reservation) (int, error)
+	BookReservation(res models.Reservation, bufferNights int, mail []models.MailData) (int, error)
 
-	AllReservations() ([]models.Reservation, error)
-	AllNewReservations() ([]models.Reservation, error)
+	SearchReservations(f models.ReservationFilter) ([]models.Reservation, int, error)
+	FullTextSearchReservations(text string, limit int) ([]models.Reservation, error)
 	GetReservationByID(id int) (models.Reservation, error)
 	UpdateReservation(r models.Reservation) error
 	DeleteReservation(id int) error
+	CancelReservation(id int) error
 	UpdateProcessedForReservation(id, processed int) error
 
+	SearchGuests(text string, limit, offset int) ([]models.Guest, int, error)
+	GetGuestByID(id int) (models.Guest, error)
+	UpdateGuest(g models.Guest) error
+	GetReservationsForGuest(guestID int) ([]models.Reservation, error)
+	FindDuplicateGuests(g models.Guest) ([]models.Guest, error)
+	MergeGuests(targetID, sourceID int) error
+
 	AllRooms() ([]models.Room, error)
+	InsertRoom(r models.Room) (int, error)
 
 	GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error)
 
@@ -33,4 +50,18 @@ type DatabaseRepo interface {
 	CheckAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error)
 	SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error)
 	GetRoomByID(id int) (models.Room, error)
+
+	ClaimOutboxMessages(now time.Time, lease time.Duration, limit int) ([]models.OutboxMessage, error)
+	SearchOutboxMessages(status string, limit, offset int) ([]models.OutboxMessage, int, error)
+	GetOutboxMessageByID(id int) (models.OutboxMessage, error)
+	UpdateOutboxMessage(msg models.OutboxMessage) error
+
+	SaveImportUpload(token, content string) error
+	TakeImportUpload(token string) (string, error)
+
+	AllEmailSchedules() ([]models.EmailSchedule, error)
+	GetEmailScheduleByID(id int) (models.EmailSchedule, error)
+	UpdateEmailSchedule(s models.EmailSchedule) error
+	ReservationsDueForEmail(s models.EmailSchedule, today time.Time, graceDays int) ([]models.Reservation, error)
+	QueueScheduledEmail(reservationID, scheduleID int, msg models.MailData) (bool, error)
 }
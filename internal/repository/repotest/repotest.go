@@ -0,0 +1,1082 @@
+//Package repotest holds the conformance suite that every repository.DatabaseRepo implementation must pass
+package repotest
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Rha02/bookings/internal/models"
+	"github.com/Rha02/bookings/internal/repository"
+)
+
+//NewRepo returns an empty repository for one test. It must hold only what the migrations add to a new database:
+//the rooms General's Quarters (1) and Colonel's Suite (2), the admin user (1) and the two email schedules.
+type NewRepo func(t *testing.T) repository.DatabaseRepo
+
+//Run runs every conformance test against the repositories returned by newRepo, one repository per test
+func Run(t *testing.T, newRepo NewRepo) {
+	var tests = []struct {
+		name string
+		test func(t *testing.T, repo repository.DatabaseRepo)
+	}{
+		{"Users", testUsers},
+		{"Rooms", testRooms},
+		{"Availability", testAvailability},
+		{"Restrictions", testRestrictions},
+		{"Reservations", testReservations},
+		{"BookReservation", testBookReservation},
+		{"SearchReservations", testSearchReservations},
+		{"FullTextSearch", testFullTextSearch},
+		{"Guests", testGuests},
+		{"MergeGuests", testMergeGuests},
+		{"Outbox", testOutbox},
+		{"EmailSchedules", testEmailSchedules},
+		{"ReservationsDueForEmail", testReservationsDueForEmail},
+		{"ImportUploads", testImportUploads},
+		{"Transaction", testTransaction},
+	}
+
+	for _, e := range tests {
+		t.Run(e.name, func(t *testing.T) {
+			e.test(t, newRepo(t))
+		})
+	}
+}
+
+//Date returns midnight UTC on a day of January 2050
+func Date(day int) time.Time {
+	return time.Date(2050, 1, day, 0, 0, 0, 0, time.UTC)
+}
+
+//reservation returns a reservation of room for the given days of January 2050
+func reservation(first, last, email string, roomID, start, end int) models.Reservation {
+	return models.Reservation{
+		FirstName: first,
+		LastName:  last,
+		Email:     email,
+		StartDate: Date(start),
+		EndDate:   Date(end),
+		RoomID:    roomID,
+	}
+}
+
+//mustInsert inserts a reservation, failing the test on error
+func mustInsert(t *testing.T, repo repository.DatabaseRepo, res models.Reservation) int {
+	t.Helper()
+
+	id, err := repo.InsertReservation(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+//mustBook books a reservation, failing the test on error
+func mustBook(t *testing.T, repo repository.DatabaseRepo, res models.Reservation, mail ...models.MailData) int {
+	t.Helper()
+
+	id, err := repo.BookReservation(res, 0, mail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+//reservationIDs returns the ids of reservations, in order
+func reservationIDs(reservations []models.Reservation) []int {
+	ids := []int{}
+	for _, r := range reservations {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+//roomIDs returns the sorted ids of rooms
+func roomIDs(rooms []models.Room) []int {
+	ids := []int{}
+	for _, r := range rooms {
+		ids = append(ids, r.ID)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+//guestIDs returns the ids of guests, in order
+func guestIDs(guests []models.Guest) []int {
+	ids := []int{}
+	for _, g := range guests {
+		ids = append(ids, g.ID)
+	}
+	return ids
+}
+
+//outboxIDs returns the ids of outbox messages, in order
+func outboxIDs(messages []models.OutboxMessage) []int {
+	ids := []int{}
+	for _, msg := range messages {
+		ids = append(ids, msg.ID)
+	}
+	return ids
+}
+
+func equalIDs(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func testUsers(t *testing.T, repo repository.DatabaseRepo) {
+	if !repo.AllUsers() {
+		t.Error("AllUsers returned false")
+	}
+
+	admin, err := repo.GetUserByID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if admin.Email != "admin@bookings.loc" || admin.AccessLevel != 3 {
+		t.Errorf("unexpected admin user %+v", admin)
+	}
+
+	if _, err = repo.GetUserByID(99); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows for a missing user, got %v", err)
+	}
+
+	id, err := repo.UpsertUser(models.User{FirstName: "Sam", LastName: "Staff", Email: "staff@bookings.loc", AccessLevel: 1}, "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _, err := repo.Authenticate("staff@bookings.loc", "first"); err != nil || got != id {
+		t.Errorf("Authenticate returned user %d (err %v), expected %d", got, err, id)
+	}
+
+	again, err := repo.UpsertUser(models.User{FirstName: "Sam", LastName: "Staff", Email: "staff@bookings.loc", AccessLevel: 2}, "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != id {
+		t.Errorf("upserting an existing email returned user %d, expected %d", again, id)
+	}
+
+	if _, _, err = repo.Authenticate("staff@bookings.loc", "first"); err == nil {
+		t.Error("the replaced password is still accepted")
+	}
+
+	if got, _, err := repo.Authenticate("staff@bookings.loc", "second"); err != nil || got != id {
+		t.Errorf("Authenticate returned user %d (err %v) for the new password", got, err)
+	}
+
+	if _, _, err = repo.Authenticate("nobody@bookings.loc", "second"); err == nil {
+		t.Error("authenticated a missing user")
+	}
+
+	err = repo.UpdateUser(models.User{ID: id, FirstName: "Samantha", LastName: "Staff", Email: "sam@bookings.loc", AccessLevel: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := repo.GetUserByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.FirstName != "Samantha" || u.Email != "sam@bookings.loc" || u.AccessLevel != 3 {
+		t.Errorf("user was not updated: %+v", u)
+	}
+}
+
+func testRooms(t *testing.T, repo repository.DatabaseRepo) {
+	rooms, err := repo.AllRooms()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rooms) != 2 || rooms[0].RoomName != "Colonel's Suite" || rooms[1].RoomName != "General's Quarters" {
+		t.Errorf("expected the seeded rooms ordered by name, got %+v", rooms)
+	}
+
+	id, err := repo.InsertRoom(models.Room{RoomName: "Admiral's Cabin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	room, err := repo.GetRoomByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if room.ID != id || room.RoomName != "Admiral's Cabin" || room.CreatedAt.IsZero() {
+		t.Errorf("unexpected room %+v", room)
+	}
+
+	rooms, _ = repo.AllRooms()
+	if len(rooms) != 3 || rooms[0].ID != id {
+		t.Errorf("expected the new room to be listed first, got %+v", rooms)
+	}
+
+	if _, err = repo.GetRoomByID(99); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows for a missing room, got %v", err)
+	}
+}
+
+//testAvailability checks the overlap semantics of the availability queries. Stays are half-open ranges,
+//so a room can be left and taken on the same day.
+func testAvailability(t *testing.T, repo repository.DatabaseRepo) {
+	id := mustBook(t, repo, reservation("John", "Smith", "john@here.com", 1, 10, 15))
+
+	if err := repo.InsertBlockForRoom(2, Date(20)); err != nil {
+		t.Fatal(err)
+	}
+
+	//a local time on the same instant must compare like its UTC equivalent
+	local := time.FixedZone("UTC+5", 5*3600)
+
+	var tests = []struct {
+		name      string
+		start     time.Time
+		end       time.Time
+		roomID    int
+		available bool
+	}{
+		{"departs on arrival day", Date(5), Date(10), 1, true},
+		{"arrives on departure day", Date(15), Date(20), 1, true},
+		{"first night", Date(10), Date(11), 1, false},
+		{"last night", Date(14), Date(15), 1, false},
+		{"overlaps the start", Date(8), Date(11), 1, false},
+		{"overlaps the end", Date(14), Date(18), 1, false},
+		{"inside", Date(11), Date(12), 1, false},
+		{"surrounds", Date(1), Date(31), 1, false},
+		{"same dates", Date(10), Date(15), 1, false},
+		{"other room", Date(10), Date(15), 2, true},
+		{"local time zone", Date(14).In(local), Date(18).In(local), 1, false},
+		{"blocked night", Date(20), Date(21), 2, false},
+		{"departs on blocked day", Date(18), Date(20), 2, true},
+		{"arrives after block", Date(21), Date(23), 2, true},
+		{"surrounds block", Date(19), Date(22), 2, false},
+		{"missing room", Date(10), Date(15), 99, true},
+	}
+
+	for _, e := range tests {
+		ok, err := repo.CheckAvailabilityByDatesByRoomID(e.start, e.end, e.roomID)
+		if err != nil {
+			t.Fatalf("%s: %s", e.name, err)
+		}
+		if ok != e.available {
+			t.Errorf("%s: expected available %t, got %t", e.name, e.available, ok)
+		}
+	}
+
+	var searches = []struct {
+		name  string
+		start time.Time
+		end   time.Time
+		rooms []int
+	}{
+		{"during reservation", Date(12), Date(13), []int{2}},
+		{"during block", Date(20), Date(21), []int{1}},
+		{"reservation and block", Date(14), Date(21), []int{}},
+		{"between reservation and block", Date(15), Date(20), []int{1, 2}},
+	}
+
+	for _, e := range searches {
+		rooms, err := repo.SearchAvailabilityForAllRooms(e.start, e.end)
+		if err != nil {
+			t.Fatalf("%s: %s", e.name, err)
+		}
+		if got := roomIDs(rooms); !equalIDs(got, e.rooms) {
+			t.Errorf("%s: expected rooms %v, got %v", e.name, e.rooms, got)
+		}
+	}
+
+	if err := repo.CancelReservation(id); err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := repo.CheckAvailabilityByDatesByRoomID(Date(10), Date(15), 1)
+	if err != nil || !ok {
+		t.Errorf("room is not available after the reservation was cancelled (err %v)", err)
+	}
+
+	id = mustBook(t, repo, reservation("John", "Smith", "john@here.com", 1, 10, 15))
+
+	if err = repo.DeleteReservation(id); err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err = repo.CheckAvailabilityByDatesByRoomID(Date(10), Date(15), 1)
+	if err != nil || !ok {
+		t.Errorf("room is not available after the reservation was deleted (err %v)", err)
+	}
+}
+
+func testRestrictions(t *testing.T, repo repository.DatabaseRepo) {
+	id := mustInsert(t, repo, reservation("John", "Smith", "john@here.com", 1, 10, 15))
+
+	err := repo.InsertRoomRestriction(models.RoomRestriction{
+		StartDate: Date(10), EndDate: Date(15), RoomID: 1, ReservationID: id, RestrictionID: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, day := range []int{20, 25} {
+		if err = repo.InsertBlockForRoom(1, Date(day)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	restrictions, err := repo.GetRestrictionsForRoomByDate(1, Date(1), Date(31))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Slice(restrictions, func(i, j int) bool { return restrictions[i].StartDate.Before(restrictions[j].StartDate) })
+
+	if len(restrictions) != 3 {
+		t.Fatalf("expected 3 restrictions, got %+v", restrictions)
+	}
+
+	stay, block := restrictions[0], restrictions[1]
+	if stay.ReservationID != id || stay.RestrictionID != 1 || stay.RoomID != 1 || !stay.EndDate.Equal(Date(15)) {
+		t.Errorf("unexpected reservation restriction %+v", stay)
+	}
+	if block.ReservationID != 0 || block.RestrictionID != 2 || !block.StartDate.Equal(Date(20)) || !block.EndDate.Equal(Date(21)) {
+		t.Errorf("unexpected block %+v", block)
+	}
+
+	//the range is matched against the nights it contains, plus a block starting on its last day
+	restrictions, err = repo.GetRestrictionsForRoomByDate(1, Date(21), Date(25))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restrictions) != 1 || !restrictions[0].StartDate.Equal(Date(25)) {
+		t.Errorf("expected only the block on the 25th, got %+v", restrictions)
+	}
+
+	if restrictions, _ = repo.GetRestrictionsForRoomByDate(2, Date(1), Date(31)); len(restrictions) != 0 {
+		t.Errorf("expected no restrictions for room 2, got %+v", restrictions)
+	}
+
+	if err = repo.DeleteBlockByID(block.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, _ := repo.CheckAvailabilityByDatesByRoomID(Date(20), Date(21), 1); !ok {
+		t.Error("room is not available after the block was deleted")
+	}
+
+	if err = repo.InsertBlockForRoom(99, Date(20)); err == nil {
+		t.Error("blocked a missing room")
+	}
+
+	err = repo.InsertRoomRestriction(models.RoomRestriction{StartDate: Date(1), EndDate: Date(2), RoomID: 99, RestrictionID: 2})
+	if err == nil {
+		t.Error("inserted a restriction for a missing room")
+	}
+}
+
+func testReservations(t *testing.T, repo repository.DatabaseRepo) {
+	res := reservation("Jane", "Doe", "Jane@Example.com", 2, 3, 5)
+	res.Phone = "+1 (555) 123-4567"
+	res.Notes = "late arrival"
+
+	id := mustInsert(t, repo, res)
+
+	got, err := repo.GetReservationByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.FirstName != "Jane" || got.Email != "Jane@Example.com" || got.Phone != res.Phone || got.Notes != "late arrival" {
+		t.Errorf("unexpected reservation %+v", got)
+	}
+	if !got.StartDate.Equal(Date(3)) || !got.EndDate.Equal(Date(5)) || got.RoomID != 2 || got.Room.RoomName != "Colonel's Suite" {
+		t.Errorf("unexpected stay %+v", got)
+	}
+	if got.GuestID == 0 || got.Processed != 0 || got.Cancelled() || got.CreatedAt.IsZero() {
+		t.Errorf("unexpected state %+v", got)
+	}
+
+	oldGuestID := got.GuestID
+	got.FirstName = "Janet"
+	got.Email = "janet@example.com"
+	got.Phone = "555"
+	got.Notes = "early arrival"
+	got.StartDate = Date(1)
+
+	if err = repo.UpdateReservation(got); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ = repo.GetReservationByID(id)
+	if got.FirstName != "Janet" || got.Email != "janet@example.com" || got.Phone != "555" || got.Notes != "early arrival" {
+		t.Errorf("reservation was not updated: %+v", got)
+	}
+	if !got.StartDate.Equal(Date(3)) {
+		t.Errorf("updating a reservation changed its dates: %+v", got)
+	}
+
+	//the new email moves the stay to the guest of that address
+	guests, _, _ := repo.SearchGuests("janet@example.com", 10, 0)
+	if len(guests) != 1 || guests[0].ID != got.GuestID || guests[0].StayCount != 1 || guests[0].Phone != "555" {
+		t.Errorf("expected the reservation to be linked to the new guest %d, got %+v", got.GuestID, guests)
+	}
+	if stays, _ := repo.GetReservationsForGuest(oldGuestID); len(stays) != 0 {
+		t.Errorf("the old guest still has the reservation: %+v", stays)
+	}
+
+	guestID := got.GuestID
+	got.Email = " JANET@Example.com"
+	if err = repo.UpdateReservation(got); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ = repo.GetReservationByID(id); got.GuestID != guestID {
+		t.Errorf("the same address in another case moved the reservation to guest %d", got.GuestID)
+	}
+
+	if err = repo.UpdateProcessedForReservation(id, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ = repo.GetReservationByID(id); got.Processed != 1 {
+		t.Errorf("reservation was not processed: %+v", got)
+	}
+
+	if err = repo.CancelReservation(id); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ = repo.GetReservationByID(id)
+	if !got.Cancelled() {
+		t.Fatal("reservation is not cancelled")
+	}
+
+	cancelledAt := got.CancelledAt
+	if err = repo.CancelReservation(id); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ = repo.GetReservationByID(id); !got.CancelledAt.Equal(cancelledAt) {
+		t.Errorf("cancelling again moved the cancellation from %s to %s", cancelledAt, got.CancelledAt)
+	}
+
+	if err = repo.DeleteReservation(id); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = repo.GetReservationByID(id); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows for a deleted reservation, got %v", err)
+	}
+
+	if _, err = repo.InsertReservation(reservation("Jane", "Doe", "jane@example.com", 99, 3, 5)); err == nil {
+		t.Error("inserted a reservation for a missing room")
+	}
+}
+
+func testBookReservation(t *testing.T, repo repository.DatabaseRepo) {
+	mail := []models.MailData{
+		{To: "jane@example.com", From: "me@here.com", Subject: "Reservation Confirmation", Content: "<p>Hi</p>", TextContent: "Hi"},
+		{To: "me@here.com", From: "me@here.com", Subject: "Reservation Notification", Content: "<p>New</p>"},
+	}
+
+	id := mustBook(t, repo, reservation("Jane", "Doe", "jane@example.com", 1, 10, 12), mail...)
+
+	restrictions, err := repo.GetRestrictionsForRoomByDate(1, Date(10), Date(12))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restrictions) != 1 || restrictions[0].ReservationID != id || restrictions[0].RestrictionID != 1 {
+		t.Errorf("expected the booking to restrict its room, got %+v", restrictions)
+	}
+
+	messages, total, err := repo.SearchOutboxMessages("", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || len(messages) != 2 {
+		t.Fatalf("expected 2 queued emails, got %d", total)
+	}
+
+	for _, msg := range messages {
+		if msg.Status != models.OutboxPending || msg.Attempts != 0 || msg.NextAttemptAt.IsZero() || !msg.SentAt.IsZero() {
+			t.Errorf("unexpected state of a new email %+v", msg)
+		}
+	}
+
+	//a failed booking stores none of its parts
+	if _, err = repo.BookReservation(reservation("Jim", "Beam", "jim@example.com", 99, 10, 12), 0, mail); err == nil {
+		t.Fatal("booked a missing room")
+	}
+
+	if _, total, _ = repo.SearchReservations(models.ReservationFilter{Page: 1, PageSize: 10}); total != 1 {
+		t.Errorf("expected 1 reservation after a failed booking, got %d", total)
+	}
+
+	if _, total, _ = repo.SearchOutboxMessages("", 10, 0); total != 2 {
+		t.Errorf("expected 2 queued emails after a failed booking, got %d", total)
+	}
+
+	if _, total, _ = repo.SearchGuests("jim", 10, 0); total != 0 {
+		t.Errorf("a failed booking created a guest")
+	}
+
+	//the room is checked again when booking, so a stay overlapping the first is refused
+	if _, err = repo.BookReservation(reservation("Jim", "Beam", "jim@example.com", 1, 11, 13), 0, mail); !errors.Is(err, repository.ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable for an overlapping booking, got %v", err)
+	}
+
+	if _, total, _ = repo.SearchReservations(models.ReservationFilter{Page: 1, PageSize: 10}); total != 1 {
+		t.Errorf("expected 1 reservation after an overlapping booking, got %d", total)
+	}
+
+	mustBook(t, repo, reservation("Jim", "Beam", "jim@example.com", 1, 12, 14))
+
+	//the buffer nights are checked with the room locked as well, on both sides of the stay
+	var buffered = []struct {
+		start int
+		end   int
+		ok    bool
+	}{
+		{7, 9, false},
+		{15, 16, false},
+		{16, 18, true},
+	}
+
+	for _, e := range buffered {
+		_, err = repo.BookReservation(reservation("Kim", "Lee", "kim@example.com", 1, e.start, e.end), 2, nil)
+		if e.ok && err != nil {
+			t.Errorf("expected the stay from the %d to the %d to be booked, got %v", e.start, e.end, err)
+		}
+		if !e.ok && !errors.Is(err, repository.ErrUnavailable) {
+			t.Errorf("expected ErrUnavailable for the stay from the %d to the %d within the buffer, got %v", e.start, e.end, err)
+		}
+	}
+}
+
+func testSearchReservations(t *testing.T, repo repository.DatabaseRepo) {
+	alice := mustInsert(t, repo, reservation("Alice", "Archer", "alice@example.com", 1, 1, 3))
+	bob := mustInsert(t, repo, reservation("Bob", "Baker", "bob@example.com", 2, 5, 8))
+	carol := mustInsert(t, repo, reservation("Carol", "Cooper", "carol@example.com", 1, 10, 12))
+	dave := mustInsert(t, repo, reservation("Dave", "Dyer", "dave@elsewhere.org", 2, 20, 25))
+
+	if err := repo.UpdateProcessedForReservation(bob, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.CancelReservation(carol); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name   string
+		filter models.ReservationFilter
+		total  int
+		ids    []int
+	}{
+		{"all", models.ReservationFilter{}, 4, []int{alice, bob, carol, dave}},
+		{"sorted descending", models.ReservationFilter{Desc: true}, 4, []int{dave, carol, bob, alice}},
+		{"sorted by room", models.ReservationFilter{Sort: "room"}, 4, []int{bob, dave, alice, carol}},
+		{"sorted by email", models.ReservationFilter{Sort: "email", Desc: true}, 4, []int{dave, carol, bob, alice}},
+		{"unknown sort", models.ReservationFilter{Sort: "password"}, 4, []int{alice, bob, carol, dave}},
+		{"second page", models.ReservationFilter{Page: 2, PageSize: 3}, 4, []int{dave}},
+		{"room", models.ReservationFilter{RoomID: 2}, 2, []int{bob, dave}},
+		{"departing after", models.ReservationFilter{From: Date(8)}, 2, []int{carol, dave}},
+		{"arriving by", models.ReservationFilter{To: Date(5)}, 2, []int{alice, bob}},
+		{"new", models.ReservationFilter{Status: "new"}, 2, []int{alice, dave}},
+		{"processed", models.ReservationFilter{Status: "processed"}, 1, []int{bob}},
+		{"cancelled", models.ReservationFilter{Status: "cancelled"}, 1, []int{carol}},
+		{"query", models.ReservationFilter{Query: "EXAMPLE.com"}, 3, []int{alice, bob, carol}},
+		{"query and room", models.ReservationFilter{Query: "example", RoomID: 1}, 2, []int{alice, carol}},
+		{"no match", models.ReservationFilter{Query: "zed"}, 0, []int{}},
+	}
+
+	for _, e := range tests {
+		f := e.filter
+		if f.Page == 0 {
+			f.Page = 1
+		}
+		if f.PageSize == 0 {
+			f.PageSize = 10
+		}
+
+		reservations, total, err := repo.SearchReservations(f)
+		if err != nil {
+			t.Fatalf("%s: %s", e.name, err)
+		}
+		if total != e.total {
+			t.Errorf("%s: expected %d matches, got %d", e.name, e.total, total)
+		}
+		if got := reservationIDs(reservations); !equalIDs(got, e.ids) {
+			t.Errorf("%s: expected reservations %v, got %v", e.name, e.ids, got)
+		}
+	}
+
+	reservations, _, _ := repo.SearchReservations(models.ReservationFilter{Page: 1, PageSize: 10, Status: "cancelled"})
+	if len(reservations) == 1 && (!reservations[0].Cancelled() || reservations[0].Room.RoomName != "General's Quarters") {
+		t.Errorf("unexpected cancelled reservation %+v", reservations[0])
+	}
+}
+
+func testFullTextSearch(t *testing.T, repo repository.DatabaseRepo) {
+	res := reservation("Jane", "Doe", "Jane@Example.com", 2, 3, 5)
+	res.Phone = "+1 (555) 123-4567"
+	res.Notes = "late arrival"
+	jane := mustInsert(t, repo, res)
+
+	janet := mustInsert(t, repo, reservation("Janet", "Doe", "jd@example.org", 1, 7, 9))
+
+	var tests = []struct {
+		text string
+		ids  []int
+	}{
+		{"late", []int{jane}},
+		{"5551234", []int{jane}},
+		{"jane doe", []int{jane, janet}},
+		{"nobody", []int{}},
+		{"", []int{}},
+	}
+
+	for _, e := range tests {
+		found, err := repo.FullTextSearchReservations(e.text, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := reservationIDs(found); !equalIDs(got, e.ids) {
+			t.Errorf("searching for %q: expected %v, got %v", e.text, e.ids, got)
+		}
+	}
+
+	found, err := repo.FullTextSearchReservations("jane doe", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].ID != jane || found[0].Room.RoomName != "Colonel's Suite" {
+		t.Errorf("expected the best match only, got %+v", found)
+	}
+}
+
+func testGuests(t *testing.T, repo repository.DatabaseRepo) {
+	first := reservation("Jane", "Doe", "jane@example.com", 1, 3, 5)
+	first.Phone = "555-0100"
+	mustInsert(t, repo, first)
+
+	//the same email in another case is the same guest, whose details are refreshed from the latest booking
+	second := reservation("Jane", "Doe", " JANE@Example.com", 2, 20, 22)
+	id := mustInsert(t, repo, second)
+
+	res, _ := repo.GetReservationByID(id)
+	guestID := res.GuestID
+
+	janet := reservation("Janet", "Doe", "janet@example.com", 1, 10, 12)
+	janet.Phone = "555-0100"
+	mustInsert(t, repo, janet)
+	mustInsert(t, repo, reservation("JANE", "DOE", "jdoe@work.com", 2, 8, 9))
+	mustInsert(t, repo, reservation("Bob", "Smith", "bob@example.com", 1, 1, 2))
+
+	guests, total, err := repo.SearchGuests("example.com", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || len(guests) != 3 {
+		t.Fatalf("expected 3 guests, got %+v (total %d)", guests, total)
+	}
+
+	jane := guests[0]
+	if jane.ID != guestID || jane.Email != "jane@example.com" || jane.Phone != "555-0100" {
+		t.Errorf("unexpected guest %+v", jane)
+	}
+	if jane.StayCount != 2 || !jane.LastArrival.Equal(Date(20)) {
+		t.Errorf("expected 2 stays, the last on the 20th, got %+v", jane)
+	}
+	if guests[1].FirstName != "Janet" || guests[2].FirstName != "Bob" {
+		t.Errorf("expected guests ordered by name, got %+v", guests)
+	}
+
+	guests, total, _ = repo.SearchGuests("example.com", 1, 1)
+	if total != 3 || len(guests) != 1 || guests[0].FirstName != "Janet" {
+		t.Errorf("unexpected second page %+v (total %d)", guests, total)
+	}
+
+	if _, total, _ = repo.SearchGuests("555-0100", 10, 0); total != 2 {
+		t.Errorf("expected 2 guests with the phone number, got %d", total)
+	}
+
+	if _, total, _ = repo.SearchGuests("jane doe", 10, 0); total != 2 {
+		t.Errorf("expected 2 guests named Jane Doe, got %d", total)
+	}
+
+	jane.Phone = "555-0111"
+	jane.Notes = "Prefers a quiet room"
+	jane.Email = "changed@example.com"
+	if err = repo.UpdateGuest(jane); err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := repo.GetGuestByID(guestID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Phone != "555-0111" || g.Notes != "Prefers a quiet room" || g.Email != "jane@example.com" {
+		t.Errorf("unexpected updated guest %+v", g)
+	}
+
+	if _, err = repo.GetGuestByID(99); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows for a missing guest, got %v", err)
+	}
+
+	reservations, err := repo.GetReservationsForGuest(guestID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reservations) != 2 || !reservations[0].StartDate.Equal(Date(20)) || reservations[0].GuestID != guestID {
+		t.Errorf("expected the guest's reservations latest first, got %+v", reservations)
+	}
+
+	//a cancelled stay stays in the guest's history but not in the stay count
+	if err = repo.CancelReservation(id); err != nil {
+		t.Fatal(err)
+	}
+
+	guests, _, _ = repo.SearchGuests("jane@example.com", 10, 0)
+	if len(guests) != 1 || guests[0].StayCount != 1 || !guests[0].LastArrival.Equal(Date(3)) {
+		t.Errorf("expected 1 stay, the last on the 3rd, after cancelling, got %+v", guests)
+	}
+
+	reservations, _ = repo.GetReservationsForGuest(guestID)
+	if len(reservations) != 2 || !reservations[0].Cancelled() || reservations[1].Cancelled() {
+		t.Errorf("expected the cancelled stay to be kept and marked, got %+v", reservations)
+	}
+
+	//Janet shares the old phone number and jdoe@work.com the name
+	g.Phone = "555-0100"
+	duplicates, err := repo.FindDuplicateGuests(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(duplicates) != 2 || duplicates[0].FirstName != "Janet" || duplicates[1].Email != "jdoe@work.com" {
+		t.Errorf("unexpected duplicates %+v", duplicates)
+	}
+
+	g.Phone = ""
+	if duplicates, _ = repo.FindDuplicateGuests(g); len(duplicates) != 1 {
+		t.Errorf("an empty phone number matched other guests: %+v", duplicates)
+	}
+}
+
+func testMergeGuests(t *testing.T, repo repository.DatabaseRepo) {
+	id := mustInsert(t, repo, reservation("Jane", "Doe", "jane@example.com", 1, 3, 5))
+	res, _ := repo.GetReservationByID(id)
+	target := res.GuestID
+
+	source := reservation("Jane", "Doe", "jdoe@work.com", 2, 8, 9)
+	source.Phone = "555-0100"
+	id = mustInsert(t, repo, source)
+	res, _ = repo.GetReservationByID(id)
+
+	g, _ := repo.GetGuestByID(res.GuestID)
+	g.Notes = "Allergic to feathers"
+	if err := repo.UpdateGuest(g); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.MergeGuests(target, g.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := repo.GetGuestByID(g.ID); err != sql.ErrNoRows {
+		t.Errorf("expected the merged guest to be deleted, got %v", err)
+	}
+
+	merged, err := repo.GetGuestByID(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.Phone != "555-0100" || merged.Notes != "Allergic to feathers" || merged.Email != "jane@example.com" {
+		t.Errorf("unexpected merged guest %+v", merged)
+	}
+
+	//new bookings under the merged email belong to the remaining guest
+	id = mustInsert(t, repo, reservation("Jane", "Doe", "JDOE@work.com", 1, 20, 21))
+	if res, _ = repo.GetReservationByID(id); res.GuestID != target {
+		t.Errorf("a booking under the merged email went to guest %d", res.GuestID)
+	}
+
+	reservations, _ := repo.GetReservationsForGuest(target)
+	if len(reservations) != 3 {
+		t.Errorf("expected 3 reservations after the merge, got %d", len(reservations))
+	}
+
+	if err = repo.MergeGuests(target, target); err == nil {
+		t.Error("merged a guest into itself")
+	}
+
+	if err = repo.MergeGuests(target, 99); err == nil {
+		t.Error("merged a missing guest")
+	}
+}
+
+func testOutbox(t *testing.T, repo repository.DatabaseRepo) {
+	mustBook(t, repo, reservation("Jane", "Doe", "jane@example.com", 1, 10, 12),
+		models.MailData{To: "jane@example.com", From: "me@here.com", Subject: "First", Content: "<p>1</p>", TextContent: "1", Template: "basic.html"},
+		models.MailData{To: "me@here.com", From: "me@here.com", Subject: "Second", Content: "<p>2</p>"},
+	)
+
+	now := time.Now()
+	lease := 10 * time.Minute
+
+	due, err := repo.ClaimOutboxMessages(now.Add(-time.Hour), lease, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 0 {
+		t.Errorf("expected no emails due an hour ago, got %d", len(due))
+	}
+
+	if due, _ = repo.ClaimOutboxMessages(now.Add(time.Minute), lease, 1); len(due) != 1 || due[0].Mail.Subject != "First" {
+		t.Fatalf("expected the limit to be applied to the oldest email, got %+v", due)
+	}
+
+	//a claimed email is not due again, so another worker takes the next one
+	if due, _ = repo.ClaimOutboxMessages(now.Add(time.Minute), lease, 10); len(due) != 1 || due[0].Mail.Subject != "Second" {
+		t.Fatalf("expected only the unclaimed email, got %+v", due)
+	}
+	if due, _ = repo.ClaimOutboxMessages(now.Add(time.Minute), lease, 10); len(due) != 0 {
+		t.Errorf("expected claimed emails not to be claimed again, got %+v", due)
+	}
+
+	//the emails of a worker that stopped are claimed again once its lease ends
+	if due, _ = repo.ClaimOutboxMessages(now.Add(time.Minute+lease), lease, 10); len(due) != 2 || due[0].Mail.Subject != "First" {
+		t.Fatalf("expected both emails after the lease, oldest first, got %+v", due)
+	}
+
+	messages, _, _ := repo.SearchOutboxMessages("", 10, 0)
+	first, second := messages[1], messages[0]
+
+	if first.Mail.To != "jane@example.com" || first.Mail.TextContent != "1" || first.Mail.Template != "basic.html" {
+		t.Errorf("unexpected email %+v", first)
+	}
+
+	first.Status = models.OutboxSent
+	first.Attempts = 1
+	first.SentAt = now
+	if err = repo.UpdateOutboxMessage(first); err != nil {
+		t.Fatal(err)
+	}
+
+	second.Attempts = 1
+	second.NextAttemptAt = now.Add(time.Hour)
+	second.LastError = "connection refused"
+	if err = repo.UpdateOutboxMessage(second); err != nil {
+		t.Fatal(err)
+	}
+
+	if due, _ = repo.ClaimOutboxMessages(now.Add(time.Minute), lease, 10); len(due) != 0 {
+		t.Errorf("expected no emails due after sending and postponing, got %+v", due)
+	}
+
+	if due, _ = repo.ClaimOutboxMessages(now.Add(2*time.Hour), lease, 10); len(due) != 1 || due[0].ID != second.ID {
+		t.Errorf("expected the postponed email to be due later, got %+v", due)
+	}
+
+	sent, total, err := repo.SearchOutboxMessages(models.OutboxSent, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || !equalIDs(outboxIDs(sent), []int{first.ID}) || sent[0].SentAt.IsZero() {
+		t.Errorf("unexpected sent emails %+v", sent)
+	}
+
+	if page, total, _ := repo.SearchOutboxMessages("", 1, 1); total != 2 || !equalIDs(outboxIDs(page), []int{first.ID}) {
+		t.Errorf("expected the older email on the second page, got %+v", page)
+	}
+
+	msg, err := repo.GetOutboxMessageByID(second.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Status != models.OutboxPending || msg.Attempts != 1 || msg.LastError != "connection refused" || !msg.SentAt.IsZero() {
+		t.Errorf("unexpected postponed email %+v", msg)
+	}
+
+	if _, err = repo.GetOutboxMessageByID(99); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows for a missing email, got %v", err)
+	}
+}
+
+func testEmailSchedules(t *testing.T, repo repository.DatabaseRepo) {
+	schedules, err := repo.AllEmailSchedules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schedules) != 2 || schedules[0].Anchor != models.AnchorArrival || schedules[1].Anchor != models.AnchorDeparture {
+		t.Fatalf("expected the seeded schedules, arrival first, got %+v", schedules)
+	}
+
+	s, err := repo.GetEmailScheduleByID(schedules[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Template != "post-stay-thanks" || s.OffsetDays != 1 || !s.Enabled {
+		t.Errorf("unexpected schedule %+v", s)
+	}
+
+	s.Anchor = models.AnchorArrival
+	s.OffsetDays = -7
+	s.Enabled = false
+	s.Name = "Early reminder"
+	if err = repo.UpdateEmailSchedule(s); err != nil {
+		t.Fatal(err)
+	}
+
+	schedules, _ = repo.AllEmailSchedules()
+	if len(schedules) != 2 || schedules[0].ID != s.ID || schedules[0].Enabled || schedules[0].Name != "Early reminder" {
+		t.Errorf("expected the updated schedule to come first, got %+v", schedules)
+	}
+
+	if _, err = repo.GetEmailScheduleByID(99); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows for a missing schedule, got %v", err)
+	}
+}
+
+func testReservationsDueForEmail(t *testing.T, repo repository.DatabaseRepo) {
+	schedules, err := repo.AllEmailSchedules()
+	if err != nil || len(schedules) != 2 {
+		t.Fatalf("expected the seeded schedules (err %v)", err)
+	}
+	reminder, thanks := schedules[0], schedules[1]
+
+	early := mustInsert(t, repo, reservation("Ann", "Early", "ann@example.com", 1, 8, 9))
+	ben := reservation("Ben", "OnTime", "ben@example.com", 2, 10, 15)
+	ben.Locale = "es"
+	onTime := mustInsert(t, repo, ben)
+	tooSoon := mustInsert(t, repo, reservation("Cat", "Soon", "cat@example.com", 1, 11, 12))
+	cancelled := mustInsert(t, repo, reservation("Dan", "Gone", "dan@example.com", 2, 9, 10))
+	tooLate := mustInsert(t, repo, reservation("Eve", "Late", "eve@example.com", 1, 5, 6))
+
+	if err = repo.CancelReservation(cancelled); err != nil {
+		t.Fatal(err)
+	}
+
+	//three days before arrival on the 10th, with two days of grace for missed runs
+	due, err := repo.ReservationsDueForEmail(reminder, Date(7), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reservationIDs(due); !equalIDs(got, []int{early, onTime}) {
+		t.Errorf("expected reminders due for %v, got %v (%d and %d are outside the window)", []int{early, onTime}, got, tooSoon, tooLate)
+	}
+
+	//arrival reminders are never sent once the guest has arrived
+	dayBefore := reminder
+	dayBefore.OffsetDays = -1
+	if due, _ = repo.ReservationsDueForEmail(dayBefore, Date(9), 5); !equalIDs(reservationIDs(due), []int{onTime}) {
+		t.Errorf("expected only the stay that has not started, got %v", reservationIDs(due))
+	}
+
+	//two days after arrival on the 10th, once the guest is staying
+	afterArrival := reminder
+	afterArrival.OffsetDays = 2
+	if due, _ = repo.ReservationsDueForEmail(afterArrival, Date(12), 1); !equalIDs(reservationIDs(due), []int{onTime}) {
+		t.Errorf("expected the email after arrival due for %d, got %v", onTime, reservationIDs(due))
+	}
+
+	queued, err := repo.QueueScheduledEmail(onTime, reminder.ID, models.MailData{To: "ben@example.com", Subject: "See you soon"})
+	if err != nil || !queued {
+		t.Fatalf("email was not queued (err %v)", err)
+	}
+
+	queued, err = repo.QueueScheduledEmail(onTime, reminder.ID, models.MailData{To: "ben@example.com", Subject: "See you soon"})
+	if err != nil || queued {
+		t.Errorf("the same email was queued twice (err %v)", err)
+	}
+
+	if _, total, _ := repo.SearchOutboxMessages("", 10, 0); total != 1 {
+		t.Errorf("expected 1 queued email, got %d", total)
+	}
+
+	if due, _ = repo.ReservationsDueForEmail(reminder, Date(7), 2); !equalIDs(reservationIDs(due), []int{early}) {
+		t.Errorf("expected the queued reminder to no longer be due, got %v", reservationIDs(due))
+	}
+
+	//a day after departure on the 15th, which the sent reminder does not affect
+	due, _ = repo.ReservationsDueForEmail(thanks, Date(16), 0)
+	if !equalIDs(reservationIDs(due), []int{onTime}) || due[0].Room.RoomName != "Colonel's Suite" || due[0].Locale != "es" {
+		t.Errorf("expected the thank you email due for %d, got %+v", onTime, due)
+	}
+}
+
+func testImportUploads(t *testing.T, repo repository.DatabaseRepo) {
+	content := "first_name,last_name\nJoseph,Clyde\n"
+
+	if err := repo.SaveImportUpload("abc", content); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SaveImportUpload("abc", "other"); err == nil {
+		t.Error("saved two uploads under one token")
+	}
+
+	got, err := repo.TakeImportUpload("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != content {
+		t.Errorf("expected the saved content, got %q", got)
+	}
+
+	if _, err = repo.TakeImportUpload("abc"); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows for an upload taken before, got %v", err)
+	}
+	if _, err = repo.TakeImportUpload("missing"); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows for a missing upload, got %v", err)
+	}
+}
+
+func testTransaction(t *testing.T, repo repository.DatabaseRepo) {
+	failure := errors.New("failure")
+
+	err := repo.Transaction(func(tx repository.DatabaseRepo) error {
+		if _, err := tx.InsertRoom(models.Room{RoomName: "Admiral's Cabin"}); err != nil {
+			return err
+		}
+		mustBook(t, tx, reservation("Jane", "Doe", "jane@example.com", 1, 10, 12))
+		return failure
+	})
+	if err != failure {
+		t.Fatalf("expected the error of the function, got %v", err)
+	}
+
+	if rooms, _ := repo.AllRooms(); len(rooms) != 2 {
+		t.Errorf("expected the room of a failed transaction to be rolled back, got %+v", rooms)
+	}
+	if ok, _ := repo.CheckAvailabilityByDatesByRoomID(Date(10), Date(12), 1); !ok {
+		t.Error("expected the booking of a failed transaction to be rolled back")
+	}
+	if _, total, _ := repo.SearchGuests("jane", 10, 0); total != 0 {
+		t.Error("expected the guest of a failed transaction to be rolled back")
+	}
+
+	err = repo.Transaction(func(tx repository.DatabaseRepo) error {
+		//a failed write inside the transaction leaves the others in it usable
+		if _, err := tx.BookReservation(reservation("Jim", "Beam", "jim@example.com", 99, 10, 12), 0, nil); err == nil {
+			t.Error("booked a missing room")
+		}
+		mustBook(t, tx, reservation("Jane", "Doe", "jane@example.com", 1, 10, 12))
+		_, err := tx.InsertRoom(models.Room{RoomName: "Admiral's Cabin"})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rooms, _ := repo.AllRooms(); len(rooms) != 3 {
+		t.Errorf("expected the room of the transaction to be committed, got %+v", rooms)
+	}
+	if ok, _ := repo.CheckAvailabilityByDatesByRoomID(Date(10), Date(12), 1); ok {
+		t.Error("expected the booking of the transaction to be committed")
+	}
+}
@@ -0,0 +1,110 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/Rha02/bookings/internal/config"
+	"github.com/Rha02/bookings/internal/models"
+	"github.com/Rha02/bookings/internal/render"
+)
+
+//GraceDays is how many days late a scheduled email may still be sent, e.g. after downtime
+const GraceDays = 7
+
+//Store is the storage the scheduler reads schedules and reservations from and queues emails in
+type Store interface {
+	AllEmailSchedules() ([]models.EmailSchedule, error)
+	ReservationsDueForEmail(s models.EmailSchedule, today time.Time, graceDays int) ([]models.Reservation, error)
+	QueueScheduledEmail(reservationID, scheduleID int, msg models.MailData) (bool, error)
+}
+
+//Scheduler queues the emails from every enabled email schedule for the reservations they are due for.
+//Every email sent is recorded with its reservation, so restarting or running it again never sends duplicates.
+type Scheduler struct {
+	App      *config.AppConfig
+	DB       Store
+	Interval time.Duration
+
+	now func() time.Time
+}
+
+//New returns a Scheduler that checks for due emails every hour
+func New(a *config.AppConfig, db Store) *Scheduler {
+	return &Scheduler{
+		App:      a,
+		DB:       db,
+		Interval: time.Hour,
+		now:      time.Now,
+	}
+}
+
+//Run queues due emails every Interval until ctx is cancelled
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		_, err := s.RunOnce()
+		if err != nil {
+			s.App.Logger.Error().Err(err).Msg("cannot queue scheduled emails")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+//RunOnce queues every email that is due today and returns how many were queued
+func (s *Scheduler) RunOnce() (int, error) {
+	schedules, err := s.DB.AllEmailSchedules()
+	if err != nil {
+		return 0, err
+	}
+
+	now := s.now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	queued := 0
+	for _, schedule := range schedules {
+		if !schedule.Enabled {
+			continue
+		}
+
+		reservations, err := s.DB.ReservationsDueForEmail(schedule, today, GraceDays)
+		if err != nil {
+			return queued, err
+		}
+
+		for _, res := range reservations {
+			msg, err := render.LocalizedMail(schedule.Template, res.Locale, models.ReservationMail{
+				Reservation: res,
+				Property:    s.App.Property,
+				Locale:      res.Locale,
+			})
+			if err != nil {
+				s.App.Logger.Error().Err(err).Str("template", schedule.Template).Int("reservation_id", res.ID).Msg("cannot render scheduled email")
+				continue
+			}
+			msg.To = res.Email
+			msg.From = s.App.Property.Email
+
+			ok, err := s.DB.QueueScheduledEmail(res.ID, schedule.ID, msg)
+			if err != nil {
+				return queued, err
+			}
+			if ok {
+				queued++
+			}
+		}
+	}
+
+	if queued > 0 {
+		s.App.Logger.Info().Int("queued", queued).Msg("queued scheduled emails")
+	}
+
+	return queued, nil
+}
@@ -0,0 +1,151 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Rha02/bookings/internal/config"
+	"github.com/Rha02/bookings/internal/models"
+	"github.com/Rha02/bookings/internal/render"
+	"github.com/rs/zerolog"
+)
+
+var app config.AppConfig
+
+func TestMain(m *testing.M) {
+	app.Logger = zerolog.Nop()
+	app.Property = models.Property{Name: "Fort Dagon Bed and Breakfast", Email: "server@bookings.loc"}
+
+	render.NewRenderer(&app)
+
+	err := os.Chdir("./../..")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tc, err := render.CreateMailTemplateCache()
+	if err != nil {
+		log.Fatal("Cannot create mail template cache", err)
+	}
+
+	app.MailTemplateCache = tc
+	app.UseCache = true
+
+	os.Exit(m.Run())
+}
+
+type memoryStore struct {
+	schedules    []models.EmailSchedule
+	reservations []models.Reservation
+	sent         map[string]bool
+	queued       []models.MailData
+	today        time.Time
+}
+
+func (s *memoryStore) AllEmailSchedules() ([]models.EmailSchedule, error) {
+	return s.schedules, nil
+}
+
+func (s *memoryStore) ReservationsDueForEmail(schedule models.EmailSchedule, today time.Time, graceDays int) ([]models.Reservation, error) {
+	s.today = today
+
+	var due []models.Reservation
+	for _, res := range s.reservations {
+		d := schedule.DueDate(res)
+		if res.Cancelled() || d.After(today) || d.Before(today.AddDate(0, 0, -graceDays)) {
+			continue
+		}
+		if !s.sent[fmt.Sprintf("%d-%d", res.ID, schedule.ID)] {
+			due = append(due, res)
+		}
+	}
+	return due, nil
+}
+
+func (s *memoryStore) QueueScheduledEmail(reservationID, scheduleID int, msg models.MailData) (bool, error) {
+	key := fmt.Sprintf("%d-%d", reservationID, scheduleID)
+	if s.sent[key] {
+		return false, nil
+	}
+	s.sent[key] = true
+	s.queued = append(s.queued, msg)
+	return true, nil
+}
+
+func date(day int) time.Time {
+	return time.Date(2050, 1, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestScheduler_RunOnce(t *testing.T) {
+	store := &memoryStore{
+		schedules: []models.EmailSchedule{
+			{ID: 1, Template: "pre-arrival-reminder", Anchor: models.AnchorArrival, OffsetDays: -3, Enabled: true},
+			{ID: 2, Template: "post-stay-thanks", Anchor: models.AnchorDeparture, OffsetDays: 1, Enabled: true},
+			{ID: 3, Template: "post-stay-thanks", Anchor: models.AnchorArrival, OffsetDays: -3, Enabled: false},
+		},
+		reservations: []models.Reservation{
+			{ID: 1, FirstName: "John", Email: "john@smith.com", StartDate: date(13), EndDate: date(15)},
+			{ID: 2, FirstName: "Jane", Email: "jane@smith.com", StartDate: date(13), EndDate: date(15), CancelledAt: date(2)},
+			{ID: 3, FirstName: "Jack", Email: "jack@smith.com", StartDate: date(5), EndDate: date(9), Locale: "es"},
+			{ID: 4, FirstName: "Jill", Email: "jill@smith.com", StartDate: date(20), EndDate: date(22)},
+		},
+		sent: map[string]bool{},
+	}
+
+	s := New(&app, store)
+	s.now = func() time.Time { return time.Date(2050, 1, 10, 15, 30, 0, 0, time.Local) }
+
+	queued, err := s.RunOnce()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if queued != 2 {
+		t.Fatalf("expected 2 emails queued, got %d", queued)
+	}
+
+	if !store.today.Equal(date(10)) {
+		t.Errorf("expected today to be passed as midnight, got %s", store.today)
+	}
+
+	if store.queued[0].To != "john@smith.com" || !strings.HasPrefix(store.queued[0].Subject, "Your stay at") {
+		t.Errorf("expected a reminder to john@smith.com, got %q to %s", store.queued[0].Subject, store.queued[0].To)
+	}
+
+	//Jack booked in Spanish
+	if store.queued[1].To != "jack@smith.com" || !strings.HasPrefix(store.queued[1].Subject, "Gracias por alojarse") {
+		t.Errorf("expected a thank you in Spanish to jack@smith.com, got %q to %s", store.queued[1].Subject, store.queued[1].To)
+	}
+	if store.queued[1].Template != "post-stay-thanks" {
+		t.Errorf("expected the translation to keep the template name, got %s", store.queued[1].Template)
+	}
+
+	queued, _ = s.RunOnce()
+	if queued != 0 {
+		t.Errorf("expected no emails on the second run, got %d", queued)
+	}
+}
+
+func TestScheduler_MissingTemplate(t *testing.T) {
+	store := &memoryStore{
+		schedules: []models.EmailSchedule{
+			{ID: 1, Template: "non-existent", Anchor: models.AnchorArrival, OffsetDays: 0, Enabled: true},
+		},
+		reservations: []models.Reservation{
+			{ID: 1, Email: "john@smith.com", StartDate: date(10), EndDate: date(12)},
+		},
+		sent: map[string]bool{},
+	}
+
+	s := New(&app, store)
+	s.now = func() time.Time { return date(10) }
+
+	queued, err := s.RunOnce()
+	if err != nil || queued != 0 {
+		t.Errorf("expected a missing template to be skipped, got %d queued and error %v", queued, err)
+	}
+}
@@ -0,0 +1,256 @@
+package seed
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/Rha02/bookings/internal/models"
+	"github.com/Rha02/bookings/internal/repository"
+)
+
+//Options controls the size and shape of a generated dataset. The same options always produce the same dataset.
+type Options struct {
+	Seed         int64
+	Rooms        int
+	Staff        int
+	Reservations int
+	Blocks       int
+	From         time.Time
+	To           time.Time
+	Password     string
+}
+
+//Booking is a generated reservation in the room at index Room of the dataset
+type Booking struct {
+	Room        int
+	Reservation models.Reservation
+}
+
+//Block is a generated owner block in the room at index Room of the dataset, one restriction per night
+type Block struct {
+	Room   int
+	Start  time.Time
+	Nights int
+}
+
+//Dataset is everything Generate decided to create
+type Dataset struct {
+	Rooms    []models.Room
+	Staff    []models.User
+	Bookings []Booking
+	Blocks   []Block
+}
+
+//Summary counts what Apply inserted
+type Summary struct {
+	Rooms        int
+	Staff        int
+	Reservations int
+	Blocks       int
+}
+
+var roomNames = []string{
+	"Major's Suite", "Admiral's Cabin", "Captain's Quarters", "Lieutenant's Loft", "Sergeant's Room",
+	"Commodore's Retreat", "Brigadier's Bunk", "Marshal's Manor", "Ensign's Nook", "Corporal's Corner",
+}
+
+var firstNames = []string{
+	"Ada", "Ben", "Chloe", "Dmitri", "Elena", "Farah", "George", "Hana", "Ivan", "Julia",
+	"Kwame", "Lucia", "Mateo", "Nadia", "Oscar", "Priya", "Quinn", "Rosa", "Samir", "Tess",
+}
+
+var lastNames = []string{
+	"Anderson", "Barros", "Chen", "Dubois", "Eriksen", "Fischer", "Garcia", "Haddad", "Ito", "Jovanovic",
+	"Kowalski", "Lindqvist", "Moreau", "Nakamura", "Okafor", "Petrov", "Rossi", "Schmidt", "Tanaka", "Novak",
+}
+
+var notes = []string{
+	"", "", "", "Late arrival, after 10pm", "Celebrating an anniversary", "Travelling with a dog",
+	"Needs a ground floor room", "Vegetarian breakfast", "Arriving by train",
+}
+
+//Validate checks that the options describe a dataset that can be generated
+func (o Options) Validate() error {
+	switch {
+	case o.Rooms < 1:
+		return errors.New("seed: at least one room is needed")
+	case o.Staff < 0 || o.Reservations < 0 || o.Blocks < 0:
+		return errors.New("seed: counts cannot be negative")
+	case !o.To.After(o.From.AddDate(0, 0, 1)):
+		return errors.New("seed: the date range must be longer than one day")
+	case o.Staff > 0 && o.Password == "":
+		return errors.New("seed: staff users need a password")
+	}
+	return nil
+}
+
+//Generate builds a dataset from the options. Bookings and blocks never overlap within a room;
+//when a room is too full to place one, fewer than requested are generated.
+func Generate(o Options) (Dataset, error) {
+	var ds Dataset
+
+	if err := o.Validate(); err != nil {
+		return ds, err
+	}
+
+	r := rand.New(rand.NewSource(o.Seed))
+	from := day(o.From)
+	days := int(day(o.To).Sub(from).Hours() / 24)
+
+	for i := 0; i < o.Rooms; i++ {
+		name := roomNames[i%len(roomNames)]
+		if i >= len(roomNames) {
+			name = fmt.Sprintf("%s %d", name, i/len(roomNames)+1)
+		}
+		ds.Rooms = append(ds.Rooms, models.Room{RoomName: name})
+	}
+
+	for i := 0; i < o.Staff; i++ {
+		ds.Staff = append(ds.Staff, models.User{
+			FirstName:   firstNames[r.Intn(len(firstNames))],
+			LastName:    lastNames[r.Intn(len(lastNames))],
+			Email:       fmt.Sprintf("staff%d@bookings.loc", i+1),
+			AccessLevel: 3,
+		})
+	}
+
+	//taken[room][day] marks the nights already used by a booking or block
+	taken := make([][]bool, o.Rooms)
+	for i := range taken {
+		taken[i] = make([]bool, days)
+	}
+
+	place := func(maxNights int) (room, start, nights int, ok bool) {
+		for try := 0; try < 50; try++ {
+			room = r.Intn(o.Rooms)
+			nights = 1 + r.Intn(maxNights)
+			if nights > days {
+				nights = days
+			}
+			start = r.Intn(days - nights + 1)
+
+			free := true
+			for d := start; d < start+nights; d++ {
+				if taken[room][d] {
+					free = false
+					break
+				}
+			}
+			if free {
+				for d := start; d < start+nights; d++ {
+					taken[room][d] = true
+				}
+				return room, start, nights, true
+			}
+		}
+		return 0, 0, 0, false
+	}
+
+	for i := 0; i < o.Reservations; i++ {
+		room, start, nights, ok := place(7)
+		if !ok {
+			continue
+		}
+
+		first := firstNames[r.Intn(len(firstNames))]
+		last := lastNames[r.Intn(len(lastNames))]
+		startDate := from.AddDate(0, 0, start)
+
+		ds.Bookings = append(ds.Bookings, Booking{
+			Room: room,
+			Reservation: models.Reservation{
+				FirstName: first,
+				LastName:  last,
+				Email:     fmt.Sprintf("%s.%s%d@example.com", strings.ToLower(first), strings.ToLower(last), r.Intn(100)),
+				Phone:     fmt.Sprintf("555-%03d-%04d", r.Intn(1000), r.Intn(10000)),
+				StartDate: startDate,
+				EndDate:   startDate.AddDate(0, 0, nights),
+				Processed: r.Intn(2),
+				Notes:     notes[r.Intn(len(notes))],
+			},
+		})
+	}
+
+	for i := 0; i < o.Blocks; i++ {
+		room, start, nights, ok := place(3)
+		if !ok {
+			continue
+		}
+		ds.Blocks = append(ds.Blocks, Block{Room: room, Start: from.AddDate(0, 0, start), Nights: nights})
+	}
+
+	return ds, nil
+}
+
+//Apply inserts the dataset in one transaction, so nothing is inserted if any of it fails.
+//Staff users are matched by email, so applying again resets their passwords.
+func Apply(repo repository.DatabaseRepo, ds Dataset, password string) (Summary, error) {
+	var sum Summary
+
+	err := repo.Transaction(func(repo repository.DatabaseRepo) error {
+		sum = Summary{}
+		return apply(repo, ds, password, &sum)
+	})
+	if err != nil {
+		return Summary{}, err
+	}
+
+	return sum, nil
+}
+
+func apply(repo repository.DatabaseRepo, ds Dataset, password string, sum *Summary) error {
+	roomIDs := make([]int, len(ds.Rooms))
+	for i, room := range ds.Rooms {
+		id, err := repo.InsertRoom(room)
+		if err != nil {
+			return err
+		}
+		roomIDs[i] = id
+		sum.Rooms++
+	}
+
+	for _, u := range ds.Staff {
+		_, err := repo.UpsertUser(u, password)
+		if err != nil {
+			return err
+		}
+		sum.Staff++
+	}
+
+	for _, b := range ds.Bookings {
+		res := b.Reservation
+		res.RoomID = roomIDs[b.Room]
+
+		id, err := repo.BookReservation(res, 0, nil)
+		if err != nil {
+			return err
+		}
+
+		if res.Processed == 1 {
+			err = repo.UpdateProcessedForReservation(id, 1)
+			if err != nil {
+				return err
+			}
+		}
+		sum.Reservations++
+	}
+
+	for _, b := range ds.Blocks {
+		for n := 0; n < b.Nights; n++ {
+			err := repo.InsertBlockForRoom(roomIDs[b.Room], b.Start.AddDate(0, 0, n))
+			if err != nil {
+				return err
+			}
+		}
+		sum.Blocks++
+	}
+
+	return nil
+}
+
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
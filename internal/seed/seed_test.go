@@ -0,0 +1,188 @@
+package seed
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Rha02/bookings/internal/config"
+	"github.com/Rha02/bookings/internal/models"
+	"github.com/Rha02/bookings/internal/repository"
+	"github.com/Rha02/bookings/internal/repository/dbrepo"
+)
+
+var testOptions = Options{
+	Seed:         42,
+	Rooms:        4,
+	Staff:        2,
+	Reservations: 40,
+	Blocks:       6,
+	From:         time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+	To:           time.Date(2050, 3, 1, 0, 0, 0, 0, time.UTC),
+	Password:     "password",
+}
+
+func TestGenerate_Deterministic(t *testing.T) {
+	a, err := Generate(testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := Generate(testOptions)
+
+	if !reflect.DeepEqual(a, b) {
+		t.Error("the same seed generated different datasets")
+	}
+
+	o := testOptions
+	o.Seed = 43
+	c, _ := Generate(o)
+	if reflect.DeepEqual(a.Bookings, c.Bookings) {
+		t.Error("different seeds generated the same bookings")
+	}
+}
+
+func TestGenerate_NoOverlaps(t *testing.T) {
+	ds, err := Generate(testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ds.Rooms) != 4 || len(ds.Staff) != 2 || len(ds.Bookings) == 0 || len(ds.Blocks) == 0 {
+		t.Fatalf("unexpected dataset sizes: %d rooms, %d staff, %d bookings, %d blocks",
+			len(ds.Rooms), len(ds.Staff), len(ds.Bookings), len(ds.Blocks))
+	}
+
+	nights := map[int]map[time.Time]bool{}
+	use := func(room int, start, end time.Time) {
+		if start.Before(testOptions.From) || end.After(testOptions.To) || !end.After(start) {
+			t.Errorf("stay %s to %s is outside the range", start, end)
+		}
+		if nights[room] == nil {
+			nights[room] = map[time.Time]bool{}
+		}
+		for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+			if nights[room][d] {
+				t.Errorf("room %d is used twice on %s", room, d)
+			}
+			nights[room][d] = true
+		}
+	}
+
+	for _, b := range ds.Bookings {
+		use(b.Room, b.Reservation.StartDate, b.Reservation.EndDate)
+	}
+	for _, b := range ds.Blocks {
+		use(b.Room, b.Start, b.Start.AddDate(0, 0, b.Nights))
+	}
+}
+
+func TestGenerate_Invalid(t *testing.T) {
+	tests := []func(o *Options){
+		func(o *Options) { o.Rooms = 0 },
+		func(o *Options) { o.Reservations = -1 },
+		func(o *Options) { o.To = o.From },
+		func(o *Options) { o.Password = "" },
+	}
+
+	for i, change := range tests {
+		o := testOptions
+		change(&o)
+		if _, err := Generate(o); err == nil {
+			t.Errorf("invalid options %d did not return an error", i)
+		}
+	}
+}
+
+//recordingRepo records the calls Apply makes; methods it does not override are never called
+type recordingRepo struct {
+	repository.DatabaseRepo
+	rooms        []models.Room
+	users        []models.User
+	restrictions []models.RoomRestriction
+	processed    []int
+	blocks       int
+}
+
+func (r *recordingRepo) Transaction(fn func(repo repository.DatabaseRepo) error) error {
+	return fn(r)
+}
+
+func (r *recordingRepo) InsertRoom(room models.Room) (int, error) {
+	r.rooms = append(r.rooms, room)
+	return 100 + len(r.rooms), nil
+}
+
+func (r *recordingRepo) UpsertUser(u models.User, password string) (int, error) {
+	r.users = append(r.users, u)
+	return len(r.users), nil
+}
+
+func (r *recordingRepo) BookReservation(res models.Reservation, bufferNights int, mail []models.MailData) (int, error) {
+	id := len(r.restrictions) + 1
+	r.restrictions = append(r.restrictions, models.RoomRestriction{
+		StartDate: res.StartDate, EndDate: res.EndDate, RoomID: res.RoomID, ReservationID: id, RestrictionID: 1,
+	})
+	return id, nil
+}
+
+func (r *recordingRepo) UpdateProcessedForReservation(id, processed int) error {
+	r.processed = append(r.processed, id)
+	return nil
+}
+
+func (r *recordingRepo) InsertBlockForRoom(id int, startDate time.Time) error {
+	r.blocks++
+	return nil
+}
+
+func TestApply(t *testing.T) {
+	ds, _ := Generate(testOptions)
+	repo := &recordingRepo{}
+
+	sum, err := Apply(repo, ds, testOptions.Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sum.Rooms != 4 || sum.Staff != 2 || sum.Reservations != len(ds.Bookings) || sum.Blocks != len(ds.Blocks) {
+		t.Errorf("unexpected summary %+v", sum)
+	}
+
+	for i, rr := range repo.restrictions {
+		if rr.RoomID != 101+ds.Bookings[i].Room || rr.ReservationID != i+1 || rr.RestrictionID != 1 {
+			t.Errorf("restriction %d is %+v", i, rr)
+		}
+	}
+
+	nights := 0
+	for _, b := range ds.Blocks {
+		nights += b.Nights
+	}
+	if repo.blocks != nights {
+		t.Errorf("inserted %d block nights, expected %d", repo.blocks, nights)
+	}
+}
+
+func TestApply_RollsBack(t *testing.T) {
+	ds, _ := Generate(testOptions)
+	ds.Staff = nil
+
+	repo := dbrepo.NewMemoryRepo(&config.AppConfig{})
+	repo.Fail("InsertBlockForRoom", errors.New("some error"))
+
+	sum, err := Apply(repo, ds, testOptions.Password)
+	if err == nil {
+		t.Fatal("expected the failed block to fail the seed")
+	}
+	if sum != (Summary{}) {
+		t.Errorf("expected an empty summary for a failed seed, got %+v", sum)
+	}
+
+	if rooms, _ := repo.AllRooms(); len(rooms) != 2 {
+		t.Errorf("expected only the rooms of the migrations after a failed seed, got %d", len(rooms))
+	}
+	if _, total, _ := repo.SearchReservations(models.ReservationFilter{Page: 1, PageSize: 10}); total != 0 {
+		t.Errorf("expected no reservations after a failed seed, got %d", total)
+	}
+}
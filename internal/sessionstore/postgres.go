@@ -0,0 +1,102 @@
+package sessionstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+//PostgresStore keeps sessions in the sessions table so they survive restarts and are shared between instances
+type PostgresStore struct {
+	DB              *sql.DB
+	CleanupInterval time.Duration
+	Logger          zerolog.Logger
+
+	now func() time.Time
+}
+
+//NewPostgresStore returns a PostgresStore that removes expired sessions every five minutes once Run is started
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{
+		DB:              db,
+		CleanupInterval: 5 * time.Minute,
+		Logger:          zerolog.Nop(),
+		now:             time.Now,
+	}
+}
+
+//Find returns the data of an unexpired session
+func (p *PostgresStore) Find(token string) ([]byte, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var b []byte
+	query := `select data from sessions where token = $1 and expiry > $2`
+
+	err := p.DB.QueryRowContext(ctx, query, token, p.now().UTC()).Scan(&b)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	return b, true, nil
+}
+
+//Commit stores the session data, replacing the data and expiry of an existing session
+func (p *PostgresStore) Commit(token string, b []byte, expiry time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `insert into sessions (token, data, expiry) values ($1, $2, $3)
+		on conflict (token) do update set data = excluded.data, expiry = excluded.expiry`
+
+	_, err := p.DB.ExecContext(ctx, stmt, token, b, expiry.UTC())
+	return err
+}
+
+//Delete removes a session; deleting an unknown token is not an error
+func (p *PostgresStore) Delete(token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := p.DB.ExecContext(ctx, `delete from sessions where token = $1`, token)
+	return err
+}
+
+//DeleteExpired removes every expired session and returns how many were removed
+func (p *PostgresStore) DeleteExpired() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := p.DB.ExecContext(ctx, `delete from sessions where expiry <= $1`, p.now().UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+//Run removes expired sessions every CleanupInterval until ctx is cancelled
+func (p *PostgresStore) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.CleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		n, err := p.DeleteExpired()
+		if err != nil {
+			p.Logger.Error().Err(err).Msg("cannot remove expired sessions")
+			continue
+		}
+		p.Logger.Debug().Int64("removed", n).Msg("removed expired sessions")
+	}
+}
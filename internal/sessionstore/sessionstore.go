@@ -0,0 +1,30 @@
+package sessionstore
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/alexedwards/scs/v2/memstore"
+)
+
+const (
+	StoreMemory   = "memory"
+	StorePostgres = "postgres"
+)
+
+//New returns the session store of the given kind. The memory store loses every session on restart
+//and is not shared between instances; the postgres store keeps them in the sessions table of db.
+func New(kind string, db *sql.DB) (scs.Store, error) {
+	switch kind {
+	case StoreMemory:
+		return memstore.New(), nil
+	case StorePostgres, "":
+		if db == nil {
+			return nil, fmt.Errorf("sessionstore: the %s store needs a database connection", StorePostgres)
+		}
+		return NewPostgresStore(db), nil
+	default:
+		return nil, fmt.Errorf("sessionstore: unknown store %q", kind)
+	}
+}
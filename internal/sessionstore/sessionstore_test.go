@@ -0,0 +1,97 @@
+package sessionstore
+
+import (
+	"bytes"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2/memstore"
+	_ "github.com/jackc/pgx/v4/stdlib"
+)
+
+func TestNew(t *testing.T) {
+	s, err := New(StoreMemory, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.(*memstore.MemStore); !ok {
+		t.Errorf("memory store is a %T", s)
+	}
+
+	if _, err = New(StorePostgres, nil); err == nil {
+		t.Error("postgres store without a database did not return an error")
+	}
+
+	db := &sql.DB{}
+	s, err = New(StorePostgres, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := s.(*PostgresStore); !ok || p.DB != db {
+		t.Errorf("postgres store is a %T", s)
+	}
+
+	if _, err = New("redis", nil); err == nil {
+		t.Error("unknown store did not return an error")
+	}
+}
+
+//TestPostgresStore runs against the database in TEST_DATABASE_URL and is skipped when it is not set
+func TestPostgresStore(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`create table if not exists sessions (token text primary key, data bytea not null, expiry timestamptz not null)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec(`delete from sessions where token like 'sessionstore-test-%'`)
+
+	p := NewPostgresStore(db)
+	now := time.Now()
+
+	if err = p.Commit("sessionstore-test-live", []byte("first"), now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Commit("sessionstore-test-live", []byte("second"), now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Commit("sessionstore-test-expired", []byte("old"), now.Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	b, found, err := p.Find("sessionstore-test-live")
+	if err != nil || !found || !bytes.Equal(b, []byte("second")) {
+		t.Errorf("Find returned %q, %v, %v; want second, true, nil", b, found, err)
+	}
+
+	_, found, err = p.Find("sessionstore-test-expired")
+	if err != nil || found {
+		t.Errorf("expired session was found (err %v)", err)
+	}
+
+	n, err := p.DeleteExpired()
+	if err != nil || n < 1 {
+		t.Errorf("DeleteExpired removed %d sessions (err %v)", n, err)
+	}
+
+	if err = p.Delete("sessionstore-test-live"); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ = p.Find("sessionstore-test-live"); found {
+		t.Error("deleted session was found")
+	}
+	if err = p.Delete("sessionstore-test-missing"); err != nil {
+		t.Errorf("deleting an unknown session returned %v", err)
+	}
+}
@@ -0,0 +1,10 @@
+create table users (
+    id serial primary key,
+    email varchar(255) not null,
+    first_name varchar(255) not null default '',
+    last_name varchar(255) not null default '',
+    password varchar(60) not null,
+    access_level integer not null default 1,
+    created_at timestamp not null,
+    updated_at timestamp not null
+);
@@ -0,0 +1,13 @@
+create table reservations (
+    id serial primary key,
+    email varchar(255) not null,
+    first_name varchar(255) not null default '',
+    last_name varchar(255) not null default '',
+    phone varchar(255) not null default '',
+    start_date date not null,
+    end_date date not null,
+    room_id integer not null,
+    access_level integer not null default 1,
+    created_at timestamp not null,
+    updated_at timestamp not null
+);
@@ -0,0 +1,10 @@
+create table room_restrictions (
+    id serial primary key,
+    room_id integer not null,
+    reservation_id integer not null,
+    restriction_id integer not null,
+    start_date date not null,
+    end_date date not null,
+    created_at timestamp not null,
+    updated_at timestamp not null
+);
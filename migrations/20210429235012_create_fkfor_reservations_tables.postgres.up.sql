@@ -0,0 +1,2 @@
+alter table reservations add constraint reservations_rooms_id_fk
+    foreign key (room_id) references rooms (id) on update cascade on delete cascade;
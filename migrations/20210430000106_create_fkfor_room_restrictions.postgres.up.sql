@@ -0,0 +1,8 @@
+alter table room_restrictions add constraint room_restrictions_rooms_id_fk
+    foreign key (room_id) references rooms (id) on update cascade on delete cascade;
+
+alter table room_restrictions add constraint room_restrictions_restrictions_id_fk
+    foreign key (restriction_id) references restrictions (id) on update cascade on delete cascade;
+
+alter table room_restrictions add constraint room_restrictions_reservations_id_fk
+    foreign key (reservation_id) references reservations (id) on update cascade on delete cascade;
@@ -0,0 +1,3 @@
+create index room_restrictions_start_date_end_date_idx on room_restrictions (start_date, end_date);
+create index room_restrictions_room_id_idx on room_restrictions (room_id);
+create index room_restrictions_reservation_id_idx on room_restrictions (reservation_id);
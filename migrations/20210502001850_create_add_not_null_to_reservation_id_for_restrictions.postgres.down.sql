@@ -0,0 +1 @@
+-- owner blocks have no reservation, so reservation_id cannot be made required again
@@ -0,0 +1 @@
+alter table room_restrictions alter column reservation_id drop not null;
@@ -1,3 +1,3 @@
-INSERT INTO public.rooms (room_name,created_at,updated_at) VALUES
+INSERT INTO rooms (room_name,created_at,updated_at) VALUES
 	 ('General''s Quarters','2021-05-01 00:00:00.000','2021-05-01 00:00:00.000'),
 	 ('Colonel''s Suite','2021-05-01 00:00:00.000','2021-05-01 00:00:00.000');
\ No newline at end of file
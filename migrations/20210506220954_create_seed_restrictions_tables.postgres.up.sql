@@ -1,3 +1,3 @@
-INSERT INTO public.restrictions (restriction_name,created_at,updated_at) VALUES
+INSERT INTO restrictions (restriction_name,created_at,updated_at) VALUES
 	 ('Reservation','2021-05-01 00:00:00.000','2021-05-01 00:00:00.000'),
 	 ('Owner Block','2021-05-01 00:00:00.000','2021-05-01 00:00:00.000');
\ No newline at end of file
@@ -1 +1 @@
-delete from users where email = "admin@bookings.loc"
\ No newline at end of file
+delete from users where email = 'admin@bookings.loc';
@@ -1,2 +1,2 @@
-INSERT INTO public.users (email,first_name,last_name,"password",access_level,created_at,updated_at) VALUES
+INSERT INTO users (email,first_name,last_name,"password",access_level,created_at,updated_at) VALUES
 	 ('admin@bookings.loc','Admin','Adminovsky','$2a$12$DkLLLLs14RFOnQIcnupWguVE7w2JLTKYinGqzsSoBl8xT8VC1hD1S',3,'2021-05-10 00:00:00.000','2021-05-10 00:00:00.000');
\ No newline at end of file
@@ -0,0 +1,2 @@
+drop index if exists reservations_start_date_idx;
+drop index if exists reservations_room_id_idx;
\ No newline at end of file
@@ -0,0 +1,2 @@
+create index reservations_start_date_idx on reservations (start_date);
+create index reservations_room_id_idx on reservations (room_id);
\ No newline at end of file
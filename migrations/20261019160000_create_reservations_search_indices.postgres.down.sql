@@ -0,0 +1,5 @@
+drop index if exists reservations_email_trgm_idx;
+drop index if exists reservations_name_trgm_idx;
+drop index if exists reservations_search_idx;
+
+alter table reservations drop column notes;
@@ -0,0 +1,9 @@
+alter table reservations add column notes text not null default '';
+
+create extension if not exists pg_trgm;
+
+create index reservations_search_idx on reservations
+    using gin (to_tsvector('simple', first_name || ' ' || last_name || ' ' || email || ' ' || phone || ' ' || notes));
+
+create index reservations_name_trgm_idx on reservations using gin (lower(first_name || ' ' || last_name) gin_trgm_ops);
+create index reservations_email_trgm_idx on reservations using gin (lower(email) gin_trgm_ops);
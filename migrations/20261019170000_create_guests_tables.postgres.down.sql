@@ -0,0 +1,4 @@
+drop index if exists reservations_guest_id_idx;
+alter table reservations drop column guest_id;
+drop table guest_aliases;
+drop table guests;
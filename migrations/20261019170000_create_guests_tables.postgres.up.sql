@@ -0,0 +1,35 @@
+create table guests (
+    id serial primary key,
+    email varchar(255) not null,
+    first_name varchar(255) not null default '',
+    last_name varchar(255) not null default '',
+    phone varchar(255) not null default '',
+    notes text not null default '',
+    created_at timestamp not null,
+    updated_at timestamp not null
+);
+
+create unique index guests_email_idx on guests (email);
+
+create table guest_aliases (
+    email varchar(255) primary key,
+    guest_id integer not null references guests (id) on delete cascade on update cascade,
+    created_at timestamp not null
+);
+
+create index guest_aliases_guest_id_idx on guest_aliases (guest_id);
+
+alter table reservations add column guest_id integer
+    references guests (id) on delete set null on update cascade;
+
+create index reservations_guest_id_idx on reservations (guest_id);
+
+-- build a profile for every distinct email, using the details of the latest booking
+insert into guests (email, first_name, last_name, phone, created_at, updated_at)
+select distinct on (lower(trim(email))) lower(trim(email)), first_name, last_name, phone, created_at, updated_at
+from reservations
+order by lower(trim(email)), created_at desc;
+
+update reservations r set guest_id = g.id
+from guests g
+where g.email = lower(trim(r.email));
@@ -0,0 +1 @@
+alter table outbox add column text_content text not null default '';
@@ -0,0 +1,3 @@
+drop table reservation_emails;
+drop table email_schedules;
+alter table reservations drop column cancelled_at;
@@ -0,0 +1,25 @@
+alter table reservations add column cancelled_at timestamp null;
+
+create table email_schedules (
+    id serial primary key,
+    name varchar(255) not null,
+    template varchar(255) not null,
+    anchor varchar(20) not null,
+    offset_days integer not null,
+    enabled boolean not null default true,
+    created_at timestamp not null,
+    updated_at timestamp not null
+);
+
+insert into email_schedules (name, template, anchor, offset_days, enabled, created_at, updated_at) values
+    ('Pre-arrival reminder', 'pre-arrival-reminder', 'arrival', -3, true, now(), now()),
+    ('Post-stay thank you', 'post-stay-thanks', 'departure', 1, true, now(), now());
+
+create table reservation_emails (
+    reservation_id integer not null references reservations (id) on delete cascade on update cascade,
+    schedule_id integer not null references email_schedules (id) on delete cascade on update cascade,
+    created_at timestamp not null,
+    primary key (reservation_id, schedule_id)
+);
+
+create index reservation_emails_schedule_id_idx on reservation_emails (schedule_id);
@@ -0,0 +1,11 @@
+drop table sessions;
+drop table reservation_emails;
+drop table email_schedules;
+drop table outbox;
+drop table room_restrictions;
+drop table reservations;
+drop table guest_aliases;
+drop table guests;
+drop table restrictions;
+drop table rooms;
+drop table users;
@@ -0,0 +1,154 @@
+-- SQLite gets the whole schema in one migration; the Postgres migrations before this one build the same tables step by step
+create table users (
+    id integer primary key autoincrement,
+    email varchar(255) not null,
+    first_name varchar(255) not null default '',
+    last_name varchar(255) not null default '',
+    password varchar(60) not null,
+    access_level integer not null default 1,
+    created_at timestamp not null,
+    updated_at timestamp not null
+);
+
+create unique index users_email_idx on users (email);
+
+create table rooms (
+    id integer primary key autoincrement,
+    room_name varchar(255) not null,
+    created_at timestamp not null,
+    updated_at timestamp not null
+);
+
+create table restrictions (
+    id integer primary key autoincrement,
+    restriction_name varchar(255) not null,
+    created_at timestamp not null,
+    updated_at timestamp not null
+);
+
+create table guests (
+    id integer primary key autoincrement,
+    email varchar(255) not null,
+    first_name varchar(255) not null default '',
+    last_name varchar(255) not null default '',
+    phone varchar(255) not null default '',
+    notes text not null default '',
+    created_at timestamp not null,
+    updated_at timestamp not null
+);
+
+create unique index guests_email_idx on guests (email);
+
+create table guest_aliases (
+    email varchar(255) primary key,
+    guest_id integer not null references guests (id) on delete cascade on update cascade,
+    created_at timestamp not null
+);
+
+create index guest_aliases_guest_id_idx on guest_aliases (guest_id);
+
+create table reservations (
+    id integer primary key autoincrement,
+    email varchar(255) not null,
+    first_name varchar(255) not null default '',
+    last_name varchar(255) not null default '',
+    phone varchar(255) not null default '',
+    start_date date not null,
+    end_date date not null,
+    room_id integer not null
+        constraint reservations_rooms_id_fk references rooms (id) on update cascade on delete cascade,
+    access_level integer not null default 1,
+    created_at timestamp not null,
+    updated_at timestamp not null,
+    processed integer not null default 0,
+    notes text not null default '',
+    guest_id integer references guests (id) on delete set null on update cascade,
+    cancelled_at timestamp null
+);
+
+create index reservations_email_idx on reservations (email);
+create index reservations_last_name_idx on reservations (last_name);
+create index reservations_start_date_idx on reservations (start_date);
+create index reservations_room_id_idx on reservations (room_id);
+create index reservations_guest_id_idx on reservations (guest_id);
+
+create table room_restrictions (
+    id integer primary key autoincrement,
+    room_id integer not null
+        constraint room_restrictions_rooms_id_fk references rooms (id) on update cascade on delete cascade,
+    reservation_id integer null
+        constraint room_restrictions_reservations_id_fk references reservations (id) on update cascade on delete cascade,
+    restriction_id integer not null
+        constraint room_restrictions_restrictions_id_fk references restrictions (id) on update cascade on delete cascade,
+    start_date date not null,
+    end_date date not null,
+    created_at timestamp not null,
+    updated_at timestamp not null
+);
+
+create index room_restrictions_start_date_end_date_idx on room_restrictions (start_date, end_date);
+create index room_restrictions_room_id_idx on room_restrictions (room_id);
+create index room_restrictions_reservation_id_idx on room_restrictions (reservation_id);
+
+create table outbox (
+    id integer primary key autoincrement,
+    mail_to varchar(255) not null,
+    mail_from varchar(255) not null,
+    subject varchar(255) not null default '',
+    content text not null default '',
+    template varchar(255) not null default '',
+    status varchar(20) not null default 'pending',
+    attempts integer not null default 0,
+    next_attempt_at timestamp not null,
+    last_error text not null default '',
+    sent_at timestamp null,
+    created_at timestamp not null,
+    updated_at timestamp not null,
+    text_content text not null default ''
+);
+
+create index outbox_status_next_attempt_at_idx on outbox (status, next_attempt_at);
+
+create table email_schedules (
+    id integer primary key autoincrement,
+    name varchar(255) not null,
+    template varchar(255) not null,
+    anchor varchar(20) not null,
+    offset_days integer not null,
+    enabled boolean not null default true,
+    created_at timestamp not null,
+    updated_at timestamp not null
+);
+
+create table reservation_emails (
+    reservation_id integer not null references reservations (id) on delete cascade on update cascade,
+    schedule_id integer not null references email_schedules (id) on delete cascade on update cascade,
+    created_at timestamp not null,
+    primary key (reservation_id, schedule_id)
+);
+
+create index reservation_emails_schedule_id_idx on reservation_emails (schedule_id);
+
+create table sessions (
+    token text primary key,
+    data blob not null,
+    expiry timestamp not null
+);
+
+create index sessions_expiry_idx on sessions (expiry);
+
+-- times are written the way the driver stores them, so they compare correctly with the ones the application writes
+insert into rooms (room_name, created_at, updated_at) values
+    ('General''s Quarters', '2021-05-01 00:00:00+00:00', '2021-05-01 00:00:00+00:00'),
+    ('Colonel''s Suite', '2021-05-01 00:00:00+00:00', '2021-05-01 00:00:00+00:00');
+
+insert into restrictions (restriction_name, created_at, updated_at) values
+    ('Reservation', '2021-05-01 00:00:00+00:00', '2021-05-01 00:00:00+00:00'),
+    ('Owner Block', '2021-05-01 00:00:00+00:00', '2021-05-01 00:00:00+00:00');
+
+insert into users (email, first_name, last_name, password, access_level, created_at, updated_at) values
+    ('admin@bookings.loc', 'Admin', 'Adminovsky', '$2a$12$DkLLLLs14RFOnQIcnupWguVE7w2JLTKYinGqzsSoBl8xT8VC1hD1S', 3, '2021-05-10 00:00:00+00:00', '2021-05-10 00:00:00+00:00');
+
+insert into email_schedules (name, template, anchor, offset_days, enabled, created_at, updated_at) values
+    ('Pre-arrival reminder', 'pre-arrival-reminder', 'arrival', -3, true, '2026-10-19 00:00:00+00:00', '2026-10-19 00:00:00+00:00'),
+    ('Post-stay thank you', 'post-stay-thanks', 'departure', 1, true, '2026-10-19 00:00:00+00:00', '2026-10-19 00:00:00+00:00');
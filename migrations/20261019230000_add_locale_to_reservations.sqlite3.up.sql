@@ -0,0 +1 @@
+alter table reservations add column locale varchar(16) not null default '';
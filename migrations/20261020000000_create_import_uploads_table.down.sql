@@ -0,0 +1 @@
+drop table import_uploads;
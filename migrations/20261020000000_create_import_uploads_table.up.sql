@@ -0,0 +1,5 @@
+create table import_uploads (
+    token varchar(64) primary key,
+    content text not null,
+    created_at timestamp not null
+);
@@ -0,0 +1,8 @@
+package migrations
+
+import "embed"
+
+//FS holds the SQL migrations, named version_name.dialect.up.sql and version_name.dialect.down.sql.
+//Files without a dialect run on every database.
+//go:embed *.sql
+var FS embed.FS
@@ -97,4 +97,67 @@ function Prompt() {
         success: success,
         custom: custom
     }
-}
\ No newline at end of file
+}
+
+//escapeHTML returns text with the characters that have a meaning in HTML escaped
+function escapeHTML(text) {
+    const div = document.createElement("div");
+    div.textContent = text;
+    return div.innerHTML;
+}
+
+//notAvailableHTML explains why /search-availability-json found a room not available, and lists the alternative dates it returned
+function notAvailableHTML(data) {
+    let html = '<p>' + escapeHTML(messages.notAvailable) + '</p>';
+    if (data.rule) {
+        html += '<p>' + escapeHTML(data.rule) + '</p>';
+    }
+    return html + suggestionsHTML(data.suggestions);
+}
+
+//suggestionsHTML lists the alternative dates returned by /search-availability-json, with a link to book each free room
+function suggestionsHTML(suggestions) {
+    if (!suggestions || suggestions.length === 0) {
+        return "";
+    }
+
+    let html = '<p>' + escapeHTML(messages.nearest) + '</p>';
+    suggestions.forEach(s => {
+        html += '<p><strong>' + escapeHTML(s.start_date) + ' ' + escapeHTML(messages.to) + ' ' + escapeHTML(s.end_date) + '</strong><br>';
+        s.rooms.forEach(room => {
+            html += '<a href="' + escapeHTML(room.book_url) + '" class="btn btn-sm btn-primary m-1">' + escapeHTML(messages.book) + ' '
+                + escapeHTML(room.name) + '</a>';
+        });
+        html += '</p>';
+    });
+
+    return html;
+}
+
+//disableBookedDates disables the dates a stay cannot start or end on in a DateRangePicker, from /booked-dates.
+//Without a room id, the dates disabled are those no room is free for.
+function disableBookedDates(rangePicker, roomId) {
+    let url = '/booked-dates';
+    if (roomId !== undefined) {
+        url += '?room_id=' + encodeURIComponent(roomId);
+    }
+
+    fetch(url)
+        .then(res => res.json())
+        .then(data => {
+            if (!data.ok) {
+                return;
+            }
+
+            //a stay cannot start on a booked night, nor end the morning after one, as that would be its last night
+            const booked = data.booked.map(d => {
+                const [month, day, year] = d.split("-").map(Number);
+                return new Date(year, month - 1, day);
+            });
+            const departures = booked.map(d => new Date(d.getFullYear(), d.getMonth(), d.getDate() + 1));
+
+            rangePicker.datepickers[0].setOptions({ datesDisabled: booked });
+            rangePicker.datepickers[1].setOptions({ datesDisabled: departures });
+        })
+        .catch(() => {});
+}